@@ -0,0 +1,19 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"pr-review-service/internal/config"
+)
+
+const configUsage = "usage: pr-review-service [-config file] config print"
+
+// runConfig implements the "config" subcommand. "print" shows the effective
+// configuration after the file and environment are applied, with secrets
+// redacted, in the config file format.
+func runConfig(cfg *config.Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errors.New(configUsage)
+	}
+	return cfg.Print(os.Stdout)
+}
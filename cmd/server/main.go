@@ -1,33 +1,231 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"pr-review-service/internal/config"
 	"pr-review-service/internal/database"
 	"pr-review-service/internal/handlers"
+	"pr-review-service/internal/health"
+	"pr-review-service/internal/logging"
+	"pr-review-service/internal/metrics"
 	"pr-review-service/internal/service"
+	"pr-review-service/internal/tracing"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func main() {
-	cfg := config.Load()
+	if err := run(); err != nil {
+		slog.Error("Exiting", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run starts the command selected by the arguments and returns once it is
+// done, so its deferred cleanup runs before main exits.
+func run() error {
+	configPath := flag.String("config", os.Getenv(config.FileEnv),
+		"path to a TOML config file, "+config.FileEnv+" by default; environment variables override it")
+	flag.Parse()
+	args := flag.Args()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+	logger := logging.New(os.Stderr, level)
+	slog.SetDefault(logger)
+
+	if len(args) > 0 && args[0] == "config" {
+		if err := runConfig(cfg, args[1:]); err != nil {
+			return fmt.Errorf("config command failed: %w", err)
+		}
+		return nil
+	}
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(cfg.DatabaseURL, args[1:]); err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+		return nil
+	}
+	if len(args) > 0 && args[0] == "token" {
+		if err := runToken(cfg.DatabaseURL, args[1:]); err != nil {
+			return fmt.Errorf("token command failed: %w", err)
+		}
+		return nil
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unknown command %q (want config, migrate or token)", args[0])
+	}
 
 	db, err := database.NewDB(cfg.DatabaseURL)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 	defer db.Close()
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	tracer, err := newTracer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer tracer.Shutdown(context.Background())
+
+	probes := health.NewRegistry()
+	probes.Register("migrations", migrator.CheckVersion)
 
-	svc := service.NewService(db)
+	registry := metrics.NewRegistry()
+	store := database.NewObservedStore(db, database.WithQueryTimeout(cfg.QueryTimeout, observeQueries(registry, logger)))
 
-	h := handlers.NewHandlers(svc)
+	svc := service.NewService(store, service.Options{
+		DefaultReviewerStrategy: cfg.ReviewerStrategy,
+		DefaultReviewersCount:   cfg.DefaultReviewersCount,
+		IdempotencyTTL:          cfg.IdempotencyTTL,
+		WebhookMaxAttempts:      cfg.WebhookMaxAttempts,
+		WebhookBackoff:          cfg.WebhookBackoff,
+		WebhookClient:           &http.Client{Timeout: cfg.WebhookTimeout},
+		GitHubWebhookSecret:     cfg.GitHubWebhookSecret,
+		GitLabWebhookToken:      cfg.GitLabWebhookToken,
+		Metrics:                 registry,
+		Logger:                  logger,
+		Tracer:                  tracer,
+		Health:                  probes,
+	})
+
+	h := handlers.NewHandlers(svc, handlers.Options{
+		Metrics:        registry,
+		Logger:         logger,
+		Tracer:         tracer,
+		RequestTimeout: cfg.RequestTimeout,
+		MaxBodyBytes:   int64(cfg.MaxBodyBytes),
+		Health:         probes,
+	})
 
 	mux := http.NewServeMux()
 	h.SetupRoutes(mux)
+	server := newServer(cfg, mux, logger)
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	// Listen before touching the schema, so the startup probe can report
+	// progress while migrations run.
+	logger.Info("Starting server", "port", cfg.Port)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	if cfg.AutoMigrate {
+		if _, err := migrator.Up(); err != nil {
+			return fmt.Errorf("failed to apply migrations: %w", err)
+		}
+	} else if err := migrator.Verify(); err != nil {
+		return fmt.Errorf("schema check failed (run \"migrate up\"): %w", err)
+	}
+
+	stopWorkers := make(chan struct{})
+	var workers sync.WaitGroup
+	workers.Add(3)
+	go func() {
+		defer workers.Done()
+		svc.RunAbsenceWorker(cfg.AbsenceInterval, stopWorkers)
+	}()
+	go func() {
+		defer workers.Done()
+		svc.RunIdempotencyCleanup(time.Hour, stopWorkers)
+	}()
+	go func() {
+		defer workers.Done()
+		svc.RunWebhookWorker(cfg.WebhookInterval, stopWorkers)
+	}()
+
+	probes.MarkStarted()
+	logger.Info("Server started")
+
+	select {
+	case err := <-serveErr:
+		close(stopWorkers)
+		workers.Wait()
+		return fmt.Errorf("server failed to start: %w", err)
+	case <-signals.Done():
+	}
+	// A second signal terminates without waiting for the drain.
+	stopSignals()
+	shutdown(cfg, server, probes, stopWorkers, &workers, logger)
+	return nil
+}
+
+// newTracer builds the tracer for cfg.TracingExporter; "none" returns nil,
+// which disables tracing.
+func newTracer(cfg *config.Config) (*tracing.Tracer, error) {
+	switch cfg.TracingExporter {
+	case "none":
+		return nil, nil
+	case "stdout":
+		return tracing.NewTracer(tracing.NewWriterExporter(os.Stdout)), nil
+	case "file":
+		file, err := os.OpenFile(cfg.TracingFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		return tracing.NewTracer(tracing.NewWriterExporter(file)), nil
+	case "otlp":
+		url := strings.TrimSuffix(cfg.OTLPEndpoint, "/") + "/v1/traces"
+		client := &http.Client{Timeout: 10 * time.Second}
+		return tracing.NewTracer(tracing.NewOTLPExporter(url, cfg.ServiceName, client)), nil
+	}
+	return nil, fmt.Errorf("unknown TRACING_EXPORTER %q", cfg.TracingExporter)
+}
+
+// observeQueries traces every Store call as a child of the request's span,
+// exports its duration and the errors other than a missing row, and logs each
+// call at debug level and failures at warn.
+func observeQueries(reg *metrics.Registry, logger *slog.Logger) database.Observer {
+	duration := reg.Histogram("pr_review_db_query_duration_seconds",
+		"Duration of database calls by repository method.", metrics.DefaultBuckets, "method")
+	errors := reg.Counter("pr_review_db_errors_total", "Failed database calls by repository method.", "method")
+
+	return func(ctx context.Context, method string) (context.Context, func(error)) {
+		start := time.Now()
+		ctx, span := tracing.Start(ctx, "db."+method)
+		span.SetAttr("db.system", "postgresql")
+		span.SetAttr("db.operation", method)
 
-	fmt.Printf("Starting server on port %s\n", cfg.Port)
-	if err := http.ListenAndServe(":"+cfg.Port, mux); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+		return ctx, func(err error) {
+			defer span.End()
+			elapsed := time.Since(start)
+			ms := float64(elapsed.Microseconds()) / 1000
+			duration.Observe(elapsed.Seconds(), method)
+			if err != nil && err != sql.ErrNoRows {
+				span.SetError(err)
+				errors.Inc(method)
+				logger.WarnContext(ctx, "database call failed", "method", method, "duration_ms", ms, "error", err)
+				return
+			}
+			logger.DebugContext(ctx, "database call", "method", method, "duration_ms", ms)
+		}
 	}
 }
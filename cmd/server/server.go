@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"pr-review-service/internal/config"
+	"pr-review-service/internal/health"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func newServer(cfg *config.Config, handler http.Handler, logger *slog.Logger) *http.Server {
+	return &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+}
+
+// shutdown turns readiness off, keeps serving for cfg.ShutdownDelay while the
+// load balancer takes the instance out, then stops accepting connections and
+// waits for in-flight requests and the background workers until
+// cfg.ShutdownTimeout. Connections still open after that are closed.
+func shutdown(
+	cfg *config.Config, server *http.Server, probes *health.Registry,
+	stopWorkers chan struct{}, workers *sync.WaitGroup, logger *slog.Logger,
+) {
+	logger.Info("Shutting down", "delay", cfg.ShutdownDelay.String(), "timeout", cfg.ShutdownTimeout.String())
+	probes.StartShutdown()
+	server.SetKeepAlivesEnabled(false)
+	time.Sleep(cfg.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	close(stopWorkers)
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Warn("Requests did not drain in time, closing connections", "error", err)
+		server.Close()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		logger.Info("Server stopped")
+	case <-ctx.Done():
+		logger.Warn("Background workers did not stop in time")
+	}
+}
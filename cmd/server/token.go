@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pr-review-service/internal/database"
+	"pr-review-service/internal/service"
+)
+
+const tokenUsage = "usage: pr-review-service token issue <name> <scope>..."
+
+// runToken implements the "token" subcommand, which issues the first admin
+// token before any exists to call /tokens/issue with.
+func runToken(databaseURL string, args []string) error {
+	if len(args) < 3 || args[0] != "issue" {
+		return errors.New(tokenUsage)
+	}
+
+	db, err := database.NewDB(databaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	issued, err := service.NewService(db, service.Options{}).IssueAPIToken(context.Background(), args[1], "", args[2:])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("issued token %d (%s)\n%s\n", issued.TokenID, issued.Name, issued.Token)
+	return nil
+}
@@ -1,24 +1,409 @@
+// Package config loads the service settings from built-in defaults, an
+// optional TOML file and environment variables, in increasing precedence,
+// and rejects invalid values at startup.
 package config
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"pr-review-service/internal/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// FileEnv names the config file when the -config flag is not given.
+const FileEnv = "CONFIG_FILE"
+
+const redacted = "REDACTED"
+
 type Config struct {
 	DatabaseURL string
-	Port        string
+	Port        int
+	AutoMigrate bool
+
+	// Database connection pool; zero MaxOpenConns means unlimited.
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBConnMaxIdleTime time.Duration
+
+	ReviewerStrategy      string
+	DefaultReviewersCount int
+	AbsenceInterval       time.Duration
+	IdempotencyTTL        time.Duration
+
+	// RequestTimeout bounds a whole HTTP request, QueryTimeout each
+	// repository call within it.
+	RequestTimeout time.Duration
+	QueryTimeout   time.Duration
+
+	// HTTP server limits. WriteTimeout has to leave room for RequestTimeout.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	MaxBodyBytes      int
+
+	// ShutdownDelay keeps serving after readiness turns off so the load
+	// balancer can notice; ShutdownTimeout then bounds the drain.
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+
+	WebhookInterval    time.Duration
+	WebhookMaxAttempts int
+	WebhookBackoff     time.Duration
+	WebhookTimeout     time.Duration
+
+	GitHubWebhookSecret string
+	GitLabWebhookToken  string
+
+	LogLevel string
+
+	// TracingExporter is none, stdout, file or otlp.
+	TracingExporter string
+	TracingFile     string
+	OTLPEndpoint    string
+	ServiceName     string
 }
 
-func Load() *Config {
+func Default() *Config {
 	return &Config{
-		DatabaseURL: getEnv("DATABASE_URL", "host=localhost user=postgres password=postgres dbname=pr_review sslmode=disable"),
-		Port:        getEnv("PORT", "8080"),
+		DatabaseURL: "host=localhost user=postgres password=postgres dbname=pr_review sslmode=disable",
+		Port:        8080,
+		AutoMigrate: true,
+
+		DBMaxOpenConns:    20,
+		DBMaxIdleConns:    10,
+		DBConnMaxLifetime: 30 * time.Minute,
+		DBConnMaxIdleTime: 5 * time.Minute,
+
+		ReviewerStrategy:      models.StrategyRandom,
+		DefaultReviewersCount: models.DefaultReviewersPerPR,
+		AbsenceInterval:       time.Minute,
+		IdempotencyTTL:        24 * time.Hour,
+
+		RequestTimeout: 30 * time.Second,
+		QueryTimeout:   10 * time.Second,
+
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      45 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    64 << 10,
+		MaxBodyBytes:      1 << 20,
+
+		ShutdownDelay:   5 * time.Second,
+		ShutdownTimeout: 20 * time.Second,
+
+		WebhookInterval:    5 * time.Second,
+		WebhookMaxAttempts: 8,
+		WebhookBackoff:     30 * time.Second,
+		WebhookTimeout:     10 * time.Second,
+
+		LogLevel: "info",
+
+		TracingExporter: "none",
+		TracingFile:     "traces.jsonl",
+		OTLPEndpoint:    "http://localhost:4318",
+		ServiceName:     "pr-review-service",
+	}
+}
+
+// Load starts from Default, applies the TOML file at path unless path is
+// empty, then every non-empty environment variable, and validates the
+// result. Unknown file keys and malformed values are errors, not ignored.
+func Load(path string) (*Config, error) {
+	return load(path, os.LookupEnv)
+}
+
+func load(path string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := parseTOML(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, e := range entries {
+			s := findSetting(settings, e.key)
+			if s == nil {
+				return nil, fmt.Errorf("%s: line %d: unknown key %s", path, e.line, e.key)
+			}
+			if err := s.setValue(e.value); err != nil {
+				return nil, fmt.Errorf("%s: line %d: %s: %w", path, e.line, e.key, err)
+			}
+		}
+	}
+
+	for i := range settings {
+		value, ok := lookupEnv(settings[i].env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := settings[i].setString(value); err != nil {
+			return nil, fmt.Errorf("%s: %w", settings[i].env, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every invalid setting at once, by file key.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(c.Port > 0 && c.Port <= 65535, "server.port", "must be between 1 and 65535, got %d", c.Port)
+	check(c.DatabaseURL != "", "database.url", "must be set")
+	check(c.DBMaxOpenConns >= 0, "database.max_open_conns", "must not be negative")
+	check(c.DBMaxIdleConns >= 0, "database.max_idle_conns", "must not be negative")
+	check(c.DBMaxOpenConns == 0 || c.DBMaxIdleConns <= c.DBMaxOpenConns, "database.max_idle_conns",
+		"must not exceed max_open_conns (%d)", c.DBMaxOpenConns)
+	check(models.ValidStrategy(c.ReviewerStrategy), "reviewers.strategy",
+		"must be %s or %s, got %q", models.StrategyRandom, models.StrategyLeastLoaded, c.ReviewerStrategy)
+	check(c.DefaultReviewersCount >= 1 && c.DefaultReviewersCount <= models.MaxReviewersPerPR,
+		"reviewers.default_count", "must be between 1 and %d", models.MaxReviewersPerPR)
+	check(c.WebhookMaxAttempts >= 1, "webhooks.max_attempts", "must be at least 1")
+	check(c.MaxHeaderBytes >= 0, "server.max_header_bytes", "must not be negative")
+	check(c.MaxBodyBytes >= 0, "server.max_body_bytes", "must not be negative")
+	check(c.RequestTimeout == 0 || c.WriteTimeout == 0 || c.WriteTimeout > c.RequestTimeout,
+		"server.write_timeout", "must be longer than request_timeout (%s)", c.RequestTimeout)
+	check(oneOf(c.LogLevel, "debug", "info", "warn", "error"), "logging.level",
+		"must be debug, info, warn or error, got %q", c.LogLevel)
+	check(oneOf(c.TracingExporter, "none", "stdout", "file", "otlp"), "tracing.exporter",
+		"must be none, stdout, file or otlp, got %q", c.TracingExporter)
+
+	for _, s := range c.settings() {
+		d, ok := s.value.(*time.Duration)
+		if !ok {
+			continue
+		}
+		if s.positive {
+			check(*d > 0, s.key, "must be positive")
+		} else {
+			check(*d >= 0, s.key, "must not be negative")
+		}
 	}
+	return errors.Join(errs...)
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// Print writes the configuration in the file format, with secrets and the
+// database password redacted, so the output can serve as a starting point
+// for a config file.
+func (c *Config) Print(w io.Writer) error {
+	var b strings.Builder
+	table := ""
+	for _, s := range c.settings() {
+		name, key, _ := strings.Cut(s.key, ".")
+		if name != table {
+			if table != "" {
+				b.WriteByte('\n')
+			}
+			fmt.Fprintf(&b, "[%s]\n", name)
+			table = name
+		}
+		fmt.Fprintf(&b, "%s = %s  # %s\n", key, s.format(), s.env)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// setting binds a file key and an environment variable to a Config field.
+type setting struct {
+	key string
+	env string
+	// value points at a string, int, bool or time.Duration field.
+	value interface{}
+	// positive durations may not be zero.
+	positive bool
+	redact   func(string) string
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{key: "server.port", env: "PORT", value: &c.Port},
+		{key: "server.request_timeout", env: "REQUEST_TIMEOUT", value: &c.RequestTimeout},
+		{key: "server.read_header_timeout", env: "HTTP_READ_HEADER_TIMEOUT", value: &c.ReadHeaderTimeout},
+		{key: "server.read_timeout", env: "HTTP_READ_TIMEOUT", value: &c.ReadTimeout},
+		{key: "server.write_timeout", env: "HTTP_WRITE_TIMEOUT", value: &c.WriteTimeout},
+		{key: "server.idle_timeout", env: "HTTP_IDLE_TIMEOUT", value: &c.IdleTimeout},
+		{key: "server.max_header_bytes", env: "HTTP_MAX_HEADER_BYTES", value: &c.MaxHeaderBytes},
+		{key: "server.max_body_bytes", env: "HTTP_MAX_BODY_BYTES", value: &c.MaxBodyBytes},
+		{key: "server.shutdown_delay", env: "SHUTDOWN_DELAY", value: &c.ShutdownDelay},
+		{key: "server.shutdown_timeout", env: "SHUTDOWN_TIMEOUT", value: &c.ShutdownTimeout},
+
+		{key: "database.url", env: "DATABASE_URL", value: &c.DatabaseURL, redact: redactDatabaseURL},
+		{key: "database.auto_migrate", env: "AUTO_MIGRATE", value: &c.AutoMigrate},
+		{key: "database.query_timeout", env: "QUERY_TIMEOUT", value: &c.QueryTimeout},
+		{key: "database.max_open_conns", env: "DB_MAX_OPEN_CONNS", value: &c.DBMaxOpenConns},
+		{key: "database.max_idle_conns", env: "DB_MAX_IDLE_CONNS", value: &c.DBMaxIdleConns},
+		{key: "database.conn_max_lifetime", env: "DB_CONN_MAX_LIFETIME", value: &c.DBConnMaxLifetime},
+		{key: "database.conn_max_idle_time", env: "DB_CONN_MAX_IDLE_TIME", value: &c.DBConnMaxIdleTime},
+
+		{key: "reviewers.strategy", env: "REVIEWER_STRATEGY", value: &c.ReviewerStrategy},
+		{key: "reviewers.default_count", env: "DEFAULT_REVIEWERS_COUNT", value: &c.DefaultReviewersCount},
+		{key: "reviewers.absence_check_interval", env: "ABSENCE_CHECK_INTERVAL", value: &c.AbsenceInterval,
+			positive: true},
+
+		{key: "idempotency.ttl", env: "IDEMPOTENCY_TTL", value: &c.IdempotencyTTL, positive: true},
+
+		{key: "auth.github_webhook_secret", env: "GITHUB_WEBHOOK_SECRET", value: &c.GitHubWebhookSecret,
+			redact: redactSecret},
+		{key: "auth.gitlab_webhook_token", env: "GITLAB_WEBHOOK_TOKEN", value: &c.GitLabWebhookToken,
+			redact: redactSecret},
+
+		{key: "webhooks.interval", env: "WEBHOOK_INTERVAL", value: &c.WebhookInterval, positive: true},
+		{key: "webhooks.max_attempts", env: "WEBHOOK_MAX_ATTEMPTS", value: &c.WebhookMaxAttempts},
+		{key: "webhooks.backoff", env: "WEBHOOK_BACKOFF", value: &c.WebhookBackoff, positive: true},
+		{key: "webhooks.timeout", env: "WEBHOOK_TIMEOUT", value: &c.WebhookTimeout, positive: true},
+
+		{key: "logging.level", env: "LOG_LEVEL", value: &c.LogLevel},
+
+		{key: "tracing.exporter", env: "TRACING_EXPORTER", value: &c.TracingExporter},
+		{key: "tracing.file", env: "TRACING_FILE", value: &c.TracingFile},
+		{key: "tracing.otlp_endpoint", env: "OTEL_EXPORTER_OTLP_ENDPOINT", value: &c.OTLPEndpoint},
+		{key: "tracing.service_name", env: "OTEL_SERVICE_NAME", value: &c.ServiceName},
+	}
+}
+
+func findSetting(settings []setting, key string) *setting {
+	for i := range settings {
+		if settings[i].key == key {
+			return &settings[i]
+		}
+	}
+	return nil
+}
+
+// setValue stores a value parsed from the file. Durations are written as
+// strings such as "30s".
+func (s *setting) setValue(value interface{}) error {
+	switch field := s.value.(type) {
+	case *string:
+		v, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %#v", value)
+		}
+		*field = v
+	case *int:
+		v, ok := value.(int64)
+		if !ok {
+			return fmt.Errorf("expected an integer, got %#v", value)
+		}
+		if int64(int(v)) != v {
+			return fmt.Errorf("%d is out of range", v)
+		}
+		*field = int(v)
+	case *bool:
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected true or false, got %#v", value)
+		}
+		*field = v
+	case *time.Duration:
+		v, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a duration string such as \"30s\", got %#v", value)
+		}
+		return s.setString(v)
+	}
+	return nil
+}
+
+// setString stores a value given as text, as environment variables are.
+func (s *setting) setString(value string) error {
+	switch field := s.value.(type) {
+	case *string:
+		*field = value
+	case *int:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*field = v
+	case *bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		*field = v
+	case *time.Duration:
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*field = v
+	}
+	return nil
+}
+
+func (s *setting) format() string {
+	switch field := s.value.(type) {
+	case *string:
+		if s.redact != nil {
+			return quoteTOML(s.redact(*field))
+		}
+		return quoteTOML(*field)
+	case *int:
+		return strconv.Itoa(*field)
+	case *bool:
+		return strconv.FormatBool(*field)
+	case *time.Duration:
+		return quoteTOML(field.String())
+	}
+	return ""
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSecret keeps an unset secret visible as "".
+func redactSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
+
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|[^\s]*)`)
+
+// redactDatabaseURL hides the password in both connection string forms
+// lib/pq accepts: a postgres:// URL and key=value pairs.
+func redactDatabaseURL(value string) string {
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		query := u.Query()
+		if query.Has("password") {
+			query.Set("password", redacted)
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
 	}
-	return defaultValue
+	return dsnPassword.ReplaceAllString(value, "${1}"+redacted)
 }
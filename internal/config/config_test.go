@@ -0,0 +1,171 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func envMap(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestLoadAppliesFileThenEnvironment(t *testing.T) {
+	path := writeFile(t, `
+# overrides for staging
+[server]
+port = 9_090
+request_timeout = "20s"   # shorter than the default
+
+[database]
+url = 'host=db user=svc password=p\w dbname=pr_review'
+max_open_conns = 40
+
+[reviewers]
+strategy = "least_loaded"
+default_count = 3
+
+[auth]
+github_webhook_secret = "from-file"
+`)
+	cfg, err := load(path, envMap(map[string]string{
+		"PORT":                  "7070",
+		"GITHUB_WEBHOOK_SECRET": "from-env",
+		"LOG_LEVEL":             "",
+	}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if cfg.Port != 7070 || cfg.GitHubWebhookSecret != "from-env" {
+		t.Fatalf("environment should win: port %d, secret %q", cfg.Port, cfg.GitHubWebhookSecret)
+	}
+	if cfg.RequestTimeout != 20*time.Second || cfg.DBMaxOpenConns != 40 || cfg.ReviewerStrategy != "least_loaded" ||
+		cfg.DefaultReviewersCount != 3 || cfg.DatabaseURL != `host=db user=svc password=p\w dbname=pr_review` {
+		t.Fatalf("file values not applied: %+v", cfg)
+	}
+	if cfg.LogLevel != "info" || cfg.QueryTimeout != 10*time.Second {
+		t.Fatalf("defaults lost: %+v", cfg)
+	}
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name, file string
+		env        map[string]string
+		want       string
+	}{
+		{name: "unknown key", file: "[server]\nprot = 80\n", want: "line 2: unknown key server.prot"},
+		{name: "unknown table", file: "[cache]\nsize = 1\n", want: "unknown key cache.size"},
+		{name: "wrong type", file: "[server]\nport = \"80\"\n", want: `server.port: expected an integer, got "80"`},
+		{name: "bad duration", file: "[server]\nidle_timeout = \"soon\"\n", want: `invalid duration "soon"`},
+		{name: "duplicate key", file: "[server]\nport = 1\nport = 2\n", want: "line 3: server.port already set on line 2"},
+		{name: "array", file: "[server]\nport = [1]\n", want: "unsupported value"},
+		{name: "trailing text", file: "[logging]\nlevel = \"info\" debug\n", want: "unexpected"},
+		{name: "bad env", env: map[string]string{"WEBHOOK_MAX_ATTEMPTS": "many"}, want: "WEBHOOK_MAX_ATTEMPTS"},
+		{
+			name: "several problems",
+			file: "[logging]\nlevel = \"loud\"\n[webhooks]\nbackoff = \"0s\"\n",
+			want: "logging.level: must be debug, info, warn or error, got \"loud\"\nwebhooks.backoff: must be positive",
+		},
+		{
+			name: "write timeout",
+			env:  map[string]string{"HTTP_WRITE_TIMEOUT": "10s"},
+			want: "server.write_timeout: must be longer than request_timeout (30s)",
+		},
+		{name: "strategy", env: map[string]string{"REVIEWER_STRATEGY": "alphabetical"}, want: "reviewers.strategy"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := ""
+			if tc.file != "" {
+				path = writeFile(t, tc.file)
+			}
+			_, err := load(path, envMap(tc.env))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want it to mention %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLStrings(t *testing.T) {
+	entries, err := parseTOML([]byte(`a = "tab\there \"quoted\" \u00e9 # not a comment"
+b = 'C:\path\'  # comment
+c = false
+d = -12`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{"tab\there \"quoted\" é # not a comment", `C:\path\`, false, int64(-12)}
+	for i, e := range entries {
+		if e.value != want[i] {
+			t.Errorf("%s = %#v, want %#v", e.key, e.value, want[i])
+		}
+	}
+}
+
+func TestPrintRedactsSecretsAndRoundTrips(t *testing.T) {
+	cfg, err := load("", envMap(map[string]string{
+		"DATABASE_URL":          "postgres://svc:hunter2@db:5432/pr_review?sslmode=disable",
+		"GITLAB_WEBHOOK_TOKEN":  "gl-token",
+		"GITHUB_WEBHOOK_SECRET": "",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := cfg.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	printed := out.String()
+	if strings.Contains(printed, "hunter2") || strings.Contains(printed, "gl-token") {
+		t.Fatalf("secret leaked:\n%s", printed)
+	}
+	for _, line := range []string{
+		`url = "postgres://svc:REDACTED@db:5432/pr_review?sslmode=disable"  # DATABASE_URL`,
+		`gitlab_webhook_token = "REDACTED"  # GITLAB_WEBHOOK_TOKEN`,
+		`github_webhook_secret = ""  # GITHUB_WEBHOOK_SECRET`,
+		`max_open_conns = 20  # DB_MAX_OPEN_CONNS`,
+	} {
+		if !strings.Contains(printed, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, printed)
+		}
+	}
+
+	reloaded, err := load(writeFile(t, printed), envMap(nil))
+	if err != nil {
+		t.Fatalf("printed config does not load back: %v", err)
+	}
+	if reloaded.RequestTimeout != cfg.RequestTimeout || reloaded.IdleTimeout != cfg.IdleTimeout {
+		t.Fatalf("durations changed on reload: %+v", reloaded)
+	}
+}
+
+func TestRedactDatabaseURL(t *testing.T) {
+	for in, want := range map[string]string{
+		"host=db user=svc password=secret dbname=x":  "host=db user=svc password=REDACTED dbname=x",
+		"host=db password = 'a b\\' c' dbname=x":     "host=db password = REDACTED dbname=x",
+		"postgres://svc@db/x?password=secret":        "postgres://svc@db/x?password=REDACTED",
+		"postgres://svc:p%40ss@db:5432/x":            "postgres://svc:REDACTED@db:5432/x",
+		"host=localhost dbname=pr_review sslmode=no": "host=localhost dbname=pr_review sslmode=no",
+	} {
+		if got := redactDatabaseURL(in); got != want {
+			t.Errorf("redactDatabaseURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
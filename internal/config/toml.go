@@ -0,0 +1,201 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// entry is one key of a config file, named "table.key".
+type entry struct {
+	key   string
+	value interface{} // string, int64 or bool
+	line  int
+}
+
+// parseTOML reads the subset of TOML a flat config needs: [table] headers,
+// key = value pairs, basic and literal strings, integers, booleans and
+// comments. Anything else, such as arrays, floats or dotted keys, is an
+// error rather than silently ignored.
+func parseTOML(data []byte) ([]entry, error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("file is not valid UTF-8")
+	}
+
+	var entries []entry
+	seen := make(map[string]int)
+	tables := make(map[string]bool)
+	table := ""
+	for i, raw := range strings.Split(string(data), "\n") {
+		line := i + 1
+		text := strings.TrimSpace(strings.TrimSuffix(raw, "\r"))
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		if text[0] == '[' {
+			name, rest, ok := strings.Cut(text[1:], "]")
+			name = strings.TrimSpace(name)
+			if !ok || !isBareKey(name) || !isComment(rest) {
+				return nil, fmt.Errorf("line %d: invalid table header %q", line, text)
+			}
+			if tables[name] {
+				return nil, fmt.Errorf("line %d: table [%s] defined twice", line, name)
+			}
+			tables[name] = true
+			table = name
+			continue
+		}
+
+		name, rest, ok := strings.Cut(text, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !isBareKey(name) {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", line, text)
+		}
+		value, rest, err := parseValue(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", line, name, err)
+		}
+		if !isComment(rest) {
+			return nil, fmt.Errorf("line %d: unexpected %q after value", line, strings.TrimSpace(rest))
+		}
+
+		key := name
+		if table != "" {
+			key = table + "." + name
+		}
+		if first, ok := seen[key]; ok {
+			return nil, fmt.Errorf("line %d: %s already set on line %d", line, key, first)
+		}
+		seen[key] = line
+		entries = append(entries, entry{key: key, value: value, line: line})
+	}
+	return entries, nil
+}
+
+// parseValue parses the value at the start of s and returns what follows it.
+func parseValue(s string) (interface{}, string, error) {
+	switch {
+	case s == "":
+		return nil, "", fmt.Errorf("missing value")
+	case s[0] == '"':
+		return parseBasicString(s)
+	case s[0] == '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+
+	token, rest := s, ""
+	if i := strings.IndexAny(s, " \t#"); i >= 0 {
+		token, rest = s[:i], s[i:]
+	}
+	switch token {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	if strings.HasPrefix(token, "_") || strings.HasSuffix(token, "_") || strings.Contains(token, "__") {
+		return nil, "", fmt.Errorf("invalid value %q", token)
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(token, "_", ""), 10, 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("unsupported value %q (use a quoted string, an integer or a boolean)", token)
+	}
+	return n, rest, nil
+}
+
+func parseBasicString(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			return b.String(), s[i+1:], nil
+		case c == '\\':
+			if i+1 >= len(s) {
+				return "", "", fmt.Errorf("unterminated string")
+			}
+			i++
+			switch s[i] {
+			case '"', '\\':
+				b.WriteByte(s[i])
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'u', 'U':
+				size := 4
+				if s[i] == 'U' {
+					size = 8
+				}
+				if i+size >= len(s) {
+					return "", "", fmt.Errorf("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(r)) {
+					return "", "", fmt.Errorf("invalid unicode escape")
+				}
+				b.WriteRune(rune(r))
+				i += size
+			default:
+				return "", "", fmt.Errorf("invalid escape \\%c", s[i])
+			}
+		case c < 0x20 && c != '\t':
+			return "", "", fmt.Errorf("control character in string")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+func isBareKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// isComment reports whether rest is empty apart from whitespace and a
+// trailing comment.
+func isComment(rest string) bool {
+	rest = strings.TrimSpace(rest)
+	return rest == "" || rest[0] == '#'
+}
+
+// quoteTOML formats s as a basic string.
+func quoteTOML(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"pr-review-service/internal/models"
+	"time"
+)
+
+// availableUserClause filters out users with an absence window covering now.
+const availableUserClause = `NOT EXISTS (
+	SELECT 1 FROM user_absences a
+	WHERE a.user_id = users.user_id
+		AND a.cancelled_at IS NULL
+		AND a.starts_at <= NOW() AND a.ends_at > NOW()
+)`
+
+func (db *DB) CreateAbsence(ctx context.Context, absence *models.Absence, audit models.Audit) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO user_absences (user_id, starts_at, ends_at, reason, auto_reassign)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING absence_id
+	`, absence.UserID, absence.StartsAt, absence.EndsAt, absence.Reason, absence.AutoReassign).Scan(&absence.AbsenceID)
+	if err != nil {
+		return translateError(err)
+	}
+
+	var teamName string
+	err = tx.QueryRowContext(ctx, `SELECT team_name FROM users WHERE user_id = $1`, absence.UserID).Scan(&teamName)
+	if err != nil {
+		return err
+	}
+	event := absenceEvent(audit, models.EventAbsenceCreated, teamName, absence)
+	if err := insertEvents(ctx, tx, []models.Event{event}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) GetAbsence(ctx context.Context, absenceID int64) (*models.Absence, error) {
+	row := db.QueryRowContext(ctx, `
+		SELECT absence_id, user_id, starts_at, ends_at, reason, auto_reassign, reassigned_at, cancelled_at
+		FROM user_absences
+		WHERE absence_id = $1
+	`, absenceID)
+	return scanAbsence(row)
+}
+
+func (db *DB) GetUserAbsences(ctx context.Context, userID string) ([]models.Absence, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT absence_id, user_id, starts_at, ends_at, reason, auto_reassign, reassigned_at, cancelled_at
+		FROM user_absences
+		WHERE user_id = $1
+		ORDER BY starts_at, absence_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	absences := []models.Absence{}
+	for rows.Next() {
+		absence, err := scanAbsence(rows)
+		if err != nil {
+			return nil, err
+		}
+		absences = append(absences, *absence)
+	}
+
+	return absences, rows.Err()
+}
+
+// CancelAbsence cancels the absence and records it; an absence that is
+// already cancelled is left as it is.
+func (db *DB) CancelAbsence(ctx context.Context, absenceID int64, audit models.Audit) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	absence := &models.Absence{AbsenceID: absenceID}
+	var teamName string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE user_absences a
+		SET cancelled_at = $1
+		FROM users u
+		WHERE a.absence_id = $2 AND a.cancelled_at IS NULL AND u.user_id = a.user_id
+		RETURNING a.user_id, u.team_name, a.starts_at, a.ends_at, a.auto_reassign
+	`, time.Now(), absenceID).Scan(&absence.UserID, &teamName, &absence.StartsAt, &absence.EndsAt, &absence.AutoReassign)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	event := absenceEvent(audit, models.EventAbsenceCancelled, teamName, absence)
+	if err := insertEvents(ctx, tx, []models.Event{event}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetStartedAbsencesToReassign returns current absences that asked for
+// auto-reassignment and have not been processed yet.
+func (db *DB) GetStartedAbsencesToReassign(ctx context.Context) ([]models.Absence, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT absence_id, user_id, starts_at, ends_at, reason, auto_reassign, reassigned_at, cancelled_at
+		FROM user_absences
+		WHERE auto_reassign AND reassigned_at IS NULL AND cancelled_at IS NULL
+			AND starts_at <= NOW() AND ends_at > NOW()
+		ORDER BY starts_at, absence_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var absences []models.Absence
+	for rows.Next() {
+		absence, err := scanAbsence(rows)
+		if err != nil {
+			return nil, err
+		}
+		absences = append(absences, *absence)
+	}
+
+	return absences, rows.Err()
+}
+
+func (db *DB) MarkAbsenceReassigned(ctx context.Context, absenceID int64) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE user_absences
+		SET reassigned_at = $1
+		WHERE absence_id = $2
+	`, time.Now(), absenceID)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAbsence(row rowScanner) (*models.Absence, error) {
+	absence := &models.Absence{}
+	var reassignedAt, cancelledAt sql.NullTime
+	err := row.Scan(
+		&absence.AbsenceID,
+		&absence.UserID,
+		&absence.StartsAt,
+		&absence.EndsAt,
+		&absence.Reason,
+		&absence.AutoReassign,
+		&reassignedAt,
+		&cancelledAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if reassignedAt.Valid {
+		absence.ReassignedAt = &reassignedAt.Time
+	}
+	if cancelledAt.Valid {
+		absence.CancelledAt = &cancelledAt.Time
+	}
+	return absence, nil
+}
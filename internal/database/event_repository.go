@@ -0,0 +1,286 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"pr-review-service/internal/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func newEvent(audit models.Audit, eventType string) models.Event {
+	return models.Event{Type: eventType, Actor: audit.Actor}
+}
+
+func prEvent(audit models.Audit, eventType, prID string) models.Event {
+	event := newEvent(audit, eventType)
+	event.PullRequestID = prID
+	return event
+}
+
+func reviewerEvents(audit models.Audit, eventType, prID string, reviewerIDs []string) []models.Event {
+	events := make([]models.Event, 0, len(reviewerIDs))
+	for _, reviewerID := range reviewerIDs {
+		event := prEvent(audit, eventType, prID)
+		event.UserID = reviewerID
+		event.Reason = audit.Reason
+		events = append(events, event)
+	}
+	return events
+}
+
+func reassignEvents(audit models.Audit, prID, oldReviewerID, newReviewerID string) []models.Event {
+	removed := reviewerEvents(audit, models.EventReviewerUnassigned, prID, []string{oldReviewerID})[0]
+	removed.Details = map[string]string{"replaced_by": newReviewerID}
+	added := reviewerEvents(audit, models.EventReviewerAssigned, prID, []string{newReviewerID})[0]
+	added.Details = map[string]string{"replaces": oldReviewerID}
+	return []models.Event{removed, added}
+}
+
+func prCreatedEvents(audit models.Audit, prID, prName string, isDraft bool, reviewers []string) []models.Event {
+	created := prEvent(audit, models.EventPRCreated, prID)
+	created.Details = map[string]string{"name": prName, "is_draft": strconv.FormatBool(isDraft)}
+	return append([]models.Event{created}, reviewerEvents(audit, models.EventReviewerAssigned, prID, reviewers)...)
+}
+
+func readyEvents(audit models.Audit, prID string, reviewers []string) []models.Event {
+	ready := prEvent(audit, models.EventPRReady, prID)
+	return append([]models.Event{ready}, reviewerEvents(audit, models.EventReviewerAssigned, prID, reviewers)...)
+}
+
+func reopenEvents(audit models.Audit, prID string, removed, added []string) []models.Event {
+	events := []models.Event{prEvent(audit, models.EventPRReopened, prID)}
+	events = append(events, reviewerEvents(audit, models.EventReviewerUnassigned, prID, removed)...)
+	return append(events, reviewerEvents(audit, models.EventReviewerAssigned, prID, added)...)
+}
+
+func reviewEvent(audit models.Audit, prID, reviewerID, state string) models.Event {
+	event := prEvent(audit, models.EventReviewSubmitted, prID)
+	event.UserID = reviewerID
+	event.Details = map[string]string{"state": state}
+	return event
+}
+
+func teamEvent(audit models.Audit, eventType, teamName string, details map[string]string) models.Event {
+	event := newEvent(audit, eventType)
+	event.TeamName = teamName
+	event.Details = details
+	return event
+}
+
+// teamCreatedEvent describes CreateTeam; adding members to an existing team is
+// recorded as an update.
+func teamCreatedEvent(audit models.Audit, team *models.Team) models.Event {
+	members := make([]string, 0, len(team.Members))
+	for _, member := range team.Members {
+		members = append(members, member.UserID)
+	}
+
+	eventType := models.EventTeamCreated
+	if team.Version > 1 {
+		eventType = models.EventTeamUpdated
+	}
+	return teamEvent(audit, eventType, team.TeamName, map[string]string{"members": strings.Join(members, ",")})
+}
+
+// membersRemovedEvents records, for every team that CreateTeam took members
+// from, which of its users moved away.
+func membersRemovedEvents(audit models.Audit, moved map[string][]string) []models.Event {
+	teamNames := make([]string, 0, len(moved))
+	for teamName := range moved {
+		teamNames = append(teamNames, teamName)
+	}
+	sort.Strings(teamNames)
+
+	events := make([]models.Event, 0, len(teamNames))
+	for _, teamName := range teamNames {
+		details := map[string]string{"members_removed": strings.Join(moved[teamName], ",")}
+		events = append(events, teamEvent(audit, models.EventTeamUpdated, teamName, details))
+	}
+	return events
+}
+
+func mergePolicyEvent(audit models.Audit, policy *models.MergePolicy) models.Event {
+	return teamEvent(audit, models.EventTeamUpdated, policy.TeamName, map[string]string{
+		"min_approvals":              strconv.Itoa(policy.MinApprovals),
+		"block_on_changes_requested": strconv.FormatBool(policy.BlockOnChangesRequested),
+		"forbid_author_self_merge":   strconv.FormatBool(policy.ForbidAuthorSelfMerge),
+	})
+}
+
+func userEvent(audit models.Audit, eventType, userID, teamName string, details map[string]string) models.Event {
+	event := teamEvent(audit, eventType, teamName, details)
+	event.UserID = userID
+	return event
+}
+
+func absenceEvent(audit models.Audit, eventType, teamName string, absence *models.Absence) models.Event {
+	return userEvent(audit, eventType, absence.UserID, teamName, map[string]string{
+		"absence_id":    strconv.FormatInt(absence.AbsenceID, 10),
+		"starts_at":     absence.StartsAt.UTC().Format(time.RFC3339),
+		"ends_at":       absence.EndsAt.UTC().Format(time.RFC3339),
+		"auto_reassign": strconv.FormatBool(absence.AutoReassign),
+	})
+}
+
+func activationEventType(isActive bool) string {
+	if isActive {
+		return models.EventUserActivated
+	}
+	return models.EventUserDeactivated
+}
+
+func insertEvents(ctx context.Context, tx *sql.Tx, events []models.Event) error {
+	for _, event := range events {
+		details, err := json.Marshal(event.Details)
+		if err != nil {
+			return err
+		}
+		if event.Details == nil {
+			details = []byte("{}")
+		}
+
+		var eventID int64
+		row := tx.QueryRowContext(ctx, `
+			INSERT INTO events (event_type, actor, pull_request_id, user_id, team_name, reason, details)
+			VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7)
+			RETURNING event_id
+		`, event.Type, event.Actor, event.PullRequestID, event.UserID, event.TeamName, event.Reason, details)
+		if err := row.Scan(&eventID); err != nil {
+			return err
+		}
+
+		// Deliveries are queued with the event so a subscriber never misses a
+		// committed change and never hears about a rolled back one.
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO webhook_deliveries (webhook_id, event_id)
+			SELECT webhook_id, $1 FROM webhooks WHERE $2 = ANY(event_types)
+		`, eventID, event.Type)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) ListEvents(ctx context.Context, filter models.EventFilter) ([]models.Event, error) {
+	var where whereClause
+	where.add("event_id > ?", filter.AfterID)
+	if filter.Actor != "" {
+		where.add("actor = ?", filter.Actor)
+	}
+	if filter.PullRequestID != "" {
+		where.add("pull_request_id = ?", filter.PullRequestID)
+	}
+	if filter.UserID != "" {
+		where.add("user_id = ?", filter.UserID)
+	}
+	if filter.TeamName != "" {
+		where.add("team_name = ?", filter.TeamName)
+	}
+	if filter.Type != "" {
+		where.add("event_type = ?", filter.Type)
+	}
+	if filter.Since != nil {
+		where.add("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		where.add("created_at < ?", *filter.Until)
+	}
+
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events
+		WHERE ` + where.String() + `
+		ORDER BY event_id`
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := db.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.Event{}
+	for rows.Next() {
+		var event models.Event
+		if err := scanEvent(rows, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// whereClause collects AND-ed conditions with "?" placeholders numbered as
+// they are added.
+type whereClause struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (w *whereClause) add(condition string, arg interface{}) {
+	w.args = append(w.args, arg)
+	w.conditions = append(w.conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(w.args))))
+}
+
+func (w *whereClause) String() string {
+	if len(w.conditions) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(w.conditions, " AND ")
+}
+
+const eventColumns = `events.event_id, events.event_type, events.actor, COALESCE(events.pull_request_id, ''),
+	COALESCE(events.user_id, ''), COALESCE(events.team_name, ''), events.reason, events.details, events.created_at`
+
+// scanEvent reads eventColumns; extra destinations are scanned after them.
+func scanEvent(row rowScanner, event *models.Event, extra ...interface{}) error {
+	var details []byte
+	dest := []interface{}{
+		&event.EventID, &event.Type, &event.Actor, &event.PullRequestID, &event.UserID,
+		&event.TeamName, &event.Reason, &details, &event.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(details, &event.Details); err != nil {
+		return err
+	}
+	if len(event.Details) == 0 {
+		event.Details = nil
+	}
+	return nil
+}
+
+// updateWithEvents runs a single-row versioned UPDATE and records its events
+// in the same transaction.
+func (db *DB) updateWithEvents(ctx context.Context, events []models.Event, query string, args ...interface{}) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return translateError(err)
+	}
+	if err := expectRow(result); err != nil {
+		return err
+	}
+
+	if err := insertEvents(ctx, tx, events); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"pr-review-service/internal/models"
+)
+
+// ReserveIdempotencyKey stores a pending record for the key. It reports false
+// when an unexpired record already holds the key; an expired one is replaced.
+func (db *DB) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (bool, error) {
+	result, err := db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (idempotency_key, request_hash, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (idempotency_key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash,
+			status_code = 0,
+			response_etag = '',
+			response_body = NULL,
+			created_at = NOW(),
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= NOW()
+	`, record.Key, record.RequestHash, record.ExpiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (db *DB) GetIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+	record := &models.IdempotencyRecord{Key: key}
+	err := db.QueryRowContext(ctx, `
+		SELECT request_hash, status_code, response_etag, COALESCE(response_body, ''::bytea), created_at, expires_at
+		FROM idempotency_keys
+		WHERE idempotency_key = $1 AND expires_at > NOW()
+	`, key).Scan(
+		&record.RequestHash, &record.StatusCode, &record.ETag, &record.Body, &record.CreatedAt, &record.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (db *DB) CompleteIdempotencyKey(
+	ctx context.Context, key string, statusCode int, etag string, body []byte,
+) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = $1, response_etag = $2, response_body = $3
+		WHERE idempotency_key = $4
+	`, statusCode, etag, body, key)
+	return err
+}
+
+func (db *DB) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE idempotency_key = $1`, key)
+	return err
+}
+
+func (db *DB) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	result, err := db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
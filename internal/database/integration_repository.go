@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"pr-review-service/internal/models"
+)
+
+func (db *DB) SetExternalAccount(ctx context.Context, account *models.ExternalAccount) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO external_accounts (provider, login, user_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (provider, login) DO UPDATE SET user_id = EXCLUDED.user_id
+	`, account.Provider, account.Login, account.UserID)
+	return translateError(err)
+}
+
+// GetExternalAccountUser returns the user mapped to login, or sql.ErrNoRows.
+func (db *DB) GetExternalAccountUser(ctx context.Context, provider, login string) (string, error) {
+	var userID string
+	err := db.QueryRowContext(ctx, `
+		SELECT user_id FROM external_accounts WHERE provider = $1 AND login = $2
+	`, provider, login).Scan(&userID)
+	return userID, err
+}
+
+func (db *DB) ListExternalAccounts(ctx context.Context, provider string) ([]models.ExternalAccount, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT provider, login, user_id
+		FROM external_accounts
+		WHERE $1 = '' OR provider = $1
+		ORDER BY provider, login
+	`, provider)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []models.ExternalAccount{}
+	for rows.Next() {
+		var account models.ExternalAccount
+		if err := rows.Scan(&account.Provider, &account.Login, &account.UserID); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, rows.Err()
+}
+
+func (db *DB) CreateRejectedEvent(ctx context.Context, event *models.RejectedEvent) error {
+	return db.QueryRowContext(ctx, `
+		INSERT INTO rejected_events (provider, event_type, action, login, pull_request_id, reason, payload)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING rejected_id, created_at
+	`, event.Provider, event.EventType, event.Action, event.Login, event.PullRequestID, event.Reason,
+		[]byte(event.Payload)).Scan(&event.RejectedID, &event.CreatedAt)
+}
+
+// ListRejectedEvents returns rejected events, newest first.
+func (db *DB) ListRejectedEvents(ctx context.Context, provider string, limit int) ([]models.RejectedEvent, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT rejected_id, provider, event_type, action, login, pull_request_id, reason, payload, created_at
+		FROM rejected_events
+		WHERE $1 = '' OR provider = $1
+		ORDER BY rejected_id DESC
+		LIMIT $2
+	`, provider, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.RejectedEvent{}
+	for rows.Next() {
+		var event models.RejectedEvent
+		var payload []byte
+		err := rows.Scan(
+			&event.RejectedID, &event.Provider, &event.EventType, &event.Action, &event.Login,
+			&event.PullRequestID, &event.Reason, &payload, &event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,1497 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"pr-review-service/internal/models"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a thread-safe in-memory Store with the same semantics as the
+// PostgreSQL implementation. It is meant for tests and local experiments.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	teams         map[string]*memTeam
+	users         map[string]*models.User
+	prs           map[string]*models.PullRequest
+	reviews       map[string]map[string]*models.Review
+	policies      map[string]models.MergePolicy
+	absences      map[int64]*models.Absence
+	nextAbsenceID int64
+	idempotency   map[string]*models.IdempotencyRecord
+	events        []models.Event
+	webhooks      map[int64]*models.Webhook
+	nextWebhookID int64
+	deliveries    []*memDelivery
+	nextDelivery  int64
+	accounts      map[accountKey]string
+	rejected      []models.RejectedEvent
+	tokens        []*memToken
+}
+
+type memToken struct {
+	token models.APIToken
+	hash  string
+}
+
+type accountKey struct {
+	provider string
+	login    string
+}
+
+type memDelivery struct {
+	delivery      models.WebhookDelivery
+	nextAttemptAt time.Time
+}
+
+type memTeam struct {
+	reviewerStrategy string
+	defaultReviewers int
+	capacityFallback string
+	version          int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		teams:       make(map[string]*memTeam),
+		users:       make(map[string]*models.User),
+		prs:         make(map[string]*models.PullRequest),
+		reviews:     make(map[string]map[string]*models.Review),
+		policies:    make(map[string]models.MergePolicy),
+		absences:    make(map[int64]*models.Absence),
+		idempotency: make(map[string]*models.IdempotencyRecord),
+		webhooks:    make(map[int64]*models.Webhook),
+		accounts:    make(map[accountKey]string),
+	}
+}
+
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *MemoryStore) GetTeam(ctx context.Context, teamName string) (*models.Team, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	team := &models.Team{TeamName: teamName}
+	for _, user := range m.sortedUsers() {
+		if user.TeamName == teamName {
+			team.Members = append(team.Members, models.TeamMember{
+				UserID:   user.UserID,
+				Username: user.Username,
+				IsActive: user.IsActive,
+				Role:     user.Role,
+			})
+		}
+	}
+
+	if len(team.Members) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	if settings, ok := m.teams[teamName]; ok {
+		team.ReviewerStrategy = settings.reviewerStrategy
+		team.DefaultReviewers = settings.defaultReviewers
+		team.CapacityFallback = settings.capacityFallback
+		team.Version = settings.version
+	}
+
+	return team, nil
+}
+
+func (m *MemoryStore) TeamExists(ctx context.Context, teamName string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.teams[teamName]
+	return ok, nil
+}
+
+func (m *MemoryStore) CreateTeam(ctx context.Context, team *models.Team, audit models.Audit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.teams[team.TeamName]; ok {
+		existing.version++
+	} else {
+		m.teams[team.TeamName] = &memTeam{
+			reviewerStrategy: team.ReviewerStrategy,
+			defaultReviewers: team.DefaultReviewers,
+			capacityFallback: team.CapacityFallback,
+			version:          1,
+		}
+	}
+	team.Version = m.teams[team.TeamName].version
+
+	moved := make(map[string][]string)
+	for _, member := range team.Members {
+		user, ok := m.users[member.UserID]
+		if !ok {
+			user = &models.User{UserID: member.UserID, Role: models.RoleMember}
+			m.users[member.UserID] = user
+		} else if user.TeamName != team.TeamName {
+			moved[user.TeamName] = append(moved[user.TeamName], user.UserID)
+		}
+		user.Version++
+		user.Username = member.Username
+		user.TeamName = team.TeamName
+		user.IsActive = member.IsActive
+		if member.Role != "" {
+			user.Role = member.Role
+		}
+	}
+
+	for teamName, userIDs := range moved {
+		if old, ok := m.teams[teamName]; ok {
+			old.version++
+		}
+		sort.Strings(userIDs)
+	}
+	m.appendEvents(append([]models.Event{teamCreatedEvent(audit, team)}, membersRemovedEvents(audit, moved)...)...)
+	return nil
+}
+
+func (m *MemoryStore) GetTeamReviewerStrategy(ctx context.Context, teamName string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if team, ok := m.teams[teamName]; ok {
+		return team.reviewerStrategy, nil
+	}
+	return "", nil
+}
+
+func (m *MemoryStore) SetTeamReviewerStrategy(
+	ctx context.Context, teamName, strategy string, version int64, audit models.Audit,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	team, err := m.claimTeam(teamName, version)
+	if err != nil {
+		return err
+	}
+	team.reviewerStrategy = strategy
+	m.appendEvents(teamEvent(audit, models.EventTeamUpdated, teamName, map[string]string{"reviewer_strategy": strategy}))
+	return nil
+}
+
+func (m *MemoryStore) GetTeamDefaultReviewers(ctx context.Context, teamName string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if team, ok := m.teams[teamName]; ok {
+		return team.defaultReviewers, nil
+	}
+	return 0, nil
+}
+
+func (m *MemoryStore) SetTeamDefaultReviewers(
+	ctx context.Context, teamName string, count int, version int64, audit models.Audit,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	team, err := m.claimTeam(teamName, version)
+	if err != nil {
+		return err
+	}
+	team.defaultReviewers = count
+	m.appendEvents(teamEvent(audit, models.EventTeamUpdated, teamName,
+		map[string]string{"default_reviewers": strconv.Itoa(count)}))
+	return nil
+}
+
+func (m *MemoryStore) GetTeamCapacityFallback(ctx context.Context, teamName string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if team, ok := m.teams[teamName]; ok {
+		return team.capacityFallback, nil
+	}
+	return "", nil
+}
+
+func (m *MemoryStore) SetTeamCapacityFallback(
+	ctx context.Context, teamName, fallback string, version int64, audit models.Audit,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	team, err := m.claimTeam(teamName, version)
+	if err != nil {
+		return err
+	}
+	team.capacityFallback = fallback
+	m.appendEvents(teamEvent(audit, models.EventTeamUpdated, teamName, map[string]string{"capacity_fallback": fallback}))
+	return nil
+}
+
+func (m *MemoryStore) BulkDeactivateTeamUsers(
+	ctx context.Context, teamName string, version int64, audit models.Audit,
+) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.claimTeam(teamName, version); err != nil {
+		return nil, err
+	}
+
+	var userIDs []string
+	for _, user := range m.sortedUsers() {
+		if user.TeamName == teamName && user.IsActive {
+			user.IsActive = false
+			user.Version++
+			userIDs = append(userIDs, user.UserID)
+			m.appendEvents(userEvent(audit, models.EventUserDeactivated, user.UserID, teamName, nil))
+		}
+	}
+
+	return userIDs, nil
+}
+
+func (m *MemoryStore) GetOpenPRsWithReviewers(ctx context.Context, userIDs []string) ([]models.PullRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var prs []models.PullRequest
+	targets := toSet(userIDs)
+
+	for prID, pr := range m.prs {
+		if pr.Status != models.StatusOpen {
+			continue
+		}
+
+		reviewers := m.sortedReviewerIDs(prID)
+		for _, reviewerID := range reviewers {
+			if targets[reviewerID] {
+				prs = append(prs, models.PullRequest{
+					PullRequestID:     prID,
+					AuthorID:          pr.AuthorID,
+					AssignedReviewers: reviewers,
+					Version:           pr.Version,
+				})
+				break
+			}
+		}
+	}
+
+	sort.Slice(prs, func(i, j int) bool { return prs[i].PullRequestID < prs[j].PullRequestID })
+	return prs, nil
+}
+
+func (m *MemoryStore) GetActiveTeamMembersForReplacement(
+	ctx context.Context, teamName string, excludeUserIDs []string,
+) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.availableMembers(teamName, toSet(excludeUserIDs)), nil
+}
+
+func (m *MemoryStore) BulkReassignReviewers(
+	ctx context.Context, plans map[string]models.ReviewerPlan, audit models.Audit,
+) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, plan := range plans {
+		for _, newReviewerID := range plan.Replacements {
+			if _, ok := m.users[newReviewerID]; !ok {
+				return nil, fmt.Errorf("%w: reviewer %s", ErrForeignKeyViolation, newReviewerID)
+			}
+		}
+	}
+
+	var reassignedPRs []string
+	for prID, plan := range plans {
+		pr, ok := m.prs[prID]
+		if !ok || pr.Status != models.StatusOpen || pr.Version != plan.Version {
+			continue
+		}
+		pr.Version++
+		for oldReviewerID, newReviewerID := range plan.Replacements {
+			if reviewers, ok := m.reviews[prID]; ok {
+				delete(reviewers, oldReviewerID)
+				if _, exists := reviewers[newReviewerID]; !exists {
+					reviewers[newReviewerID] = newReview(newReviewerID)
+				}
+			}
+			m.appendEvents(reassignEvents(audit, prID, oldReviewerID, newReviewerID)...)
+		}
+		reassignedPRs = append(reassignedPRs, prID)
+	}
+
+	return reassignedPRs, nil
+}
+
+func (m *MemoryStore) GetTeamNameForUsers(ctx context.Context, userIDs []string) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	userTeams := make(map[string]string)
+	for _, userID := range userIDs {
+		if user, ok := m.users[userID]; ok {
+			userTeams[userID] = user.TeamName
+		}
+	}
+
+	return userTeams, nil
+}
+
+func (m *MemoryStore) GetMergePolicy(ctx context.Context, teamName string) (*models.MergePolicy, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	policy, ok := m.policies[teamName]
+	if !ok {
+		policy = models.MergePolicy{TeamName: teamName}
+	}
+	if team, ok := m.teams[teamName]; ok {
+		policy.Version = team.version
+	}
+	return &policy, nil
+}
+
+func (m *MemoryStore) SetMergePolicy(
+	ctx context.Context, policy *models.MergePolicy, version int64, audit models.Audit,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.claimTeam(policy.TeamName, version); err != nil {
+		return err
+	}
+
+	m.policies[policy.TeamName] = *policy
+	m.appendEvents(mergePolicyEvent(audit, policy))
+	return nil
+}
+
+func (m *MemoryStore) GetUser(ctx context.Context, userID string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	copied := *user
+	return &copied, nil
+}
+
+func (m *MemoryStore) SetUserActive(
+	ctx context.Context, userID string, isActive bool, version int64, audit models.Audit,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, err := m.claimUser(userID, version)
+	if err != nil {
+		return err
+	}
+	user.IsActive = isActive
+	if team, ok := m.teams[user.TeamName]; ok {
+		team.version++
+	}
+	m.appendEvents(userEvent(audit, activationEventType(isActive), userID, user.TeamName, nil))
+	return nil
+}
+
+func (m *MemoryStore) SetUserRole(ctx context.Context, userID, role string, version int64, audit models.Audit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, err := m.claimUser(userID, version)
+	if err != nil {
+		return err
+	}
+	user.Role = role
+	if team, ok := m.teams[user.TeamName]; ok {
+		team.version++
+	}
+	m.appendEvents(userEvent(audit, models.EventUserUpdated, userID, user.TeamName, map[string]string{"role": role}))
+	return nil
+}
+
+func (m *MemoryStore) SetUserMaxOpenReviews(
+	ctx context.Context, userID string, maxOpenReviews int, version int64, audit models.Audit,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, err := m.claimUser(userID, version)
+	if err != nil {
+		return err
+	}
+	user.MaxOpenReviews = maxOpenReviews
+	m.appendEvents(userEvent(audit, models.EventUserUpdated, userID, "",
+		map[string]string{"max_open_reviews": strconv.Itoa(maxOpenReviews)}))
+	return nil
+}
+
+func (m *MemoryStore) GetMaxOpenReviews(ctx context.Context, userIDs []string) (map[string]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limits := make(map[string]int)
+	for _, userID := range userIDs {
+		if user, ok := m.users[userID]; ok && user.MaxOpenReviews > 0 {
+			limits[userID] = user.MaxOpenReviews
+		}
+	}
+
+	return limits, nil
+}
+
+func (m *MemoryStore) GetActiveTeamMembers(
+	ctx context.Context, teamName string, excludeUserID string,
+) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.availableMembers(teamName, map[string]bool{excludeUserID: true}), nil
+}
+
+func (m *MemoryStore) GetUserPullRequests(
+	ctx context.Context, userID string, awaitingOnly bool,
+) ([]models.PullRequestShort, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var prs []models.PullRequestShort
+	for _, prID := range m.sortedPRIDs() {
+		pr := m.prs[prID]
+		review, ok := m.reviews[prID][userID]
+		if !ok || pr.Status == models.StatusClosed {
+			continue
+		}
+
+		if awaitingOnly {
+			awaiting := review.State == models.ReviewStatePending || review.State == models.ReviewStateCommented
+			if pr.Status != models.StatusOpen || !awaiting {
+				continue
+			}
+		}
+
+		prs = append(prs, models.PullRequestShort{
+			PullRequestID:   pr.PullRequestID,
+			PullRequestName: pr.PullRequestName,
+			AuthorID:        pr.AuthorID,
+			Status:          pr.Status,
+			IsDraft:         pr.IsDraft,
+			ReviewState:     review.State,
+		})
+	}
+
+	return prs, nil
+}
+
+func (m *MemoryStore) GetOpenReviewCounts(ctx context.Context, userIDs []string) (map[string]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.openReviewCounts(toSet(userIDs)), nil
+}
+
+func (m *MemoryStore) GetPullRequest(ctx context.Context, prID string) (*models.PullRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.prs[prID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	pr := *stored
+	pr.AssignedReviewers = []string{}
+	pr.Reviews = []models.Review{}
+	for _, reviewerID := range m.sortedReviewerIDs(prID) {
+		pr.AssignedReviewers = append(pr.AssignedReviewers, reviewerID)
+		pr.Reviews = append(pr.Reviews, *m.reviews[prID][reviewerID])
+	}
+
+	return &pr, nil
+}
+
+func (m *MemoryStore) PRExists(ctx context.Context, prID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.prs[prID]
+	return ok, nil
+}
+
+func (m *MemoryStore) CreatePullRequest(
+	ctx context.Context, prID, prName, authorID string, isDraft bool, reviewersCount int, reviewers []string,
+	audit models.Audit,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.prs[prID]; ok {
+		return fmt.Errorf("%w: pull request %s", ErrUniqueViolation, prID)
+	}
+	if _, ok := m.users[authorID]; !ok {
+		return fmt.Errorf("%w: author %s", ErrForeignKeyViolation, authorID)
+	}
+
+	assigned := make(map[string]*models.Review, len(reviewers))
+	for _, reviewerID := range reviewers {
+		if _, ok := m.users[reviewerID]; !ok {
+			return fmt.Errorf("%w: reviewer %s", ErrForeignKeyViolation, reviewerID)
+		}
+		if _, ok := assigned[reviewerID]; ok {
+			return fmt.Errorf("%w: reviewer %s", ErrUniqueViolation, reviewerID)
+		}
+		assigned[reviewerID] = newReview(reviewerID)
+	}
+
+	now := time.Now()
+	m.prs[prID] = &models.PullRequest{
+		PullRequestID:   prID,
+		PullRequestName: prName,
+		AuthorID:        authorID,
+		Status:          models.StatusOpen,
+		IsDraft:         isDraft,
+		ReviewersCount:  reviewersCount,
+		CreatedAt:       &now,
+		Version:         1,
+	}
+	m.reviews[prID] = assigned
+	m.appendEvents(prCreatedEvents(audit, prID, prName, isDraft, reviewers)...)
+
+	return nil
+}
+
+func (m *MemoryStore) MergePullRequest(ctx context.Context, prID string, version int64, audit models.Audit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pr, err := m.claimPullRequest(prID, version)
+	if err != nil {
+		return err
+	}
+
+	pr.Status = models.StatusMerged
+	if pr.MergedAt == nil {
+		now := time.Now()
+		pr.MergedAt = &now
+	}
+	m.appendEvents(prEvent(audit, models.EventPRMerged, prID))
+	return nil
+}
+
+func (m *MemoryStore) ClosePullRequest(ctx context.Context, prID string, version int64, audit models.Audit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if pr, ok := m.prs[prID]; !ok || pr.Status != models.StatusOpen {
+		return ErrVersionConflict
+	}
+	pr, err := m.claimPullRequest(prID, version)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	pr.Status = models.StatusClosed
+	pr.ClosedAt = &now
+	m.appendEvents(prEvent(audit, models.EventPRClosed, prID))
+	return nil
+}
+
+func (m *MemoryStore) ReopenPullRequest(
+	ctx context.Context, prID string, version int64, removedReviewers, addedReviewers []string, audit models.Audit,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkUsersExist(addedReviewers); err != nil {
+		return err
+	}
+
+	if pr, ok := m.prs[prID]; !ok || pr.Status != models.StatusClosed {
+		return ErrVersionConflict
+	}
+	pr, err := m.claimPullRequest(prID, version)
+	if err != nil {
+		return err
+	}
+
+	pr.Status = models.StatusOpen
+	pr.ClosedAt = nil
+
+	for _, reviewerID := range removedReviewers {
+		delete(m.reviews[prID], reviewerID)
+	}
+	m.addReviewers(prID, addedReviewers)
+	m.appendEvents(reopenEvents(audit, prID, removedReviewers, addedReviewers)...)
+
+	return nil
+}
+
+func (m *MemoryStore) MarkPullRequestReady(
+	ctx context.Context, prID string, version int64, reviewers []string, audit models.Audit,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkUsersExist(reviewers); err != nil {
+		return err
+	}
+
+	pr, err := m.claimPullRequest(prID, version)
+	if err != nil {
+		return err
+	}
+
+	pr.IsDraft = false
+	m.addReviewers(prID, reviewers)
+	m.appendEvents(readyEvents(audit, prID, reviewers)...)
+
+	return nil
+}
+
+func (m *MemoryStore) IsReviewerAssigned(ctx context.Context, prID, userID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.reviews[prID][userID]
+	return ok, nil
+}
+
+func (m *MemoryStore) ReassignReviewer(
+	ctx context.Context, prID string, version int64, oldReviewerID, newReviewerID string, audit models.Audit,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[newReviewerID]; !ok {
+		return fmt.Errorf("%w: reviewer %s", ErrForeignKeyViolation, newReviewerID)
+	}
+	pr, ok := m.prs[prID]
+	if !ok {
+		return ErrVersionConflict
+	}
+
+	reviewers := m.reviews[prID]
+	if _, ok := reviewers[newReviewerID]; ok && newReviewerID != oldReviewerID {
+		return fmt.Errorf("%w: reviewer %s", ErrUniqueViolation, newReviewerID)
+	}
+	if !versionMatches(pr.Version, version) {
+		return ErrVersionConflict
+	}
+	pr.Version++
+
+	delete(reviewers, oldReviewerID)
+	reviewers[newReviewerID] = newReview(newReviewerID)
+	m.appendEvents(reassignEvents(audit, prID, oldReviewerID, newReviewerID)...)
+
+	return nil
+}
+
+func (m *MemoryStore) SetReviewState(
+	ctx context.Context, prID string, version int64, reviewerID, state string, audit models.Audit,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.claimPullRequest(prID, version); err != nil {
+		return err
+	}
+
+	if review, ok := m.reviews[prID][reviewerID]; ok {
+		now := time.Now()
+		review.State = state
+		review.ReviewedAt = &now
+	}
+	m.appendEvents(reviewEvent(audit, prID, reviewerID, state))
+	return nil
+}
+
+func (m *MemoryStore) CreateAbsence(ctx context.Context, absence *models.Absence, audit models.Audit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[absence.UserID]
+	if !ok {
+		return fmt.Errorf("%w: user %s", ErrForeignKeyViolation, absence.UserID)
+	}
+
+	m.nextAbsenceID++
+	absence.AbsenceID = m.nextAbsenceID
+	stored := *absence
+	stored.ReassignedAt = nil
+	stored.CancelledAt = nil
+	m.absences[stored.AbsenceID] = &stored
+
+	m.appendEvents(absenceEvent(audit, models.EventAbsenceCreated, user.TeamName, &stored))
+	return nil
+}
+
+func (m *MemoryStore) GetAbsence(ctx context.Context, absenceID int64) (*models.Absence, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	absence, ok := m.absences[absenceID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	copied := *absence
+	return &copied, nil
+}
+
+func (m *MemoryStore) GetUserAbsences(ctx context.Context, userID string) ([]models.Absence, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	absences := []models.Absence{}
+	for _, absence := range m.sortedAbsences() {
+		if absence.UserID == userID {
+			absences = append(absences, *absence)
+		}
+	}
+
+	return absences, nil
+}
+
+func (m *MemoryStore) CancelAbsence(ctx context.Context, absenceID int64, audit models.Audit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if absence, ok := m.absences[absenceID]; ok && absence.CancelledAt == nil {
+		now := time.Now()
+		absence.CancelledAt = &now
+		m.appendEvents(absenceEvent(audit, models.EventAbsenceCancelled, m.users[absence.UserID].TeamName, absence))
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetStartedAbsencesToReassign(ctx context.Context) ([]models.Absence, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var absences []models.Absence
+	for _, absence := range m.sortedAbsences() {
+		if absence.AutoReassign && absence.ReassignedAt == nil && absence.CancelledAt == nil &&
+			absenceCovers(absence, now) {
+			absences = append(absences, *absence)
+		}
+	}
+
+	return absences, nil
+}
+
+func (m *MemoryStore) MarkAbsenceReassigned(ctx context.Context, absenceID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if absence, ok := m.absences[absenceID]; ok {
+		now := time.Now()
+		absence.ReassignedAt = &now
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetUserStats(ctx context.Context) ([]models.UserStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var stats []models.UserStats
+	for _, user := range m.sortedUsers() {
+		count := 0
+		for prID, reviewers := range m.reviews {
+			if _, ok := reviewers[user.UserID]; ok && m.prs[prID].Status != models.StatusClosed {
+				count++
+			}
+		}
+		stats = append(stats, models.UserStats{
+			UserID:           user.UserID,
+			Username:         user.Username,
+			AssignedPRsCount: count,
+		})
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].AssignedPRsCount > stats[j].AssignedPRsCount
+	})
+	return stats, nil
+}
+
+func (m *MemoryStore) GetPRStats(ctx context.Context, drafts bool) ([]models.PRStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var stats []models.PRStats
+	for _, prID := range m.sortedPRIDs() {
+		pr := m.prs[prID]
+		if pr.IsDraft != drafts {
+			continue
+		}
+		stats = append(stats, models.PRStats{
+			PullRequestID:   pr.PullRequestID,
+			PullRequestName: pr.PullRequestName,
+			ReviewersCount:  len(m.reviews[prID]),
+			Status:          pr.Status,
+		})
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].ReviewersCount > stats[j].ReviewersCount
+	})
+	return stats, nil
+}
+
+func (m *MemoryStore) GetTotalUsersCount(ctx context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.users), nil
+}
+
+func (m *MemoryStore) GetWorkload(ctx context.Context) (*models.Workload, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	workload := &models.Workload{}
+	for _, pr := range m.prs {
+		if pr.Status == models.StatusOpen {
+			workload.OpenPRs++
+		}
+	}
+	reviewers := make(map[string]bool)
+	for _, user := range m.users {
+		if user.IsActive {
+			workload.ActiveUsers++
+		}
+		reviewers[user.UserID] = true
+	}
+	workload.OpenReviews = m.openReviewCounts(reviewers)
+	return workload, nil
+}
+
+func (m *MemoryStore) GetTotalPRsCount(ctx context.Context, drafts bool) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, pr := range m.prs {
+		if pr.IsDraft == drafts {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// availableMembers mirrors the active-member queries: active, not excluded,
+// not absent right now, ordered by user_id.
+func (m *MemoryStore) availableMembers(teamName string, exclude map[string]bool) []string {
+	now := time.Now()
+	absent := make(map[string]bool)
+	for _, absence := range m.absences {
+		if absence.CancelledAt == nil && absenceCovers(absence, now) {
+			absent[absence.UserID] = true
+		}
+	}
+
+	var userIDs []string
+	for _, user := range m.sortedUsers() {
+		if user.TeamName == teamName && user.IsActive && !exclude[user.UserID] && !absent[user.UserID] {
+			userIDs = append(userIDs, user.UserID)
+		}
+	}
+	return userIDs
+}
+
+func (m *MemoryStore) openReviewCounts(userIDs map[string]bool) map[string]int {
+	counts := make(map[string]int)
+	for prID, reviewers := range m.reviews {
+		pr := m.prs[prID]
+		if pr.Status != models.StatusOpen || pr.IsDraft {
+			continue
+		}
+		for reviewerID := range reviewers {
+			if userIDs[reviewerID] {
+				counts[reviewerID]++
+			}
+		}
+	}
+	return counts
+}
+
+// claimPullRequest, claimTeam and claimUser check the expected version and
+// bump it, mirroring the conditional UPDATEs of the PostgreSQL store.
+func (m *MemoryStore) claimPullRequest(prID string, version int64) (*models.PullRequest, error) {
+	pr, ok := m.prs[prID]
+	if !ok || !versionMatches(pr.Version, version) {
+		return nil, ErrVersionConflict
+	}
+	pr.Version++
+	return pr, nil
+}
+
+func (m *MemoryStore) claimTeam(teamName string, version int64) (*memTeam, error) {
+	team, ok := m.teams[teamName]
+	if !ok || !versionMatches(team.version, version) {
+		return nil, ErrVersionConflict
+	}
+	team.version++
+	return team, nil
+}
+
+func (m *MemoryStore) claimUser(userID string, version int64) (*models.User, error) {
+	user, ok := m.users[userID]
+	if !ok || !versionMatches(user.Version, version) {
+		return nil, ErrVersionConflict
+	}
+	user.Version++
+	return user, nil
+}
+
+func versionMatches(current, expected int64) bool {
+	return expected == 0 || current == expected
+}
+
+func (m *MemoryStore) checkUsersExist(userIDs []string) error {
+	for _, userID := range userIDs {
+		if _, ok := m.users[userID]; !ok {
+			return fmt.Errorf("%w: user %s", ErrForeignKeyViolation, userID)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) addReviewers(prID string, reviewerIDs []string) {
+	reviewers := m.reviews[prID]
+	for _, reviewerID := range reviewerIDs {
+		if _, ok := reviewers[reviewerID]; !ok {
+			reviewers[reviewerID] = newReview(reviewerID)
+		}
+	}
+}
+
+func (m *MemoryStore) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := m.idempotency[record.Key]; ok && existing.ExpiresAt.After(now) {
+		return false, nil
+	}
+
+	m.idempotency[record.Key] = &models.IdempotencyRecord{
+		Key:         record.Key,
+		RequestHash: record.RequestHash,
+		CreatedAt:   now,
+		ExpiresAt:   record.ExpiresAt,
+	}
+	return true, nil
+}
+
+func (m *MemoryStore) GetIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	record, ok := m.idempotency[key]
+	if !ok || !record.ExpiresAt.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+
+	result := *record
+	result.Body = append([]byte{}, record.Body...)
+	return &result, nil
+}
+
+func (m *MemoryStore) CompleteIdempotencyKey(
+	ctx context.Context, key string, statusCode int, etag string, body []byte,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if record, ok := m.idempotency[key]; ok {
+		record.StatusCode = statusCode
+		record.ETag = etag
+		record.Body = append([]byte{}, body...)
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.idempotency, key)
+	return nil
+}
+
+func (m *MemoryStore) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var deleted int64
+	for key, record := range m.idempotency {
+		if !record.ExpiresAt.After(now) {
+			delete(m.idempotency, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *MemoryStore) ListEvents(ctx context.Context, filter models.EventFilter) ([]models.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := []models.Event{}
+	for _, event := range m.events {
+		if !eventMatches(event, filter) {
+			continue
+		}
+		events = append(events, event)
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+// appendEvents assigns ids in insertion order, mirroring the BIGSERIAL column,
+// and queues deliveries for subscribed webhooks.
+func (m *MemoryStore) appendEvents(events ...models.Event) {
+	now := time.Now()
+	for _, event := range events {
+		event.EventID = int64(len(m.events)) + 1
+		event.CreatedAt = now
+		m.events = append(m.events, event)
+
+		for _, webhookID := range m.sortedWebhookIDs() {
+			if !containsString(m.webhooks[webhookID].EventTypes, event.Type) {
+				continue
+			}
+			m.nextDelivery++
+			m.deliveries = append(m.deliveries, &memDelivery{
+				delivery: models.WebhookDelivery{
+					DeliveryID: m.nextDelivery,
+					WebhookID:  webhookID,
+					EventID:    event.EventID,
+					EventType:  event.Type,
+					Status:     models.DeliveryPending,
+					CreatedAt:  now,
+				},
+				nextAttemptAt: now,
+			})
+		}
+	}
+}
+
+func eventMatches(event models.Event, filter models.EventFilter) bool {
+	switch {
+	case event.EventID <= filter.AfterID,
+		filter.Actor != "" && event.Actor != filter.Actor,
+		filter.PullRequestID != "" && event.PullRequestID != filter.PullRequestID,
+		filter.UserID != "" && event.UserID != filter.UserID,
+		filter.TeamName != "" && event.TeamName != filter.TeamName,
+		filter.Type != "" && event.Type != filter.Type,
+		filter.Since != nil && event.CreatedAt.Before(*filter.Since),
+		filter.Until != nil && !event.CreatedAt.Before(*filter.Until):
+		return false
+	}
+	return true
+}
+
+func (m *MemoryStore) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextWebhookID++
+	webhook.WebhookID = m.nextWebhookID
+	webhook.CreatedAt = time.Now()
+
+	copied := *webhook
+	copied.EventTypes = append([]string(nil), webhook.EventTypes...)
+	m.webhooks[webhook.WebhookID] = &copied
+	return nil
+}
+
+func (m *MemoryStore) GetWebhook(ctx context.Context, webhookID int64) (*models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	webhook, ok := m.webhooks[webhookID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	copied := *webhook
+	return &copied, nil
+}
+
+func (m *MemoryStore) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	webhooks := []models.Webhook{}
+	for _, webhookID := range m.sortedWebhookIDs() {
+		webhooks = append(webhooks, *m.webhooks[webhookID])
+	}
+	return webhooks, nil
+}
+
+func (m *MemoryStore) DeleteWebhook(ctx context.Context, webhookID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[webhookID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(m.webhooks, webhookID)
+
+	kept := m.deliveries[:0]
+	for _, d := range m.deliveries {
+		if d.delivery.WebhookID != webhookID {
+			kept = append(kept, d)
+		}
+	}
+	m.deliveries = kept
+	return nil
+}
+
+func (m *MemoryStore) ClaimWebhookDeliveries(
+	ctx context.Context, limit int, lease time.Duration,
+) ([]models.WebhookDispatch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var due []*memDelivery
+	for _, d := range m.deliveries {
+		if d.delivery.Status == models.DeliveryPending && !d.nextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].nextAttemptAt.Before(due[j].nextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].delivery.DeliveryID < due[j].delivery.DeliveryID })
+
+	var dispatches []models.WebhookDispatch
+	for _, d := range due {
+		d.nextAttemptAt = now.Add(lease)
+		webhook := m.webhooks[d.delivery.WebhookID]
+		dispatches = append(dispatches, models.WebhookDispatch{
+			Delivery: d.snapshot(),
+			URL:      webhook.URL,
+			Secret:   webhook.Secret,
+			Event:    m.events[d.delivery.EventID-1],
+		})
+	}
+	return dispatches, nil
+}
+
+func (m *MemoryStore) RecordWebhookAttempt(ctx context.Context, deliveryID int64, attempt models.WebhookAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d := m.findDelivery(deliveryID)
+	if d == nil {
+		return nil
+	}
+
+	d.delivery.Status = attempt.Status
+	d.delivery.Attempts++
+	d.delivery.LastStatusCode = attempt.StatusCode
+	d.delivery.LastError = attempt.Error
+	d.delivery.DeliveredAt = nil
+	switch attempt.Status {
+	case models.DeliveryPending:
+		d.nextAttemptAt = attempt.NextAttemptAt
+	case models.DeliveryDelivered:
+		now := time.Now()
+		d.delivery.DeliveredAt = &now
+	}
+	return nil
+}
+
+func (m *MemoryStore) RetryWebhookDelivery(ctx context.Context, deliveryID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d := m.findDelivery(deliveryID)
+	if d == nil || d.delivery.Status != models.DeliveryDead {
+		return sql.ErrNoRows
+	}
+
+	d.delivery.Status = models.DeliveryPending
+	d.delivery.Attempts = 0
+	d.nextAttemptAt = time.Now()
+	return nil
+}
+
+func (m *MemoryStore) GetWebhookDelivery(ctx context.Context, deliveryID int64) (*models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	d := m.findDelivery(deliveryID)
+	if d == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	delivery := d.snapshot()
+	return &delivery, nil
+}
+
+func (m *MemoryStore) ListWebhookDeliveries(
+	ctx context.Context, filter models.WebhookDeliveryFilter,
+) ([]models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deliveries := []models.WebhookDelivery{}
+	for i := len(m.deliveries) - 1; i >= 0; i-- {
+		d := m.deliveries[i]
+		if filter.WebhookID != 0 && d.delivery.WebhookID != filter.WebhookID {
+			continue
+		}
+		if filter.Status != "" && d.delivery.Status != filter.Status {
+			continue
+		}
+		deliveries = append(deliveries, d.snapshot())
+		if filter.Limit > 0 && len(deliveries) == filter.Limit {
+			break
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *MemoryStore) findDelivery(deliveryID int64) *memDelivery {
+	for _, d := range m.deliveries {
+		if d.delivery.DeliveryID == deliveryID {
+			return d
+		}
+	}
+	return nil
+}
+
+// snapshot exposes the next attempt only while one is scheduled, like the
+// PostgreSQL implementation.
+func (d *memDelivery) snapshot() models.WebhookDelivery {
+	delivery := d.delivery
+	if delivery.Status == models.DeliveryPending {
+		nextAttemptAt := d.nextAttemptAt
+		delivery.NextAttemptAt = &nextAttemptAt
+	}
+	return delivery
+}
+
+func (m *MemoryStore) sortedWebhookIDs() []int64 {
+	ids := make([]int64, 0, len(m.webhooks))
+	for id := range m.webhooks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) SetExternalAccount(ctx context.Context, account *models.ExternalAccount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[account.UserID]; !ok {
+		return fmt.Errorf("%w: user %s", ErrForeignKeyViolation, account.UserID)
+	}
+
+	m.accounts[accountKey{account.Provider, account.Login}] = account.UserID
+	return nil
+}
+
+func (m *MemoryStore) GetExternalAccountUser(ctx context.Context, provider, login string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	userID, ok := m.accounts[accountKey{provider, login}]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return userID, nil
+}
+
+func (m *MemoryStore) ListExternalAccounts(ctx context.Context, provider string) ([]models.ExternalAccount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	accounts := []models.ExternalAccount{}
+	for key, userID := range m.accounts {
+		if provider == "" || key.provider == provider {
+			accounts = append(accounts, models.ExternalAccount{Provider: key.provider, Login: key.login, UserID: userID})
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].Provider != accounts[j].Provider {
+			return accounts[i].Provider < accounts[j].Provider
+		}
+		return accounts[i].Login < accounts[j].Login
+	})
+	return accounts, nil
+}
+
+func (m *MemoryStore) CreateRejectedEvent(ctx context.Context, event *models.RejectedEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event.RejectedID = int64(len(m.rejected)) + 1
+	event.CreatedAt = time.Now()
+
+	copied := *event
+	copied.Payload = append([]byte(nil), event.Payload...)
+	m.rejected = append(m.rejected, copied)
+	return nil
+}
+
+func (m *MemoryStore) ListRejectedEvents(
+	ctx context.Context, provider string, limit int,
+) ([]models.RejectedEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := []models.RejectedEvent{}
+	for i := len(m.rejected) - 1; i >= 0 && len(events) < limit; i-- {
+		if provider == "" || m.rejected[i].Provider == provider {
+			events = append(events, m.rejected[i])
+		}
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) CreateAPIToken(ctx context.Context, token *models.APIToken, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.tokens {
+		if existing.hash == hash {
+			return ErrUniqueViolation
+		}
+	}
+	if _, ok := m.users[token.UserID]; token.UserID != "" && !ok {
+		return fmt.Errorf("%w: user %s", ErrForeignKeyViolation, token.UserID)
+	}
+
+	token.TokenID = int64(len(m.tokens)) + 1
+	token.CreatedAt = time.Now()
+	stored := *token
+	stored.Scopes = append([]string(nil), token.Scopes...)
+	m.tokens = append(m.tokens, &memToken{token: stored, hash: hash})
+	return nil
+}
+
+func (m *MemoryStore) GetAPITokenByHash(ctx context.Context, hash string) (*models.APIToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, stored := range m.tokens {
+		if stored.hash == hash && stored.token.RevokedAt == nil {
+			token := stored.token
+			return &token, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemoryStore) ListAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tokens := make([]models.APIToken, 0, len(m.tokens))
+	for _, stored := range m.tokens {
+		tokens = append(tokens, stored.token)
+	}
+	return tokens, nil
+}
+
+func (m *MemoryStore) RevokeAPIToken(ctx context.Context, tokenID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if tokenID < 1 || tokenID > int64(len(m.tokens)) || m.tokens[tokenID-1].token.RevokedAt != nil {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	m.tokens[tokenID-1].token.RevokedAt = &now
+	return nil
+}
+
+func (m *MemoryStore) sortedUsers() []*models.User {
+	users := make([]*models.User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	return users
+}
+
+func (m *MemoryStore) sortedPRIDs() []string {
+	ids := make([]string, 0, len(m.prs))
+	for prID := range m.prs {
+		ids = append(ids, prID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (m *MemoryStore) sortedReviewerIDs(prID string) []string {
+	ids := make([]string, 0, len(m.reviews[prID]))
+	for reviewerID := range m.reviews[prID] {
+		ids = append(ids, reviewerID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (m *MemoryStore) sortedAbsences() []*models.Absence {
+	absences := make([]*models.Absence, 0, len(m.absences))
+	for _, absence := range m.absences {
+		absences = append(absences, absence)
+	}
+	sort.Slice(absences, func(i, j int) bool {
+		if !absences[i].StartsAt.Equal(absences[j].StartsAt) {
+			return absences[i].StartsAt.Before(absences[j].StartsAt)
+		}
+		return absences[i].AbsenceID < absences[j].AbsenceID
+	})
+	return absences
+}
+
+func newReview(reviewerID string) *models.Review {
+	return &models.Review{ReviewerID: reviewerID, State: models.ReviewStatePending}
+}
+
+func absenceCovers(absence *models.Absence, at time.Time) bool {
+	return !absence.StartsAt.After(at) && absence.EndsAt.After(at)
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
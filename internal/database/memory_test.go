@@ -0,0 +1,86 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"pr-review-service/internal/database"
+	"pr-review-service/internal/database/storetest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		return database.NewMemoryStore()
+	})
+}
+
+// TestObservedStoreConformance checks the wrapper forwards every call and
+// reports each one.
+func TestObservedStoreConformance(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	storetest.Run(t, func(t *testing.T) database.Store {
+		return database.NewObservedStore(database.NewMemoryStore(),
+			func(ctx context.Context, method string) (context.Context, func(error)) {
+				return ctx, func(error) {
+					mu.Lock()
+					calls[method]++
+					mu.Unlock()
+				}
+			})
+	})
+
+	if calls["CreateTeam"] == 0 || calls["GetPullRequest"] == 0 {
+		t.Fatalf("observed calls = %v", calls)
+	}
+}
+
+// stuckStore never answers Ping until the caller gives up.
+type stuckStore struct {
+	*database.MemoryStore
+}
+
+func (stuckStore) Ping(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWithQueryTimeoutBoundsEachCall(t *testing.T) {
+	var finished error
+	observe := func(ctx context.Context, _ string) (context.Context, func(error)) {
+		return ctx, func(err error) { finished = err }
+	}
+	store := database.NewObservedStore(stuckStore{database.NewMemoryStore()},
+		database.WithQueryTimeout(10*time.Millisecond, observe))
+
+	err := store.Ping(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) || finished != err {
+		t.Fatalf("Ping: err = %v, observed %v; want the query deadline", err, finished)
+	}
+	if _, err := store.GetTeam(context.Background(), "missing"); err != sql.ErrNoRows {
+		t.Fatalf("GetTeam: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestIsCanceled(t *testing.T) {
+	for _, err := range []error{
+		context.Canceled,
+		fmt.Errorf("query: %w", context.DeadlineExceeded),
+		&pq.Error{Code: "57014", Message: "canceling statement due to user request"},
+	} {
+		if !database.IsCanceled(err) {
+			t.Errorf("IsCanceled(%v) = false", err)
+		}
+	}
+	for _, err := range []error{sql.ErrNoRows, database.ErrVersionConflict, &pq.Error{Code: "23505"}} {
+		if database.IsCanceled(err) {
+			t.Errorf("IsCanceled(%v) = true", err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"pr-review-service/internal/models"
+)
+
+// GetMergePolicy returns the team's policy, or an empty policy when the team
+// has never configured one.
+func (db *DB) GetMergePolicy(ctx context.Context, teamName string) (*models.MergePolicy, error) {
+	policy := &models.MergePolicy{TeamName: teamName}
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(p.min_approvals, 0), COALESCE(p.block_on_changes_requested, false),
+			COALESCE(p.forbid_author_self_merge, false), t.version
+		FROM teams t
+		LEFT JOIN merge_policies p ON p.team_name = t.team_name
+		WHERE t.team_name = $1
+	`, teamName).Scan(
+		&policy.MinApprovals, &policy.BlockOnChangesRequested, &policy.ForbidAuthorSelfMerge, &policy.Version,
+	)
+	if err == sql.ErrNoRows {
+		return policy, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (db *DB) SetMergePolicy(
+	ctx context.Context, policy *models.MergePolicy, version int64, audit models.Audit,
+) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE teams
+		SET version = version + 1
+		WHERE team_name = $1 AND ($2::BIGINT = 0 OR version = $2::BIGINT)
+	`, policy.TeamName, version)
+	if err != nil {
+		return err
+	}
+	if err := expectRow(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO merge_policies (team_name, min_approvals, block_on_changes_requested, forbid_author_self_merge)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (team_name)
+		DO UPDATE SET min_approvals = $2, block_on_changes_requested = $3, forbid_author_self_merge = $4
+	`, policy.TeamName, policy.MinApprovals, policy.BlockOnChangesRequested, policy.ForbidAuthorSelfMerge)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if err := insertEvents(ctx, tx, []models.Event{mergePolicyEvent(audit, policy)}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
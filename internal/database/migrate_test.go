@@ -0,0 +1,82 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrationsEmbedded(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 || m.Up == "" || m.Down == "" || len(m.Checksum) != 64 {
+			t.Fatalf("migration %d = %+v", i, m)
+		}
+	}
+}
+
+func TestLoadMigrationsRejectsBrokenSets(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  string
+	}{
+		{
+			name: "missing down",
+			files: fstest.MapFS{
+				"m/0001_init.up.sql": {Data: []byte("SELECT 1;")},
+			},
+			want: "needs both up and down",
+		},
+		{
+			name: "gap",
+			files: fstest.MapFS{
+				"m/0001_init.up.sql":   {Data: []byte("SELECT 1;")},
+				"m/0001_init.down.sql": {Data: []byte("SELECT 1;")},
+				"m/0003_next.up.sql":   {Data: []byte("SELECT 1;")},
+				"m/0003_next.down.sql": {Data: []byte("SELECT 1;")},
+			},
+			want: "contiguous",
+		},
+		{
+			name: "bad name",
+			files: fstest.MapFS{
+				"m/init.sql": {Data: []byte("SELECT 1;")},
+			},
+			want: "invalid migration file name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files, "m")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrationChecksumTracksUpSQL(t *testing.T) {
+	load := func(up string) Migration {
+		t.Helper()
+		migrations, err := loadMigrations(fstest.MapFS{
+			"m/0001_init.up.sql":   {Data: []byte(up)},
+			"m/0001_init.down.sql": {Data: []byte("DROP TABLE t;")},
+		}, "m")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return migrations[0]
+	}
+
+	if load("CREATE TABLE t (id INT);").Checksum == load("CREATE TABLE t (id BIGINT);").Checksum {
+		t.Fatal("editing a migration must change its checksum")
+	}
+}
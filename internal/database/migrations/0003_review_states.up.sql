@@ -0,0 +1,2 @@
+ALTER TABLE pr_reviewers ADD COLUMN IF NOT EXISTS review_state VARCHAR(20) NOT NULL DEFAULT 'PENDING';
+ALTER TABLE pr_reviewers ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMP;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS merge_policies (
+	team_name VARCHAR(255) PRIMARY KEY REFERENCES teams(team_name) ON DELETE CASCADE,
+	min_approvals INTEGER NOT NULL DEFAULT 0,
+	block_on_changes_requested BOOLEAN NOT NULL DEFAULT false,
+	forbid_author_self_merge BOOLEAN NOT NULL DEFAULT false
+);
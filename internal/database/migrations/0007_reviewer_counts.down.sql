@@ -0,0 +1,2 @@
+ALTER TABLE teams DROP COLUMN IF EXISTS default_reviewers;
+ALTER TABLE pull_requests DROP COLUMN IF EXISTS reviewers_count;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_absences (
+	absence_id BIGSERIAL PRIMARY KEY,
+	user_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+	starts_at TIMESTAMPTZ NOT NULL,
+	ends_at TIMESTAMPTZ NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	auto_reassign BOOLEAN NOT NULL DEFAULT false,
+	reassigned_at TIMESTAMPTZ,
+	cancelled_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_absences_user ON user_absences(user_id, starts_at);
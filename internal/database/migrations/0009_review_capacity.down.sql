@@ -0,0 +1,2 @@
+ALTER TABLE teams DROP COLUMN IF EXISTS capacity_fallback;
+ALTER TABLE users DROP COLUMN IF EXISTS max_open_reviews;
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS max_open_reviews INTEGER;
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS capacity_fallback VARCHAR(32);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS version;
+ALTER TABLE teams DROP COLUMN IF EXISTS version;
+ALTER TABLE pull_requests DROP COLUMN IF EXISTS version;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS events (
+	event_id BIGSERIAL PRIMARY KEY,
+	event_type VARCHAR(64) NOT NULL,
+	actor VARCHAR(255) NOT NULL DEFAULT '',
+	pull_request_id VARCHAR(255),
+	user_id VARCHAR(255),
+	team_name VARCHAR(255),
+	reason VARCHAR(64) NOT NULL DEFAULT '',
+	details JSONB NOT NULL DEFAULT '{}',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_pull_request ON events(pull_request_id, event_id);
+CREATE INDEX IF NOT EXISTS idx_events_user ON events(user_id, event_id);
+CREATE INDEX IF NOT EXISTS idx_events_actor ON events(actor, event_id);
+CREATE INDEX IF NOT EXISTS idx_events_created_at ON events(created_at);
+
+CREATE OR REPLACE FUNCTION events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER events_append_only
+	BEFORE UPDATE OR DELETE ON events
+	FOR EACH ROW EXECUTE FUNCTION events_append_only();
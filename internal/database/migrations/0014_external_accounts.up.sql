@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS external_accounts (
+	provider VARCHAR(32) NOT NULL,
+	login VARCHAR(255) NOT NULL,
+	user_id VARCHAR(255) NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+	PRIMARY KEY (provider, login)
+);
+
+CREATE INDEX IF NOT EXISTS idx_external_accounts_user ON external_accounts(user_id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS rejected_events (
+	rejected_id BIGSERIAL PRIMARY KEY,
+	provider VARCHAR(32) NOT NULL,
+	event_type VARCHAR(64) NOT NULL,
+	action VARCHAR(64) NOT NULL DEFAULT '',
+	login VARCHAR(255) NOT NULL DEFAULT '',
+	pull_request_id VARCHAR(255) NOT NULL DEFAULT '',
+	reason TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rejected_events_provider ON rejected_events(provider, rejected_id);
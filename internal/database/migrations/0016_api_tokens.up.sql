@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS api_tokens (
+	token_id BIGSERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	scopes TEXT[] NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	revoked_at TIMESTAMPTZ
+);
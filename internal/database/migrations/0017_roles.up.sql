@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'member'
+	CHECK (role IN ('lead', 'member'));
+
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS user_id VARCHAR(255) REFERENCES users(user_id) ON DELETE CASCADE;
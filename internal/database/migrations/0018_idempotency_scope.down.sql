@@ -0,0 +1,3 @@
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS response_etag;
+DELETE FROM idempotency_keys WHERE LENGTH(idempotency_key) > 255;
+ALTER TABLE idempotency_keys ALTER COLUMN idempotency_key TYPE VARCHAR(255);
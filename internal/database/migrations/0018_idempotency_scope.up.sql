@@ -0,0 +1,4 @@
+-- Keys are now prefixed with the caller's token, which can push them past
+-- the 255 characters a client may send.
+ALTER TABLE idempotency_keys ALTER COLUMN idempotency_key TYPE TEXT;
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS response_etag TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,526 @@
+package database
+
+import (
+	"context"
+	"pr-review-service/internal/models"
+	"time"
+)
+
+// Observer is called before every Store call with the method name. The
+// context it returns is passed to the wrapped store, e.g. to parent a span,
+// and finish receives the outcome of the call.
+type Observer func(ctx context.Context, method string) (_ context.Context, finish func(err error))
+
+// ObservedStore wraps a Store and reports every call to an Observer, e.g. to
+// export per-method query latencies or trace repository queries.
+type ObservedStore struct {
+	store   Store
+	observe Observer
+}
+
+var _ Store = (*ObservedStore)(nil)
+
+func NewObservedStore(store Store, observe Observer) *ObservedStore {
+	return &ObservedStore{store: store, observe: observe}
+}
+
+// WithQueryTimeout bounds every call to timeout, on top of any deadline the
+// caller's context already has, before handing it to observe. Zero leaves
+// calls unbounded.
+func WithQueryTimeout(timeout time.Duration, observe Observer) Observer {
+	if timeout <= 0 {
+		return observe
+	}
+	return func(ctx context.Context, method string) (context.Context, func(error)) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		ctx, finish := observe(ctx, method)
+		return ctx, func(err error) {
+			finish(err)
+			cancel()
+		}
+	}
+}
+
+func (s *ObservedStore) start(ctx context.Context, method string) (context.Context, func(err *error)) {
+	ctx, finish := s.observe(ctx, method)
+	return ctx, func(err *error) { finish(*err) }
+}
+
+func (s *ObservedStore) Ping(ctx context.Context) (err error) {
+	ctx, done := s.start(ctx, "Ping")
+	defer done(&err)
+	return s.store.Ping(ctx)
+}
+
+func (s *ObservedStore) GetTeam(ctx context.Context, teamName string) (_ *models.Team, err error) {
+	ctx, done := s.start(ctx, "GetTeam")
+	defer done(&err)
+	return s.store.GetTeam(ctx, teamName)
+}
+
+func (s *ObservedStore) TeamExists(ctx context.Context, teamName string) (_ bool, err error) {
+	ctx, done := s.start(ctx, "TeamExists")
+	defer done(&err)
+	return s.store.TeamExists(ctx, teamName)
+}
+
+func (s *ObservedStore) CreateTeam(ctx context.Context, team *models.Team, audit models.Audit) (err error) {
+	ctx, done := s.start(ctx, "CreateTeam")
+	defer done(&err)
+	return s.store.CreateTeam(ctx, team, audit)
+}
+
+func (s *ObservedStore) GetTeamReviewerStrategy(ctx context.Context, teamName string) (_ string, err error) {
+	ctx, done := s.start(ctx, "GetTeamReviewerStrategy")
+	defer done(&err)
+	return s.store.GetTeamReviewerStrategy(ctx, teamName)
+}
+
+func (s *ObservedStore) SetTeamReviewerStrategy(
+	ctx context.Context, teamName, strategy string, version int64, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "SetTeamReviewerStrategy")
+	defer done(&err)
+	return s.store.SetTeamReviewerStrategy(ctx, teamName, strategy, version, audit)
+}
+
+func (s *ObservedStore) GetTeamDefaultReviewers(ctx context.Context, teamName string) (_ int, err error) {
+	ctx, done := s.start(ctx, "GetTeamDefaultReviewers")
+	defer done(&err)
+	return s.store.GetTeamDefaultReviewers(ctx, teamName)
+}
+
+func (s *ObservedStore) SetTeamDefaultReviewers(
+	ctx context.Context, teamName string, count int, version int64, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "SetTeamDefaultReviewers")
+	defer done(&err)
+	return s.store.SetTeamDefaultReviewers(ctx, teamName, count, version, audit)
+}
+
+func (s *ObservedStore) GetTeamCapacityFallback(ctx context.Context, teamName string) (_ string, err error) {
+	ctx, done := s.start(ctx, "GetTeamCapacityFallback")
+	defer done(&err)
+	return s.store.GetTeamCapacityFallback(ctx, teamName)
+}
+
+func (s *ObservedStore) SetTeamCapacityFallback(
+	ctx context.Context, teamName, fallback string, version int64, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "SetTeamCapacityFallback")
+	defer done(&err)
+	return s.store.SetTeamCapacityFallback(ctx, teamName, fallback, version, audit)
+}
+
+func (s *ObservedStore) BulkDeactivateTeamUsers(
+	ctx context.Context, teamName string, version int64, audit models.Audit,
+) (_ []string, err error) {
+	ctx, done := s.start(ctx, "BulkDeactivateTeamUsers")
+	defer done(&err)
+	return s.store.BulkDeactivateTeamUsers(ctx, teamName, version, audit)
+}
+
+func (s *ObservedStore) GetOpenPRsWithReviewers(
+	ctx context.Context, userIDs []string,
+) (_ []models.PullRequest, err error) {
+	ctx, done := s.start(ctx, "GetOpenPRsWithReviewers")
+	defer done(&err)
+	return s.store.GetOpenPRsWithReviewers(ctx, userIDs)
+}
+
+func (s *ObservedStore) GetActiveTeamMembersForReplacement(
+	ctx context.Context, teamName string, excludeUserIDs []string,
+) (_ []string, err error) {
+	ctx, done := s.start(ctx, "GetActiveTeamMembersForReplacement")
+	defer done(&err)
+	return s.store.GetActiveTeamMembersForReplacement(ctx, teamName, excludeUserIDs)
+}
+
+func (s *ObservedStore) BulkReassignReviewers(
+	ctx context.Context, plans map[string]models.ReviewerPlan, audit models.Audit,
+) (_ []string, err error) {
+	ctx, done := s.start(ctx, "BulkReassignReviewers")
+	defer done(&err)
+	return s.store.BulkReassignReviewers(ctx, plans, audit)
+}
+
+func (s *ObservedStore) GetTeamNameForUsers(ctx context.Context, userIDs []string) (_ map[string]string, err error) {
+	ctx, done := s.start(ctx, "GetTeamNameForUsers")
+	defer done(&err)
+	return s.store.GetTeamNameForUsers(ctx, userIDs)
+}
+
+func (s *ObservedStore) GetMergePolicy(ctx context.Context, teamName string) (_ *models.MergePolicy, err error) {
+	ctx, done := s.start(ctx, "GetMergePolicy")
+	defer done(&err)
+	return s.store.GetMergePolicy(ctx, teamName)
+}
+
+func (s *ObservedStore) SetMergePolicy(
+	ctx context.Context, policy *models.MergePolicy, version int64, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "SetMergePolicy")
+	defer done(&err)
+	return s.store.SetMergePolicy(ctx, policy, version, audit)
+}
+
+func (s *ObservedStore) GetUser(ctx context.Context, userID string) (_ *models.User, err error) {
+	ctx, done := s.start(ctx, "GetUser")
+	defer done(&err)
+	return s.store.GetUser(ctx, userID)
+}
+
+func (s *ObservedStore) SetUserActive(
+	ctx context.Context, userID string, isActive bool, version int64, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "SetUserActive")
+	defer done(&err)
+	return s.store.SetUserActive(ctx, userID, isActive, version, audit)
+}
+
+func (s *ObservedStore) SetUserRole(
+	ctx context.Context, userID, role string, version int64, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "SetUserRole")
+	defer done(&err)
+	return s.store.SetUserRole(ctx, userID, role, version, audit)
+}
+
+func (s *ObservedStore) SetUserMaxOpenReviews(
+	ctx context.Context, userID string, maxOpenReviews int, version int64, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "SetUserMaxOpenReviews")
+	defer done(&err)
+	return s.store.SetUserMaxOpenReviews(ctx, userID, maxOpenReviews, version, audit)
+}
+
+func (s *ObservedStore) GetMaxOpenReviews(ctx context.Context, userIDs []string) (_ map[string]int, err error) {
+	ctx, done := s.start(ctx, "GetMaxOpenReviews")
+	defer done(&err)
+	return s.store.GetMaxOpenReviews(ctx, userIDs)
+}
+
+func (s *ObservedStore) GetActiveTeamMembers(
+	ctx context.Context, teamName string, excludeUserID string,
+) (_ []string, err error) {
+	ctx, done := s.start(ctx, "GetActiveTeamMembers")
+	defer done(&err)
+	return s.store.GetActiveTeamMembers(ctx, teamName, excludeUserID)
+}
+
+func (s *ObservedStore) GetUserPullRequests(
+	ctx context.Context, userID string, awaitingOnly bool,
+) (_ []models.PullRequestShort, err error) {
+	ctx, done := s.start(ctx, "GetUserPullRequests")
+	defer done(&err)
+	return s.store.GetUserPullRequests(ctx, userID, awaitingOnly)
+}
+
+func (s *ObservedStore) GetOpenReviewCounts(ctx context.Context, userIDs []string) (_ map[string]int, err error) {
+	ctx, done := s.start(ctx, "GetOpenReviewCounts")
+	defer done(&err)
+	return s.store.GetOpenReviewCounts(ctx, userIDs)
+}
+
+func (s *ObservedStore) GetPullRequest(ctx context.Context, prID string) (_ *models.PullRequest, err error) {
+	ctx, done := s.start(ctx, "GetPullRequest")
+	defer done(&err)
+	return s.store.GetPullRequest(ctx, prID)
+}
+
+func (s *ObservedStore) PRExists(ctx context.Context, prID string) (_ bool, err error) {
+	ctx, done := s.start(ctx, "PRExists")
+	defer done(&err)
+	return s.store.PRExists(ctx, prID)
+}
+
+func (s *ObservedStore) CreatePullRequest(
+	ctx context.Context, prID, prName, authorID string, isDraft bool, reviewersCount int, reviewers []string,
+	audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "CreatePullRequest")
+	defer done(&err)
+	return s.store.CreatePullRequest(ctx, prID, prName, authorID, isDraft, reviewersCount, reviewers, audit)
+}
+
+func (s *ObservedStore) MergePullRequest(
+	ctx context.Context, prID string, version int64, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "MergePullRequest")
+	defer done(&err)
+	return s.store.MergePullRequest(ctx, prID, version, audit)
+}
+
+func (s *ObservedStore) ClosePullRequest(
+	ctx context.Context, prID string, version int64, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "ClosePullRequest")
+	defer done(&err)
+	return s.store.ClosePullRequest(ctx, prID, version, audit)
+}
+
+func (s *ObservedStore) ReopenPullRequest(
+	ctx context.Context, prID string, version int64, removedReviewers, addedReviewers []string, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "ReopenPullRequest")
+	defer done(&err)
+	return s.store.ReopenPullRequest(ctx, prID, version, removedReviewers, addedReviewers, audit)
+}
+
+func (s *ObservedStore) MarkPullRequestReady(
+	ctx context.Context, prID string, version int64, reviewers []string, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "MarkPullRequestReady")
+	defer done(&err)
+	return s.store.MarkPullRequestReady(ctx, prID, version, reviewers, audit)
+}
+
+func (s *ObservedStore) IsReviewerAssigned(ctx context.Context, prID, userID string) (_ bool, err error) {
+	ctx, done := s.start(ctx, "IsReviewerAssigned")
+	defer done(&err)
+	return s.store.IsReviewerAssigned(ctx, prID, userID)
+}
+
+func (s *ObservedStore) ReassignReviewer(
+	ctx context.Context, prID string, version int64, oldReviewerID, newReviewerID string, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "ReassignReviewer")
+	defer done(&err)
+	return s.store.ReassignReviewer(ctx, prID, version, oldReviewerID, newReviewerID, audit)
+}
+
+func (s *ObservedStore) SetReviewState(
+	ctx context.Context, prID string, version int64, reviewerID, state string, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "SetReviewState")
+	defer done(&err)
+	return s.store.SetReviewState(ctx, prID, version, reviewerID, state, audit)
+}
+
+func (s *ObservedStore) CreateAbsence(
+	ctx context.Context, absence *models.Absence, audit models.Audit,
+) (err error) {
+	ctx, done := s.start(ctx, "CreateAbsence")
+	defer done(&err)
+	return s.store.CreateAbsence(ctx, absence, audit)
+}
+
+func (s *ObservedStore) GetAbsence(ctx context.Context, absenceID int64) (_ *models.Absence, err error) {
+	ctx, done := s.start(ctx, "GetAbsence")
+	defer done(&err)
+	return s.store.GetAbsence(ctx, absenceID)
+}
+
+func (s *ObservedStore) GetUserAbsences(ctx context.Context, userID string) (_ []models.Absence, err error) {
+	ctx, done := s.start(ctx, "GetUserAbsences")
+	defer done(&err)
+	return s.store.GetUserAbsences(ctx, userID)
+}
+
+func (s *ObservedStore) CancelAbsence(ctx context.Context, absenceID int64, audit models.Audit) (err error) {
+	ctx, done := s.start(ctx, "CancelAbsence")
+	defer done(&err)
+	return s.store.CancelAbsence(ctx, absenceID, audit)
+}
+
+func (s *ObservedStore) GetStartedAbsencesToReassign(ctx context.Context) (_ []models.Absence, err error) {
+	ctx, done := s.start(ctx, "GetStartedAbsencesToReassign")
+	defer done(&err)
+	return s.store.GetStartedAbsencesToReassign(ctx)
+}
+
+func (s *ObservedStore) MarkAbsenceReassigned(ctx context.Context, absenceID int64) (err error) {
+	ctx, done := s.start(ctx, "MarkAbsenceReassigned")
+	defer done(&err)
+	return s.store.MarkAbsenceReassigned(ctx, absenceID)
+}
+
+func (s *ObservedStore) ReserveIdempotencyKey(
+	ctx context.Context, record *models.IdempotencyRecord,
+) (_ bool, err error) {
+	ctx, done := s.start(ctx, "ReserveIdempotencyKey")
+	defer done(&err)
+	return s.store.ReserveIdempotencyKey(ctx, record)
+}
+
+func (s *ObservedStore) GetIdempotencyKey(ctx context.Context, key string) (_ *models.IdempotencyRecord, err error) {
+	ctx, done := s.start(ctx, "GetIdempotencyKey")
+	defer done(&err)
+	return s.store.GetIdempotencyKey(ctx, key)
+}
+
+func (s *ObservedStore) CompleteIdempotencyKey(
+	ctx context.Context, key string, statusCode int, etag string, body []byte,
+) (err error) {
+	ctx, done := s.start(ctx, "CompleteIdempotencyKey")
+	defer done(&err)
+	return s.store.CompleteIdempotencyKey(ctx, key, statusCode, etag, body)
+}
+
+func (s *ObservedStore) DeleteIdempotencyKey(ctx context.Context, key string) (err error) {
+	ctx, done := s.start(ctx, "DeleteIdempotencyKey")
+	defer done(&err)
+	return s.store.DeleteIdempotencyKey(ctx, key)
+}
+
+func (s *ObservedStore) DeleteExpiredIdempotencyKeys(ctx context.Context) (_ int64, err error) {
+	ctx, done := s.start(ctx, "DeleteExpiredIdempotencyKeys")
+	defer done(&err)
+	return s.store.DeleteExpiredIdempotencyKeys(ctx)
+}
+
+func (s *ObservedStore) ListEvents(ctx context.Context, filter models.EventFilter) (_ []models.Event, err error) {
+	ctx, done := s.start(ctx, "ListEvents")
+	defer done(&err)
+	return s.store.ListEvents(ctx, filter)
+}
+
+func (s *ObservedStore) CreateWebhook(ctx context.Context, webhook *models.Webhook) (err error) {
+	ctx, done := s.start(ctx, "CreateWebhook")
+	defer done(&err)
+	return s.store.CreateWebhook(ctx, webhook)
+}
+
+func (s *ObservedStore) GetWebhook(ctx context.Context, webhookID int64) (_ *models.Webhook, err error) {
+	ctx, done := s.start(ctx, "GetWebhook")
+	defer done(&err)
+	return s.store.GetWebhook(ctx, webhookID)
+}
+
+func (s *ObservedStore) ListWebhooks(ctx context.Context) (_ []models.Webhook, err error) {
+	ctx, done := s.start(ctx, "ListWebhooks")
+	defer done(&err)
+	return s.store.ListWebhooks(ctx)
+}
+
+func (s *ObservedStore) DeleteWebhook(ctx context.Context, webhookID int64) (err error) {
+	ctx, done := s.start(ctx, "DeleteWebhook")
+	defer done(&err)
+	return s.store.DeleteWebhook(ctx, webhookID)
+}
+
+func (s *ObservedStore) ClaimWebhookDeliveries(
+	ctx context.Context, limit int, lease time.Duration,
+) (_ []models.WebhookDispatch, err error) {
+	ctx, done := s.start(ctx, "ClaimWebhookDeliveries")
+	defer done(&err)
+	return s.store.ClaimWebhookDeliveries(ctx, limit, lease)
+}
+
+func (s *ObservedStore) RecordWebhookAttempt(
+	ctx context.Context, deliveryID int64, attempt models.WebhookAttempt,
+) (err error) {
+	ctx, done := s.start(ctx, "RecordWebhookAttempt")
+	defer done(&err)
+	return s.store.RecordWebhookAttempt(ctx, deliveryID, attempt)
+}
+
+func (s *ObservedStore) RetryWebhookDelivery(ctx context.Context, deliveryID int64) (err error) {
+	ctx, done := s.start(ctx, "RetryWebhookDelivery")
+	defer done(&err)
+	return s.store.RetryWebhookDelivery(ctx, deliveryID)
+}
+
+func (s *ObservedStore) GetWebhookDelivery(
+	ctx context.Context, deliveryID int64,
+) (_ *models.WebhookDelivery, err error) {
+	ctx, done := s.start(ctx, "GetWebhookDelivery")
+	defer done(&err)
+	return s.store.GetWebhookDelivery(ctx, deliveryID)
+}
+
+func (s *ObservedStore) ListWebhookDeliveries(
+	ctx context.Context, filter models.WebhookDeliveryFilter,
+) (_ []models.WebhookDelivery, err error) {
+	ctx, done := s.start(ctx, "ListWebhookDeliveries")
+	defer done(&err)
+	return s.store.ListWebhookDeliveries(ctx, filter)
+}
+
+func (s *ObservedStore) SetExternalAccount(ctx context.Context, account *models.ExternalAccount) (err error) {
+	ctx, done := s.start(ctx, "SetExternalAccount")
+	defer done(&err)
+	return s.store.SetExternalAccount(ctx, account)
+}
+
+func (s *ObservedStore) GetExternalAccountUser(ctx context.Context, provider, login string) (_ string, err error) {
+	ctx, done := s.start(ctx, "GetExternalAccountUser")
+	defer done(&err)
+	return s.store.GetExternalAccountUser(ctx, provider, login)
+}
+
+func (s *ObservedStore) ListExternalAccounts(
+	ctx context.Context, provider string,
+) (_ []models.ExternalAccount, err error) {
+	ctx, done := s.start(ctx, "ListExternalAccounts")
+	defer done(&err)
+	return s.store.ListExternalAccounts(ctx, provider)
+}
+
+func (s *ObservedStore) CreateRejectedEvent(ctx context.Context, event *models.RejectedEvent) (err error) {
+	ctx, done := s.start(ctx, "CreateRejectedEvent")
+	defer done(&err)
+	return s.store.CreateRejectedEvent(ctx, event)
+}
+
+func (s *ObservedStore) ListRejectedEvents(
+	ctx context.Context, provider string, limit int,
+) (_ []models.RejectedEvent, err error) {
+	ctx, done := s.start(ctx, "ListRejectedEvents")
+	defer done(&err)
+	return s.store.ListRejectedEvents(ctx, provider, limit)
+}
+
+func (s *ObservedStore) CreateAPIToken(ctx context.Context, token *models.APIToken, hash string) (err error) {
+	ctx, done := s.start(ctx, "CreateAPIToken")
+	defer done(&err)
+	return s.store.CreateAPIToken(ctx, token, hash)
+}
+
+func (s *ObservedStore) GetAPITokenByHash(ctx context.Context, hash string) (_ *models.APIToken, err error) {
+	ctx, done := s.start(ctx, "GetAPITokenByHash")
+	defer done(&err)
+	return s.store.GetAPITokenByHash(ctx, hash)
+}
+
+func (s *ObservedStore) ListAPITokens(ctx context.Context) (_ []models.APIToken, err error) {
+	ctx, done := s.start(ctx, "ListAPITokens")
+	defer done(&err)
+	return s.store.ListAPITokens(ctx)
+}
+
+func (s *ObservedStore) RevokeAPIToken(ctx context.Context, tokenID int64) (err error) {
+	ctx, done := s.start(ctx, "RevokeAPIToken")
+	defer done(&err)
+	return s.store.RevokeAPIToken(ctx, tokenID)
+}
+
+func (s *ObservedStore) GetUserStats(ctx context.Context) (_ []models.UserStats, err error) {
+	ctx, done := s.start(ctx, "GetUserStats")
+	defer done(&err)
+	return s.store.GetUserStats(ctx)
+}
+
+func (s *ObservedStore) GetPRStats(ctx context.Context, drafts bool) (_ []models.PRStats, err error) {
+	ctx, done := s.start(ctx, "GetPRStats")
+	defer done(&err)
+	return s.store.GetPRStats(ctx, drafts)
+}
+
+func (s *ObservedStore) GetTotalUsersCount(ctx context.Context) (_ int, err error) {
+	ctx, done := s.start(ctx, "GetTotalUsersCount")
+	defer done(&err)
+	return s.store.GetTotalUsersCount(ctx)
+}
+
+func (s *ObservedStore) GetTotalPRsCount(ctx context.Context, drafts bool) (_ int, err error) {
+	ctx, done := s.start(ctx, "GetTotalPRsCount")
+	defer done(&err)
+	return s.store.GetTotalPRsCount(ctx, drafts)
+}
+
+func (s *ObservedStore) GetWorkload(ctx context.Context) (_ *models.Workload, err error) {
+	ctx, done := s.start(ctx, "GetWorkload")
+	defer done(&err)
+	return s.store.GetWorkload(ctx)
+}
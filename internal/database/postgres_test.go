@@ -0,0 +1,43 @@
+package database_test
+
+import (
+	"os"
+	"pr-review-service/internal/database"
+	"pr-review-service/internal/database/storetest"
+	"testing"
+)
+
+// TestPostgresConformance runs against the database in TEST_DATABASE_URL.
+// Every table is truncated between cases, so never point it at real data.
+func TestPostgresConformance(t *testing.T) {
+	connStr := os.Getenv("TEST_DATABASE_URL")
+	if connStr == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := database.NewDB(connStr)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	storetest.Run(t, func(t *testing.T) database.Store {
+		_, err := db.Exec(`
+			TRUNCATE teams, users, pull_requests, pr_reviewers, merge_policies, user_absences,
+				idempotency_keys, events, webhooks, webhook_deliveries, external_accounts,
+				rejected_events, api_tokens CASCADE
+		`)
+		if err != nil {
+			t.Fatalf("truncate: %v", err)
+		}
+		return db
+	})
+}
@@ -1,17 +1,19 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"pr-review-service/internal/models"
 	"time"
 )
 
-func (db *DB) GetPullRequest(prID string) (*models.PullRequest, error) {
+func (db *DB) GetPullRequest(ctx context.Context, prID string) (*models.PullRequest, error) {
 	pr := &models.PullRequest{}
-	var createdAt, mergedAt sql.NullTime
+	var createdAt, mergedAt, closedAt sql.NullTime
 
-	err := db.QueryRow(`
-		SELECT pull_request_id, pull_request_name, author_id, status, created_at, merged_at
+	err := db.QueryRowContext(ctx, `
+		SELECT pull_request_id, pull_request_name, author_id, status, is_draft, reviewers_count,
+			created_at, merged_at, closed_at, version
 		FROM pull_requests
 		WHERE pull_request_id = $1
 	`, prID).Scan(
@@ -19,8 +21,12 @@ func (db *DB) GetPullRequest(prID string) (*models.PullRequest, error) {
 		&pr.PullRequestName,
 		&pr.AuthorID,
 		&pr.Status,
+		&pr.IsDraft,
+		&pr.ReviewersCount,
 		&createdAt,
 		&mergedAt,
+		&closedAt,
+		&pr.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -32,9 +38,12 @@ func (db *DB) GetPullRequest(prID string) (*models.PullRequest, error) {
 	if mergedAt.Valid {
 		pr.MergedAt = &mergedAt.Time
 	}
+	if closedAt.Valid {
+		pr.ClosedAt = &closedAt.Time
+	}
 
-	rows, err := db.Query(`
-		SELECT reviewer_id 
+	rows, err := db.QueryContext(ctx, `
+		SELECT reviewer_id, review_state, reviewed_at
 		FROM pr_reviewers 
 		WHERE pull_request_id = $1
 		ORDER BY reviewer_id
@@ -44,91 +53,254 @@ func (db *DB) GetPullRequest(prID string) (*models.PullRequest, error) {
 	}
 	defer rows.Close()
 
+	pr.AssignedReviewers = []string{}
+	pr.Reviews = []models.Review{}
 	for rows.Next() {
-		var reviewerID string
-		if err := rows.Scan(&reviewerID); err != nil {
+		var review models.Review
+		var reviewedAt sql.NullTime
+		if err := rows.Scan(&review.ReviewerID, &review.State, &reviewedAt); err != nil {
 			return nil, err
 		}
-		pr.AssignedReviewers = append(pr.AssignedReviewers, reviewerID)
+		if reviewedAt.Valid {
+			review.ReviewedAt = &reviewedAt.Time
+		}
+		pr.AssignedReviewers = append(pr.AssignedReviewers, review.ReviewerID)
+		pr.Reviews = append(pr.Reviews, review)
 	}
 
-	return pr, nil
+	return pr, rows.Err()
 }
 
-func (db *DB) PRExists(prID string) (bool, error) {
+func (db *DB) PRExists(ctx context.Context, prID string) (bool, error) {
 	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pull_requests WHERE pull_request_id = $1)", prID).Scan(&exists)
+	err := db.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM pull_requests WHERE pull_request_id = $1)", prID,
+	).Scan(&exists)
 	return exists, err
 }
 
-func (db *DB) CreatePullRequest(prID, prName, authorID string, reviewers []string) error {
-	tx, err := db.Begin()
+func (db *DB) CreatePullRequest(
+	ctx context.Context, prID, prName, authorID string, isDraft bool, reviewersCount int, reviewers []string,
+	audit models.Audit,
+) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec(`
-		INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status)
-		VALUES ($1, $2, $3, 'OPEN')
-	`, prID, prName, authorID)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO pull_requests (pull_request_id, pull_request_name, author_id, status, is_draft, reviewers_count)
+		VALUES ($1, $2, $3, 'OPEN', $4, $5)
+	`, prID, prName, authorID, isDraft, reviewersCount)
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 
 	for _, reviewerID := range reviewers {
-		_, err = tx.Exec(`
+		_, err = tx.ExecContext(ctx, `
 			INSERT INTO pr_reviewers (pull_request_id, reviewer_id)
 			VALUES ($1, $2)
 		`, prID, reviewerID)
 		if err != nil {
-			return err
+			return translateError(err)
 		}
 	}
 
+	if err := insertEvents(ctx, tx, prCreatedEvents(audit, prID, prName, isDraft, reviewers)); err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
-func (db *DB) MergePullRequest(prID string) error {
-	now := time.Now()
-	_, err := db.Exec(`
+func (db *DB) MergePullRequest(ctx context.Context, prID string, version int64, audit models.Audit) error {
+	return db.updateWithEvents(ctx, []models.Event{prEvent(audit, models.EventPRMerged, prID)}, `
 		UPDATE pull_requests 
-		SET status = 'MERGED', merged_at = COALESCE(merged_at, $1)
-		WHERE pull_request_id = $2
-	`, now, prID)
-	return err
+		SET status = 'MERGED', merged_at = COALESCE(merged_at, $1), version = version + 1
+		WHERE pull_request_id = $2 AND ($3::BIGINT = 0 OR version = $3::BIGINT)
+	`, time.Now(), prID, version)
 }
 
-func (db *DB) IsReviewerAssigned(prID, userID string) (bool, error) {
+func (db *DB) ClosePullRequest(ctx context.Context, prID string, version int64, audit models.Audit) error {
+	return db.updateWithEvents(ctx, []models.Event{prEvent(audit, models.EventPRClosed, prID)}, `
+		UPDATE pull_requests
+		SET status = 'CLOSED', closed_at = $1, version = version + 1
+		WHERE pull_request_id = $2 AND status = 'OPEN' AND ($3::BIGINT = 0 OR version = $3::BIGINT)
+	`, time.Now(), prID, version)
+}
+
+func (db *DB) ReopenPullRequest(
+	ctx context.Context, prID string, version int64, removedReviewers, addedReviewers []string, audit models.Audit,
+) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE pull_requests
+		SET status = 'OPEN', closed_at = NULL, version = version + 1
+		WHERE pull_request_id = $1 AND status = 'CLOSED' AND ($2::BIGINT = 0 OR version = $2::BIGINT)
+	`, prID, version)
+	if err != nil {
+		return translateError(err)
+	}
+	if err := expectRow(result); err != nil {
+		return err
+	}
+
+	for _, reviewerID := range removedReviewers {
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM pr_reviewers
+			WHERE pull_request_id = $1 AND reviewer_id = $2
+		`, prID, reviewerID)
+		if err != nil {
+			return translateError(err)
+		}
+	}
+
+	for _, reviewerID := range addedReviewers {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO pr_reviewers (pull_request_id, reviewer_id)
+			VALUES ($1, $2)
+			ON CONFLICT (pull_request_id, reviewer_id) DO NOTHING
+		`, prID, reviewerID)
+		if err != nil {
+			return translateError(err)
+		}
+	}
+
+	if err := insertEvents(ctx, tx, reopenEvents(audit, prID, removedReviewers, addedReviewers)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) MarkPullRequestReady(
+	ctx context.Context, prID string, version int64, reviewers []string, audit models.Audit,
+) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE pull_requests
+		SET is_draft = false, version = version + 1
+		WHERE pull_request_id = $1 AND ($2::BIGINT = 0 OR version = $2::BIGINT)
+	`, prID, version)
+	if err != nil {
+		return translateError(err)
+	}
+	if err := expectRow(result); err != nil {
+		return err
+	}
+
+	for _, reviewerID := range reviewers {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO pr_reviewers (pull_request_id, reviewer_id)
+			VALUES ($1, $2)
+			ON CONFLICT (pull_request_id, reviewer_id) DO NOTHING
+		`, prID, reviewerID)
+		if err != nil {
+			return translateError(err)
+		}
+	}
+
+	if err := insertEvents(ctx, tx, readyEvents(audit, prID, reviewers)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) IsReviewerAssigned(ctx context.Context, prID, userID string) (bool, error) {
 	var exists bool
-	err := db.QueryRow(`
+	err := db.QueryRowContext(ctx, `
 		SELECT EXISTS(SELECT 1 FROM pr_reviewers WHERE pull_request_id = $1 AND reviewer_id = $2)
 	`, prID, userID).Scan(&exists)
 	return exists, err
 }
 
-func (db *DB) ReassignReviewer(prID, oldReviewerID, newReviewerID string) error {
-	tx, err := db.Begin()
+func (db *DB) ReassignReviewer(
+	ctx context.Context, prID string, version int64, oldReviewerID, newReviewerID string, audit models.Audit,
+) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec(`
+	if err := bumpPullRequestVersion(ctx, tx, prID, version); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
 		DELETE FROM pr_reviewers 
 		WHERE pull_request_id = $1 AND reviewer_id = $2
 	`, prID, oldReviewerID)
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 
-	_, err = tx.Exec(`
+	_, err = tx.ExecContext(ctx, `
 		INSERT INTO pr_reviewers (pull_request_id, reviewer_id)
 		VALUES ($1, $2)
 	`, prID, newReviewerID)
 	if err != nil {
+		return translateError(err)
+	}
+
+	if err := insertEvents(ctx, tx, reassignEvents(audit, prID, oldReviewerID, newReviewerID)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) SetReviewState(
+	ctx context.Context, prID string, version int64, reviewerID, state string, audit models.Audit,
+) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := bumpPullRequestVersion(ctx, tx, prID, version); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE pr_reviewers
+		SET review_state = $1, reviewed_at = $2
+		WHERE pull_request_id = $3 AND reviewer_id = $4
+	`, state, time.Now(), prID, reviewerID)
+	if err != nil {
+		return err
+	}
+
+	if err := insertEvents(ctx, tx, []models.Event{reviewEvent(audit, prID, reviewerID, state)}); err != nil {
 		return err
 	}
 
 	return tx.Commit()
 }
+
+// bumpPullRequestVersion claims the PR row for a write that only touches its
+// reviewers, so concurrent writers still conflict on the version.
+func bumpPullRequestVersion(ctx context.Context, tx *sql.Tx, prID string, version int64) error {
+	result, err := tx.ExecContext(ctx, `
+		UPDATE pull_requests
+		SET version = version + 1
+		WHERE pull_request_id = $1 AND ($2::BIGINT = 0 OR version = $2::BIGINT)
+	`, prID, version)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
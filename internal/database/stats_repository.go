@@ -1,15 +1,22 @@
 package database
 
-import "pr-review-service/internal/models"
+import (
+	"context"
+	"pr-review-service/internal/models"
+)
 
-func (db *DB) GetUserStats() ([]models.UserStats, error) {
-	rows, err := db.Query(`
+func (db *DB) GetUserStats(ctx context.Context) ([]models.UserStats, error) {
+	rows, err := db.QueryContext(ctx, `
 		SELECT 
 			u.user_id,
 			u.username,
 			COALESCE(COUNT(prr.reviewer_id), 0) as assigned_prs_count
 		FROM users u
 		LEFT JOIN pr_reviewers prr ON u.user_id = prr.reviewer_id
+			AND NOT EXISTS (
+				SELECT 1 FROM pull_requests pr
+				WHERE pr.pull_request_id = prr.pull_request_id AND pr.status = 'CLOSED'
+			)
 		GROUP BY u.user_id, u.username
 		ORDER BY assigned_prs_count DESC, u.user_id
 	`)
@@ -30,8 +37,8 @@ func (db *DB) GetUserStats() ([]models.UserStats, error) {
 	return stats, nil
 }
 
-func (db *DB) GetPRStats() ([]models.PRStats, error) {
-	rows, err := db.Query(`
+func (db *DB) GetPRStats(ctx context.Context, drafts bool) ([]models.PRStats, error) {
+	rows, err := db.QueryContext(ctx, `
 		SELECT 
 			pr.pull_request_id,
 			pr.pull_request_name,
@@ -39,9 +46,10 @@ func (db *DB) GetPRStats() ([]models.PRStats, error) {
 			pr.status
 		FROM pull_requests pr
 		LEFT JOIN pr_reviewers prr ON pr.pull_request_id = prr.pull_request_id
+		WHERE pr.is_draft = $1
 		GROUP BY pr.pull_request_id, pr.pull_request_name, pr.status
 		ORDER BY reviewers_count DESC, pr.pull_request_id
-	`)
+	`, drafts)
 	if err != nil {
 		return nil, err
 	}
@@ -59,14 +67,49 @@ func (db *DB) GetPRStats() ([]models.PRStats, error) {
 	return stats, nil
 }
 
-func (db *DB) GetTotalUsersCount() (int, error) {
+func (db *DB) GetTotalUsersCount(ctx context.Context) (int, error) {
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
 	return count, err
 }
 
-func (db *DB) GetTotalPRsCount() (int, error) {
+func (db *DB) GetTotalPRsCount(ctx context.Context, drafts bool) (int, error) {
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM pull_requests").Scan(&count)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM pull_requests WHERE is_draft = $1", drafts).Scan(&count)
 	return count, err
 }
+
+func (db *DB) GetWorkload(ctx context.Context) (*models.Workload, error) {
+	workload := &models.Workload{OpenReviews: make(map[string]int)}
+	err := db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM pull_requests WHERE status = 'OPEN'),
+			(SELECT COUNT(*) FROM users WHERE is_active)
+	`).Scan(&workload.OpenPRs, &workload.ActiveUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT prr.reviewer_id, COUNT(*)
+		FROM pr_reviewers prr
+		INNER JOIN pull_requests pr ON pr.pull_request_id = prr.pull_request_id
+		WHERE pr.status = 'OPEN' AND NOT pr.is_draft
+		GROUP BY prr.reviewer_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		var count int
+		if err := rows.Scan(&userID, &count); err != nil {
+			return nil, err
+		}
+		workload.OpenReviews[userID] = count
+	}
+
+	return workload, rows.Err()
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"pr-review-service/internal/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrUniqueViolation     = errors.New("unique violation")
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	ErrVersionConflict     = errors.New("version conflict")
+)
+
+// Store is everything the service layer needs from persistence. Lookups of a
+// single missing row return sql.ErrNoRows; constraint failures wrap
+// ErrUniqueViolation or ErrForeignKeyViolation.
+//
+// Pull requests, teams and users carry a version that every write bumps.
+// Methods taking a version only apply when the row still has that version and
+// return ErrVersionConflict otherwise (or when the row is gone); version 0
+// skips the check.
+//
+// Every mutating method appends audit events describing the change, stamped
+// with the given Audit, in the same transaction as the change itself.
+type Store interface {
+	Ping(ctx context.Context) error
+
+	GetTeam(ctx context.Context, teamName string) (*models.Team, error)
+	TeamExists(ctx context.Context, teamName string) (bool, error)
+	CreateTeam(ctx context.Context, team *models.Team, audit models.Audit) error
+	GetTeamReviewerStrategy(ctx context.Context, teamName string) (string, error)
+	SetTeamReviewerStrategy(ctx context.Context, teamName, strategy string, version int64, audit models.Audit) error
+	GetTeamDefaultReviewers(ctx context.Context, teamName string) (int, error)
+	SetTeamDefaultReviewers(ctx context.Context, teamName string, count int, version int64, audit models.Audit) error
+	GetTeamCapacityFallback(ctx context.Context, teamName string) (string, error)
+	SetTeamCapacityFallback(ctx context.Context, teamName, fallback string, version int64, audit models.Audit) error
+	BulkDeactivateTeamUsers(ctx context.Context, teamName string, version int64, audit models.Audit) ([]string, error)
+	GetOpenPRsWithReviewers(ctx context.Context, userIDs []string) ([]models.PullRequest, error)
+	GetActiveTeamMembersForReplacement(ctx context.Context, teamName string, excludeUserIDs []string) ([]string, error)
+	// BulkReassignReviewers applies the plans keyed by PR ID and returns the
+	// PRs it changed. A PR no longer OPEN or no longer at the plan's version is
+	// skipped rather than failing the others.
+	BulkReassignReviewers(
+		ctx context.Context, plans map[string]models.ReviewerPlan, audit models.Audit,
+	) ([]string, error)
+	GetTeamNameForUsers(ctx context.Context, userIDs []string) (map[string]string, error)
+
+	GetMergePolicy(ctx context.Context, teamName string) (*models.MergePolicy, error)
+	SetMergePolicy(ctx context.Context, policy *models.MergePolicy, version int64, audit models.Audit) error
+
+	GetUser(ctx context.Context, userID string) (*models.User, error)
+	SetUserActive(ctx context.Context, userID string, isActive bool, version int64, audit models.Audit) error
+	SetUserRole(ctx context.Context, userID, role string, version int64, audit models.Audit) error
+	SetUserMaxOpenReviews(ctx context.Context, userID string, maxOpenReviews int, version int64, audit models.Audit) error
+	GetMaxOpenReviews(ctx context.Context, userIDs []string) (map[string]int, error)
+	GetActiveTeamMembers(ctx context.Context, teamName string, excludeUserID string) ([]string, error)
+	GetUserPullRequests(ctx context.Context, userID string, awaitingOnly bool) ([]models.PullRequestShort, error)
+	GetOpenReviewCounts(ctx context.Context, userIDs []string) (map[string]int, error)
+
+	GetPullRequest(ctx context.Context, prID string) (*models.PullRequest, error)
+	PRExists(ctx context.Context, prID string) (bool, error)
+	CreatePullRequest(
+		ctx context.Context, prID, prName, authorID string, isDraft bool, reviewersCount int, reviewers []string,
+		audit models.Audit,
+	) error
+	MergePullRequest(ctx context.Context, prID string, version int64, audit models.Audit) error
+	ClosePullRequest(ctx context.Context, prID string, version int64, audit models.Audit) error
+	ReopenPullRequest(
+		ctx context.Context, prID string, version int64, removedReviewers, addedReviewers []string, audit models.Audit,
+	) error
+	MarkPullRequestReady(ctx context.Context, prID string, version int64, reviewers []string, audit models.Audit) error
+	IsReviewerAssigned(ctx context.Context, prID, userID string) (bool, error)
+	ReassignReviewer(
+		ctx context.Context, prID string, version int64, oldReviewerID, newReviewerID string, audit models.Audit,
+	) error
+	SetReviewState(ctx context.Context, prID string, version int64, reviewerID, state string, audit models.Audit) error
+
+	CreateAbsence(ctx context.Context, absence *models.Absence, audit models.Audit) error
+	GetAbsence(ctx context.Context, absenceID int64) (*models.Absence, error)
+	GetUserAbsences(ctx context.Context, userID string) ([]models.Absence, error)
+	CancelAbsence(ctx context.Context, absenceID int64, audit models.Audit) error
+	GetStartedAbsencesToReassign(ctx context.Context) ([]models.Absence, error)
+	MarkAbsenceReassigned(ctx context.Context, absenceID int64) error
+
+	ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord) (bool, error)
+	GetIdempotencyKey(ctx context.Context, key string) (*models.IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, etag string, body []byte) error
+	DeleteIdempotencyKey(ctx context.Context, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+
+	ListEvents(ctx context.Context, filter models.EventFilter) ([]models.Event, error)
+
+	// Creating an event queues a PENDING delivery for every webhook
+	// subscribed to its type.
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	GetWebhook(ctx context.Context, webhookID int64) (*models.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookID int64) error
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDispatch, error)
+	RecordWebhookAttempt(ctx context.Context, deliveryID int64, attempt models.WebhookAttempt) error
+	RetryWebhookDelivery(ctx context.Context, deliveryID int64) error
+	GetWebhookDelivery(ctx context.Context, deliveryID int64) (*models.WebhookDelivery, error)
+	ListWebhookDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error)
+
+	SetExternalAccount(ctx context.Context, account *models.ExternalAccount) error
+	GetExternalAccountUser(ctx context.Context, provider, login string) (string, error)
+	ListExternalAccounts(ctx context.Context, provider string) ([]models.ExternalAccount, error)
+	CreateRejectedEvent(ctx context.Context, event *models.RejectedEvent) error
+	ListRejectedEvents(ctx context.Context, provider string, limit int) ([]models.RejectedEvent, error)
+
+	// API tokens are looked up by the SHA-256 hash of their secret.
+	CreateAPIToken(ctx context.Context, token *models.APIToken, hash string) error
+	GetAPITokenByHash(ctx context.Context, hash string) (*models.APIToken, error)
+	ListAPITokens(ctx context.Context) ([]models.APIToken, error)
+	RevokeAPIToken(ctx context.Context, tokenID int64) error
+
+	GetUserStats(ctx context.Context) ([]models.UserStats, error)
+	GetPRStats(ctx context.Context, drafts bool) ([]models.PRStats, error)
+	GetTotalUsersCount(ctx context.Context) (int, error)
+	GetTotalPRsCount(ctx context.Context, drafts bool) (int, error)
+	GetWorkload(ctx context.Context) (*models.Workload, error)
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
+
+// translateError maps PostgreSQL constraint errors onto the Store sentinels.
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code {
+	case "23505":
+		return fmt.Errorf("%w: %s", ErrUniqueViolation, pqErr.Message)
+	case "23503":
+		return fmt.Errorf("%w: %s", ErrForeignKeyViolation, pqErr.Message)
+	}
+	return err
+}
+
+// IsCanceled reports whether err comes from a cancelled or expired context,
+// including PostgreSQL aborting a statement on the driver's cancel request.
+func IsCanceled(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014"
+}
+
+// expectRow turns an update that matched no row into ErrVersionConflict.
+func expectRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
@@ -0,0 +1,1151 @@
+// Package storetest holds the conformance suite every database.Store
+// implementation must pass.
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"pr-review-service/internal/database"
+	"pr-review-service/internal/models"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Run executes the suite. newStore must return an empty store for every call.
+func Run(t *testing.T, newStore func(t *testing.T) database.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store database.Store)
+	}{
+		{"Teams", testTeams},
+		{"TeamSettings", testTeamSettings},
+		{"Users", testUsers},
+		{"PullRequestLifecycle", testPullRequestLifecycle},
+		{"PullRequestConstraints", testPullRequestConstraints},
+		{"Reviews", testReviews},
+		{"ReviewLoad", testReviewLoad},
+		{"BulkDeactivation", testBulkDeactivation},
+		{"Absences", testAbsences},
+		{"MergePolicies", testMergePolicies},
+		{"Versions", testVersions},
+		{"IdempotencyKeys", testIdempotencyKeys},
+		{"Events", testEvents},
+		{"Webhooks", testWebhooks},
+		{"ExternalAccounts", testExternalAccounts},
+		{"RejectedEvents", testRejectedEvents},
+		{"APITokens", testAPITokens},
+		{"Stats", testStats},
+		{"ConcurrentCreate", testConcurrentCreate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// noAudit stamps changes whose events a test does not inspect.
+var noAudit models.Audit
+
+// ctx is passed to every call; the suite does not exercise cancellation.
+var ctx = context.Background()
+
+func seedTeam(t *testing.T, store database.Store, teamName string, userIDs ...string) {
+	t.Helper()
+
+	team := &models.Team{TeamName: teamName}
+	for _, userID := range userIDs {
+		team.Members = append(team.Members, models.TeamMember{UserID: userID, Username: "name-" + userID, IsActive: true})
+	}
+	if err := store.CreateTeam(ctx, team, noAudit); err != nil {
+		t.Fatalf("CreateTeam(%s): %v", teamName, err)
+	}
+}
+
+func mustPR(t *testing.T, store database.Store, prID string) *models.PullRequest {
+	t.Helper()
+
+	pr, err := store.GetPullRequest(ctx, prID)
+	if err != nil {
+		t.Fatalf("GetPullRequest(%s): %v", prID, err)
+	}
+	return pr
+}
+
+func expectStrings(t *testing.T, what string, got, want []string) {
+	t.Helper()
+
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func sorted(values []string) []string {
+	out := append([]string(nil), values...)
+	sort.Strings(out)
+	return out
+}
+
+func testTeams(t *testing.T, store database.Store) {
+	if _, err := store.GetTeam(ctx, "backend"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetTeam on empty store: err = %v, want sql.ErrNoRows", err)
+	}
+
+	seedTeam(t, store, "backend", "u3", "u1", "u2")
+
+	exists, err := store.TeamExists(ctx, "backend")
+	if err != nil || !exists {
+		t.Fatalf("TeamExists = %v, %v", exists, err)
+	}
+
+	team, err := store.GetTeam(ctx, "backend")
+	if err != nil {
+		t.Fatalf("GetTeam: %v", err)
+	}
+	var ids []string
+	for _, member := range team.Members {
+		ids = append(ids, member.UserID)
+	}
+	expectStrings(t, "members", ids, []string{"u1", "u2", "u3"})
+
+	seedTeam(t, store, "frontend", "u2", "u4")
+	user, err := store.GetUser(ctx, "u2")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if user.TeamName != "frontend" {
+		t.Fatalf("u2 team = %s, want frontend after re-adding", user.TeamName)
+	}
+	left, err := store.GetTeam(ctx, "backend")
+	if err != nil || left.Version != team.Version+1 {
+		t.Fatalf("GetTeam(backend) = %+v, %v; want version %d after u2 moved away", left, err, team.Version+1)
+	}
+	events, err := store.ListEvents(ctx, models.EventFilter{TeamName: "backend", Type: models.EventTeamUpdated})
+	if err != nil || len(events) != 1 || events[0].Details["members_removed"] != "u2" {
+		t.Fatalf("backend update events = %+v, %v; want one removing u2", events, err)
+	}
+
+	teams, err := store.GetTeamNameForUsers(ctx, []string{"u1", "u2", "missing"})
+	if err != nil {
+		t.Fatalf("GetTeamNameForUsers: %v", err)
+	}
+	want := map[string]string{"u1": "backend", "u2": "frontend"}
+	if !reflect.DeepEqual(teams, want) {
+		t.Fatalf("GetTeamNameForUsers = %v, want %v", teams, want)
+	}
+}
+
+func testTeamSettings(t *testing.T, store database.Store) {
+	if err := store.CreateTeam(ctx, &models.Team{
+		TeamName:         "platform",
+		Members:          []models.TeamMember{{UserID: "p1", Username: "P1", IsActive: true}},
+		ReviewerStrategy: "least_loaded",
+		DefaultReviewers: 3,
+	}, noAudit); err != nil {
+		t.Fatalf("CreateTeam: %v", err)
+	}
+
+	strategy, err := store.GetTeamReviewerStrategy(ctx, "platform")
+	if err != nil || strategy != "least_loaded" {
+		t.Fatalf("GetTeamReviewerStrategy = %q, %v", strategy, err)
+	}
+	count, err := store.GetTeamDefaultReviewers(ctx, "platform")
+	if err != nil || count != 3 {
+		t.Fatalf("GetTeamDefaultReviewers = %d, %v", count, err)
+	}
+
+	if err := store.SetTeamReviewerStrategy(ctx, "platform", "", 0, noAudit); err != nil {
+		t.Fatalf("SetTeamReviewerStrategy: %v", err)
+	}
+	if err := store.SetTeamDefaultReviewers(ctx, "platform", 0, 0, noAudit); err != nil {
+		t.Fatalf("SetTeamDefaultReviewers: %v", err)
+	}
+	if err := store.SetTeamCapacityFallback(ctx, "platform", "error", 0, noAudit); err != nil {
+		t.Fatalf("SetTeamCapacityFallback: %v", err)
+	}
+
+	team, err := store.GetTeam(ctx, "platform")
+	if err != nil {
+		t.Fatalf("GetTeam: %v", err)
+	}
+	if team.ReviewerStrategy != "" || team.DefaultReviewers != 0 || team.CapacityFallback != "error" {
+		t.Fatalf("team settings = %+v", team)
+	}
+
+	strategy, err = store.GetTeamReviewerStrategy(ctx, "missing")
+	if err != nil || strategy != "" {
+		t.Fatalf("GetTeamReviewerStrategy(missing) = %q, %v", strategy, err)
+	}
+}
+
+func testUsers(t *testing.T, store database.Store) {
+	if _, err := store.GetUser(ctx, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetUser(nobody): err = %v, want sql.ErrNoRows", err)
+	}
+
+	seedTeam(t, store, "backend", "u1", "u2", "u3", "u4")
+
+	if err := store.SetUserActive(ctx, "u3", false, 0, noAudit); err != nil {
+		t.Fatalf("SetUserActive: %v", err)
+	}
+	members, err := store.GetActiveTeamMembers(ctx, "backend", "u1")
+	if err != nil {
+		t.Fatalf("GetActiveTeamMembers: %v", err)
+	}
+	expectStrings(t, "active members", members, []string{"u2", "u4"})
+
+	members, err = store.GetActiveTeamMembersForReplacement(ctx, "backend", []string{"u2"})
+	if err != nil {
+		t.Fatalf("GetActiveTeamMembersForReplacement: %v", err)
+	}
+	expectStrings(t, "replacement members", members, []string{"u1", "u4"})
+
+	if err := store.SetUserMaxOpenReviews(ctx, "u2", 3, 0, noAudit); err != nil {
+		t.Fatalf("SetUserMaxOpenReviews: %v", err)
+	}
+	limits, err := store.GetMaxOpenReviews(ctx, []string{"u1", "u2"})
+	if err != nil {
+		t.Fatalf("GetMaxOpenReviews: %v", err)
+	}
+	if !reflect.DeepEqual(limits, map[string]int{"u2": 3}) {
+		t.Fatalf("GetMaxOpenReviews = %v", limits)
+	}
+
+	user, err := store.GetUser(ctx, "u2")
+	if err != nil || user.MaxOpenReviews != 3 || user.Role != models.RoleMember {
+		t.Fatalf("GetUser(u2) = %+v, %v", user, err)
+	}
+
+	before, err := store.GetTeam(ctx, "backend")
+	if err != nil {
+		t.Fatalf("GetTeam: %v", err)
+	}
+	if err := store.SetUserRole(ctx, "u1", models.RoleLead, 0, noAudit); err != nil {
+		t.Fatalf("SetUserRole: %v", err)
+	}
+	after, err := store.GetTeam(ctx, "backend")
+	if err != nil || after.Members[0].Role != models.RoleLead || after.Version <= before.Version {
+		t.Fatalf("GetTeam after SetUserRole = %+v, %v; want u1 lead and a new team version", after, err)
+	}
+
+	seedTeam(t, store, "platform", "u1")
+	if user, err := store.GetUser(ctx, "u1"); err != nil || user.Role != models.RoleLead {
+		t.Fatalf("GetUser(u1) after re-adding without a role = %+v, %v; want the lead role kept", user, err)
+	}
+}
+
+func testPullRequestLifecycle(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "u1", "u2", "u3", "u4")
+
+	err := store.CreatePullRequest(ctx, "pr-1", "Add search", "u1", false, 2, []string{"u3", "u2"}, noAudit)
+	if err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+
+	pr := mustPR(t, store, "pr-1")
+	if pr.Status != models.StatusOpen || pr.CreatedAt == nil || pr.ReviewersCount != 2 {
+		t.Fatalf("created PR = %+v", pr)
+	}
+	expectStrings(t, "reviewers", pr.AssignedReviewers, []string{"u2", "u3"})
+	for _, review := range pr.Reviews {
+		if review.State != models.ReviewStatePending {
+			t.Fatalf("initial review state = %s", review.State)
+		}
+	}
+
+	if err := store.ReassignReviewer(ctx, "pr-1", 0, "u2", "u4", noAudit); err != nil {
+		t.Fatalf("ReassignReviewer: %v", err)
+	}
+	expectStrings(t, "reviewers after reassign", mustPR(t, store, "pr-1").AssignedReviewers, []string{"u3", "u4"})
+
+	if err := store.ClosePullRequest(ctx, "pr-1", 0, noAudit); err != nil {
+		t.Fatalf("ClosePullRequest: %v", err)
+	}
+	pr = mustPR(t, store, "pr-1")
+	if pr.Status != models.StatusClosed || pr.ClosedAt == nil {
+		t.Fatalf("closed PR = %+v", pr)
+	}
+
+	if err := store.ReopenPullRequest(ctx, "pr-1", 0, []string{"u4"}, []string{"u2"}, noAudit); err != nil {
+		t.Fatalf("ReopenPullRequest: %v", err)
+	}
+	pr = mustPR(t, store, "pr-1")
+	if pr.Status != models.StatusOpen || pr.ClosedAt != nil {
+		t.Fatalf("reopened PR = %+v", pr)
+	}
+	expectStrings(t, "reviewers after reopen", pr.AssignedReviewers, []string{"u2", "u3"})
+
+	if err := store.MergePullRequest(ctx, "pr-1", 0, noAudit); err != nil {
+		t.Fatalf("MergePullRequest: %v", err)
+	}
+	pr = mustPR(t, store, "pr-1")
+	if pr.Status != models.StatusMerged || pr.MergedAt == nil {
+		t.Fatalf("merged PR = %+v", pr)
+	}
+	mergedAt := *pr.MergedAt
+	if err := store.MergePullRequest(ctx, "pr-1", 0, noAudit); err != nil {
+		t.Fatalf("second MergePullRequest: %v", err)
+	}
+	if !mustPR(t, store, "pr-1").MergedAt.Equal(mergedAt) {
+		t.Fatalf("merged_at changed on repeated merge")
+	}
+
+	if err := store.CreatePullRequest(ctx, "pr-2", "Draft", "u1", true, 3, nil, noAudit); err != nil {
+		t.Fatalf("CreatePullRequest(draft): %v", err)
+	}
+	if err := store.MarkPullRequestReady(ctx, "pr-2", 0, []string{"u2", "u3"}, noAudit); err != nil {
+		t.Fatalf("MarkPullRequestReady: %v", err)
+	}
+	pr = mustPR(t, store, "pr-2")
+	if pr.IsDraft || pr.ReviewersCount != 3 {
+		t.Fatalf("ready PR = %+v", pr)
+	}
+	expectStrings(t, "reviewers after ready", pr.AssignedReviewers, []string{"u2", "u3"})
+}
+
+func testPullRequestConstraints(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "u1", "u2", "u3")
+
+	if _, err := store.GetPullRequest(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetPullRequest(missing): err = %v, want sql.ErrNoRows", err)
+	}
+
+	if err := store.CreatePullRequest(ctx, "pr-1", "First", "u1", false, 2, []string{"u2"}, noAudit); err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+	exists, err := store.PRExists(ctx, "pr-1")
+	if err != nil || !exists {
+		t.Fatalf("PRExists = %v, %v", exists, err)
+	}
+
+	err = store.CreatePullRequest(ctx, "pr-1", "Duplicate", "u1", false, 2, nil, noAudit)
+	if !errors.Is(err, database.ErrUniqueViolation) {
+		t.Fatalf("duplicate CreatePullRequest: err = %v, want ErrUniqueViolation", err)
+	}
+	if mustPR(t, store, "pr-1").PullRequestName != "First" {
+		t.Fatalf("duplicate create overwrote the PR")
+	}
+
+	err = store.CreatePullRequest(ctx, "pr-2", "Ghost author", "ghost", false, 2, nil, noAudit)
+	if !errors.Is(err, database.ErrForeignKeyViolation) {
+		t.Fatalf("CreatePullRequest(unknown author): err = %v, want ErrForeignKeyViolation", err)
+	}
+
+	err = store.CreatePullRequest(ctx, "pr-3", "Ghost reviewer", "u1", false, 2, []string{"u2", "ghost"}, noAudit)
+	if !errors.Is(err, database.ErrForeignKeyViolation) {
+		t.Fatalf("CreatePullRequest(unknown reviewer): err = %v, want ErrForeignKeyViolation", err)
+	}
+	if exists, _ := store.PRExists(ctx, "pr-3"); exists {
+		t.Fatalf("failed create left a partial PR behind")
+	}
+
+	if err := store.CreatePullRequest(ctx, "pr-4", "Pair", "u1", false, 2, []string{"u2", "u3"}, noAudit); err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+	err = store.ReassignReviewer(ctx, "pr-4", 0, "u2", "u3", noAudit)
+	if !errors.Is(err, database.ErrUniqueViolation) {
+		t.Fatalf("ReassignReviewer onto existing reviewer: err = %v, want ErrUniqueViolation", err)
+	}
+	expectStrings(t, "reviewers after failed reassign", mustPR(t, store, "pr-4").AssignedReviewers, []string{"u2", "u3"})
+
+	err = store.ReassignReviewer(ctx, "pr-4", 0, "u2", "ghost", noAudit)
+	if !errors.Is(err, database.ErrForeignKeyViolation) {
+		t.Fatalf("ReassignReviewer(unknown user): err = %v, want ErrForeignKeyViolation", err)
+	}
+}
+
+func testReviews(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "u1", "u2", "u3")
+
+	for _, prID := range []string{"pr-b", "pr-a", "pr-c"} {
+		if err := store.CreatePullRequest(ctx, prID, prID, "u1", false, 2, []string{"u2", "u3"}, noAudit); err != nil {
+			t.Fatalf("CreatePullRequest(%s): %v", prID, err)
+		}
+	}
+
+	assigned, err := store.IsReviewerAssigned(ctx, "pr-a", "u2")
+	if err != nil || !assigned {
+		t.Fatalf("IsReviewerAssigned = %v, %v", assigned, err)
+	}
+	assigned, err = store.IsReviewerAssigned(ctx, "pr-a", "u1")
+	if err != nil || assigned {
+		t.Fatalf("IsReviewerAssigned(author) = %v, %v", assigned, err)
+	}
+
+	if err := store.SetReviewState(ctx, "pr-a", 0, "u2", models.ReviewStateApproved, noAudit); err != nil {
+		t.Fatalf("SetReviewState: %v", err)
+	}
+	if err := store.SetReviewState(ctx, "pr-b", 0, "u2", models.ReviewStateCommented, noAudit); err != nil {
+		t.Fatalf("SetReviewState: %v", err)
+	}
+	if err := store.ClosePullRequest(ctx, "pr-c", 0, noAudit); err != nil {
+		t.Fatalf("ClosePullRequest: %v", err)
+	}
+
+	for _, review := range mustPR(t, store, "pr-a").Reviews {
+		if review.ReviewerID == "u2" && (review.State != models.ReviewStateApproved || review.ReviewedAt == nil) {
+			t.Fatalf("review after approve = %+v", review)
+		}
+	}
+
+	prs, err := store.GetUserPullRequests(ctx, "u2", false)
+	if err != nil {
+		t.Fatalf("GetUserPullRequests: %v", err)
+	}
+	var ids []string
+	for _, pr := range prs {
+		ids = append(ids, pr.PullRequestID)
+	}
+	expectStrings(t, "user PRs", ids, []string{"pr-a", "pr-b"})
+
+	prs, err = store.GetUserPullRequests(ctx, "u2", true)
+	if err != nil {
+		t.Fatalf("GetUserPullRequests(awaiting): %v", err)
+	}
+	if len(prs) != 1 || prs[0].PullRequestID != "pr-b" || prs[0].ReviewState != models.ReviewStateCommented {
+		t.Fatalf("awaiting PRs = %+v", prs)
+	}
+}
+
+func testReviewLoad(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "u1", "u2", "u3", "u4")
+
+	create := func(prID string, isDraft bool, reviewers ...string) {
+		if err := store.CreatePullRequest(ctx, prID, prID, "u1", isDraft, 2, reviewers, noAudit); err != nil {
+			t.Fatalf("CreatePullRequest(%s): %v", prID, err)
+		}
+	}
+	create("pr-1", false, "u2", "u3")
+	create("pr-2", false, "u2")
+	create("pr-3", false, "u3")
+	create("pr-4", true)
+
+	if err := store.MergePullRequest(ctx, "pr-3", 0, noAudit); err != nil {
+		t.Fatalf("MergePullRequest: %v", err)
+	}
+
+	counts, err := store.GetOpenReviewCounts(ctx, []string{"u2", "u3", "u4"})
+	if err != nil {
+		t.Fatalf("GetOpenReviewCounts: %v", err)
+	}
+	if counts["u2"] != 2 || counts["u3"] != 1 || counts["u4"] != 0 {
+		t.Fatalf("GetOpenReviewCounts = %v", counts)
+	}
+}
+
+func testBulkDeactivation(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "b1", "b2", "b3")
+	seedTeam(t, store, "qa", "q1", "q2")
+
+	if err := store.CreatePullRequest(ctx, "pr-1", "One", "b1", false, 2, []string{"b2", "q1"}, noAudit); err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+	if err := store.CreatePullRequest(ctx, "pr-2", "Two", "b1", false, 2, []string{"b3"}, noAudit); err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+	if err := store.CreatePullRequest(ctx, "pr-3", "Three", "b1", false, 2, []string{"q2"}, noAudit); err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+	if err := store.MergePullRequest(ctx, "pr-3", 0, noAudit); err != nil {
+		t.Fatalf("MergePullRequest: %v", err)
+	}
+
+	deactivated, err := store.BulkDeactivateTeamUsers(ctx, "qa", 0, noAudit)
+	if err != nil {
+		t.Fatalf("BulkDeactivateTeamUsers: %v", err)
+	}
+	expectStrings(t, "deactivated", sorted(deactivated), []string{"q1", "q2"})
+
+	again, err := store.BulkDeactivateTeamUsers(ctx, "qa", 0, noAudit)
+	if err != nil || len(again) != 0 {
+		t.Fatalf("second BulkDeactivateTeamUsers = %v, %v", again, err)
+	}
+
+	prs, err := store.GetOpenPRsWithReviewers(ctx, deactivated)
+	if err != nil {
+		t.Fatalf("GetOpenPRsWithReviewers: %v", err)
+	}
+	if len(prs) != 1 || prs[0].PullRequestID != "pr-1" || prs[0].AuthorID != "b1" {
+		t.Fatalf("GetOpenPRsWithReviewers = %+v", prs)
+	}
+	expectStrings(t, "pr-1 reviewers", prs[0].AssignedReviewers, []string{"b2", "q1"})
+	planned := prs[0].Version
+
+	// A stale plan and one for a merged PR are skipped without failing the rest.
+	reassigned, err := store.BulkReassignReviewers(ctx, map[string]models.ReviewerPlan{
+		"pr-1": {Version: planned - 1, Replacements: map[string]string{"q1": "b3"}},
+		"pr-3": {Version: mustPR(t, store, "pr-3").Version, Replacements: map[string]string{"q2": "b3"}},
+	}, noAudit)
+	if err != nil || len(reassigned) != 0 {
+		t.Fatalf("BulkReassignReviewers(stale and merged) = %v, %v; want nothing applied", reassigned, err)
+	}
+	expectStrings(t, "merged pr-3 reviewers", mustPR(t, store, "pr-3").AssignedReviewers, []string{"q2"})
+
+	reassigned, err = store.BulkReassignReviewers(ctx, map[string]models.ReviewerPlan{
+		"pr-1": {Version: planned, Replacements: map[string]string{"q1": "b3"}},
+	}, noAudit)
+	if err != nil {
+		t.Fatalf("BulkReassignReviewers: %v", err)
+	}
+	expectStrings(t, "reassigned", reassigned, []string{"pr-1"})
+	pr := mustPR(t, store, "pr-1")
+	expectStrings(t, "pr-1 reviewers after bulk", pr.AssignedReviewers, []string{"b2", "b3"})
+	if pr.Version != planned+1 {
+		t.Fatalf("pr-1 version after bulk = %d, want %d", pr.Version, planned+1)
+	}
+
+	_, err = store.BulkReassignReviewers(ctx, map[string]models.ReviewerPlan{
+		"pr-2": {Version: mustPR(t, store, "pr-2").Version, Replacements: map[string]string{"b3": "ghost"}},
+	}, noAudit)
+	if !errors.Is(err, database.ErrForeignKeyViolation) {
+		t.Fatalf("BulkReassignReviewers(unknown user): err = %v, want ErrForeignKeyViolation", err)
+	}
+	expectStrings(t, "pr-2 reviewers after failed bulk", mustPR(t, store, "pr-2").AssignedReviewers, []string{"b3"})
+}
+
+func testAbsences(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "u1", "u2", "u3")
+
+	now := time.Now()
+	current := &models.Absence{
+		UserID:       "u2",
+		StartsAt:     now.Add(-time.Hour),
+		EndsAt:       now.Add(time.Hour),
+		Reason:       "vacation",
+		AutoReassign: true,
+	}
+	if err := store.CreateAbsence(ctx, current, models.Audit{Actor: "u2"}); err != nil {
+		t.Fatalf("CreateAbsence: %v", err)
+	}
+	if current.AbsenceID == 0 {
+		t.Fatalf("CreateAbsence did not assign an id")
+	}
+
+	future := &models.Absence{UserID: "u3", StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour), AutoReassign: true}
+	if err := store.CreateAbsence(ctx, future, noAudit); err != nil {
+		t.Fatalf("CreateAbsence: %v", err)
+	}
+	if future.AbsenceID == current.AbsenceID {
+		t.Fatalf("absence ids are not unique")
+	}
+
+	err := store.CreateAbsence(ctx, &models.Absence{UserID: "ghost", StartsAt: now, EndsAt: now.Add(time.Hour)}, noAudit)
+	if !errors.Is(err, database.ErrForeignKeyViolation) {
+		t.Fatalf("CreateAbsence(unknown user): err = %v, want ErrForeignKeyViolation", err)
+	}
+
+	members, err := store.GetActiveTeamMembers(ctx, "backend", "u1")
+	if err != nil {
+		t.Fatalf("GetActiveTeamMembers: %v", err)
+	}
+	expectStrings(t, "available members", members, []string{"u3"})
+
+	started, err := store.GetStartedAbsencesToReassign(ctx)
+	if err != nil {
+		t.Fatalf("GetStartedAbsencesToReassign: %v", err)
+	}
+	if len(started) != 1 || started[0].AbsenceID != current.AbsenceID {
+		t.Fatalf("GetStartedAbsencesToReassign = %+v", started)
+	}
+
+	if err := store.MarkAbsenceReassigned(ctx, current.AbsenceID); err != nil {
+		t.Fatalf("MarkAbsenceReassigned: %v", err)
+	}
+	started, err = store.GetStartedAbsencesToReassign(ctx)
+	if err != nil || len(started) != 0 {
+		t.Fatalf("GetStartedAbsencesToReassign after mark = %+v, %v", started, err)
+	}
+
+	if err := store.CancelAbsence(ctx, current.AbsenceID, models.Audit{Actor: "admin"}); err != nil {
+		t.Fatalf("CancelAbsence: %v", err)
+	}
+	if err := store.CancelAbsence(ctx, current.AbsenceID, models.Audit{Actor: "admin"}); err != nil {
+		t.Fatalf("CancelAbsence(again): %v", err)
+	}
+	events, err := store.ListEvents(ctx, models.EventFilter{UserID: "u2"})
+	if err != nil || len(events) != 2 {
+		t.Fatalf("absence events = %+v, %v; want created and cancelled once", events, err)
+	}
+	if created := events[0]; created.Type != models.EventAbsenceCreated || created.Actor != "u2" ||
+		created.TeamName != "backend" || created.Details["absence_id"] != strconv.FormatInt(current.AbsenceID, 10) {
+		t.Fatalf("created event = %+v", created)
+	}
+	if cancelled := events[1]; cancelled.Type != models.EventAbsenceCancelled || cancelled.Actor != "admin" {
+		t.Fatalf("cancelled event = %+v", cancelled)
+	}
+	absence, err := store.GetAbsence(ctx, current.AbsenceID)
+	if err != nil || absence.CancelledAt == nil || absence.ReassignedAt == nil {
+		t.Fatalf("GetAbsence = %+v, %v", absence, err)
+	}
+
+	members, err = store.GetActiveTeamMembersForReplacement(ctx, "backend", []string{"u1"})
+	if err != nil {
+		t.Fatalf("GetActiveTeamMembersForReplacement: %v", err)
+	}
+	expectStrings(t, "available after cancel", members, []string{"u2", "u3"})
+
+	absences, err := store.GetUserAbsences(ctx, "u2")
+	if err != nil || len(absences) != 1 || absences[0].Reason != "vacation" {
+		t.Fatalf("GetUserAbsences = %+v, %v", absences, err)
+	}
+
+	if _, err := store.GetAbsence(ctx, -1); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetAbsence(missing): err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testMergePolicies(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "u1")
+
+	policy, err := store.GetMergePolicy(ctx, "backend")
+	if err != nil {
+		t.Fatalf("GetMergePolicy: %v", err)
+	}
+	if policy.Version == 0 || *policy != (models.MergePolicy{TeamName: "backend", Version: policy.Version}) {
+		t.Fatalf("default policy = %+v", policy)
+	}
+	version := policy.Version
+
+	want := models.MergePolicy{TeamName: "backend", MinApprovals: 2, BlockOnChangesRequested: true}
+	if err := store.SetMergePolicy(ctx, &want, version, noAudit); err != nil {
+		t.Fatalf("SetMergePolicy: %v", err)
+	}
+	want.ForbidAuthorSelfMerge = true
+	if err := store.SetMergePolicy(ctx, &want, version, noAudit); !errors.Is(err, database.ErrVersionConflict) {
+		t.Fatalf("SetMergePolicy(stale version): err = %v, want ErrVersionConflict", err)
+	}
+	if err := store.SetMergePolicy(ctx, &want, version+1, noAudit); err != nil {
+		t.Fatalf("SetMergePolicy(update): %v", err)
+	}
+
+	want.Version = version + 2
+	policy, err = store.GetMergePolicy(ctx, "backend")
+	if err != nil || *policy != want {
+		t.Fatalf("GetMergePolicy = %+v, %v; want %+v", policy, err, want)
+	}
+
+	err = store.SetMergePolicy(ctx, &models.MergePolicy{TeamName: "missing"}, 0, noAudit)
+	if !errors.Is(err, database.ErrVersionConflict) {
+		t.Fatalf("SetMergePolicy(unknown team): err = %v, want ErrVersionConflict", err)
+	}
+}
+
+func testVersions(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "u1", "u2", "u3")
+	if err := store.CreatePullRequest(ctx, "pr-1", "Feature", "u1", false, 1, []string{"u2"}, noAudit); err != nil {
+		t.Fatal(err)
+	}
+
+	pr := mustPR(t, store, "pr-1")
+	if pr.Version != 1 {
+		t.Fatalf("new PR version = %d, want 1", pr.Version)
+	}
+	if err := store.SetReviewState(ctx, "pr-1", pr.Version, "u2", models.ReviewStateApproved, noAudit); err != nil {
+		t.Fatalf("SetReviewState(current version): %v", err)
+	}
+	err := store.ReassignReviewer(ctx, "pr-1", pr.Version, "u2", "u3", noAudit)
+	if !errors.Is(err, database.ErrVersionConflict) {
+		t.Fatalf("ReassignReviewer(stale version): err = %v, want ErrVersionConflict", err)
+	}
+	expectStrings(t, "reviewers after stale write", mustPR(t, store, "pr-1").AssignedReviewers, []string{"u2"})
+	if err := store.MergePullRequest(ctx, "pr-1", pr.Version+1, noAudit); err != nil {
+		t.Fatalf("MergePullRequest(current version): %v", err)
+	}
+	if got := mustPR(t, store, "pr-1").Version; got != pr.Version+2 {
+		t.Fatalf("PR version = %d, want %d", got, pr.Version+2)
+	}
+	if err := store.ClosePullRequest(ctx, "pr-1", 0, noAudit); !errors.Is(err, database.ErrVersionConflict) {
+		t.Fatalf("ClosePullRequest(merged): err = %v, want ErrVersionConflict", err)
+	}
+
+	team, err := store.GetTeam(ctx, "backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.SetTeamDefaultReviewers(ctx, "backend", 3, team.Version+1, noAudit)
+	if !errors.Is(err, database.ErrVersionConflict) {
+		t.Fatalf("SetTeamDefaultReviewers(stale version): err = %v, want ErrVersionConflict", err)
+	}
+	if err := store.SetTeamDefaultReviewers(ctx, "backend", 3, team.Version, noAudit); err != nil {
+		t.Fatalf("SetTeamDefaultReviewers(current version): %v", err)
+	}
+
+	user, err := store.GetUser(ctx, "u3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetUserActive(ctx, "u3", false, user.Version, noAudit); err != nil {
+		t.Fatalf("SetUserActive: %v", err)
+	}
+	err = store.SetUserMaxOpenReviews(ctx, "u3", 2, user.Version, noAudit)
+	if !errors.Is(err, database.ErrVersionConflict) {
+		t.Fatalf("SetUserMaxOpenReviews(stale version): err = %v, want ErrVersionConflict", err)
+	}
+
+	updated, err := store.GetTeam(ctx, "backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version != team.Version+2 {
+		t.Fatalf("team version = %d, want %d after a setting and a member change", updated.Version, team.Version+2)
+	}
+	if err := store.SetTeamReviewerStrategy(ctx, "missing", "", 0, noAudit); !errors.Is(err, database.ErrVersionConflict) {
+		t.Fatalf("SetTeamReviewerStrategy(unknown team): err = %v, want ErrVersionConflict", err)
+	}
+}
+
+func testIdempotencyKeys(t *testing.T, store database.Store) {
+	record := &models.IdempotencyRecord{Key: "k1", RequestHash: "h1", ExpiresAt: time.Now().Add(time.Hour)}
+	reserved, err := store.ReserveIdempotencyKey(ctx, record)
+	if err != nil || !reserved {
+		t.Fatalf("ReserveIdempotencyKey = %v, %v; want reserved", reserved, err)
+	}
+	reserved, err = store.ReserveIdempotencyKey(ctx, record)
+	if err != nil || reserved {
+		t.Fatalf("ReserveIdempotencyKey(again) = %v, %v; want taken", reserved, err)
+	}
+
+	got, err := store.GetIdempotencyKey(ctx, "k1")
+	if err != nil || got.RequestHash != "h1" || got.StatusCode != 0 {
+		t.Fatalf("GetIdempotencyKey(pending) = %+v, %v", got, err)
+	}
+
+	if err := store.CompleteIdempotencyKey(ctx, "k1", 201, `"2"`, []byte(`{"ok":true}`)); err != nil {
+		t.Fatalf("CompleteIdempotencyKey: %v", err)
+	}
+	got, err = store.GetIdempotencyKey(ctx, "k1")
+	if err != nil || got.StatusCode != 201 || got.ETag != `"2"` || string(got.Body) != `{"ok":true}` {
+		t.Fatalf("GetIdempotencyKey(done) = %+v, %v", got, err)
+	}
+
+	expired := &models.IdempotencyRecord{Key: "k2", RequestHash: "h2", ExpiresAt: time.Now().Add(-time.Minute)}
+	if _, err := store.ReserveIdempotencyKey(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetIdempotencyKey(ctx, "k2"); err != sql.ErrNoRows {
+		t.Fatalf("GetIdempotencyKey(expired): err = %v, want sql.ErrNoRows", err)
+	}
+	expired.ExpiresAt = time.Now().Add(time.Hour)
+	reserved, err = store.ReserveIdempotencyKey(ctx, expired)
+	if err != nil || !reserved {
+		t.Fatalf("ReserveIdempotencyKey(over expired) = %v, %v; want reserved", reserved, err)
+	}
+
+	if err := store.DeleteIdempotencyKey(ctx, "k2"); err != nil {
+		t.Fatalf("DeleteIdempotencyKey: %v", err)
+	}
+	if _, err := store.GetIdempotencyKey(ctx, "k2"); err != sql.ErrNoRows {
+		t.Fatalf("GetIdempotencyKey(deleted): err = %v, want sql.ErrNoRows", err)
+	}
+
+	if _, err := store.ReserveIdempotencyKey(ctx, &models.IdempotencyRecord{
+		Key: "k3", RequestHash: "h3", ExpiresAt: time.Now().Add(-time.Minute),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := store.DeleteExpiredIdempotencyKeys(ctx)
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeleteExpiredIdempotencyKeys = %d, %v; want 1", deleted, err)
+	}
+}
+
+func testEvents(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "u1", "u2", "u3", "u4")
+	start := time.Now().Add(-time.Minute)
+
+	created := models.Audit{Actor: "u1", Reason: models.ReasonInitial}
+	if err := store.CreatePullRequest(ctx, "pr-1", "Feature", "u1", false, 2, []string{"u2", "u3"}, created); err != nil {
+		t.Fatal(err)
+	}
+	reassign := models.Audit{Reason: models.ReasonReassign}
+	if err := store.ReassignReviewer(ctx, "pr-1", 0, "u2", "u4", reassign); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.MergePullRequest(ctx, "pr-1", 0, models.Audit{Actor: "u4"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetUserActive(ctx, "u3", false, 0, models.Audit{Actor: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	policy := &models.MergePolicy{TeamName: "backend", MinApprovals: 1}
+	if err := store.SetMergePolicy(ctx, policy, 0, noAudit); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(filter models.EventFilter) []models.Event {
+		t.Helper()
+		events, err := store.ListEvents(ctx, filter)
+		if err != nil {
+			t.Fatalf("ListEvents(%+v): %v", filter, err)
+		}
+		return events
+	}
+	types := func(events []models.Event) []string {
+		result := make([]string, 0, len(events))
+		for _, event := range events {
+			result = append(result, event.Type+":"+event.UserID)
+		}
+		return result
+	}
+
+	history := list(models.EventFilter{PullRequestID: "pr-1"})
+	want := []string{
+		models.EventPRCreated + ":",
+		models.EventReviewerAssigned + ":u2",
+		models.EventReviewerAssigned + ":u3",
+		models.EventReviewerUnassigned + ":u2",
+		models.EventReviewerAssigned + ":u4",
+		models.EventPRMerged + ":",
+	}
+	if got := types(history); !reflect.DeepEqual(got, want) {
+		t.Fatalf("PR history = %v, want %v", got, want)
+	}
+	if history[0].Actor != "u1" || history[0].Details["name"] != "Feature" || history[1].Reason != models.ReasonInitial {
+		t.Fatalf("created events = %+v", history[:2])
+	}
+	if history[3].Reason != models.ReasonReassign || history[3].Details["replaced_by"] != "u4" {
+		t.Fatalf("unassign event = %+v", history[3])
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].EventID <= history[i-1].EventID {
+			t.Fatalf("events not ordered by id: %+v", history)
+		}
+	}
+
+	deactivated := list(models.EventFilter{Actor: "admin"})
+	if len(deactivated) != 1 || deactivated[0].Type != models.EventUserDeactivated ||
+		deactivated[0].UserID != "u3" || deactivated[0].TeamName != "backend" {
+		t.Fatalf("events by admin = %+v", deactivated)
+	}
+	if got := list(models.EventFilter{TeamName: "backend", Type: models.EventTeamUpdated}); len(got) != 1 ||
+		got[0].Details["min_approvals"] != "1" {
+		t.Fatalf("team updates = %+v", got)
+	}
+	if got := list(models.EventFilter{UserID: "u4"}); len(got) != 1 {
+		t.Fatalf("events for u4 = %+v", got)
+	}
+
+	page := list(models.EventFilter{PullRequestID: "pr-1", Limit: 2})
+	next := list(models.EventFilter{PullRequestID: "pr-1", AfterID: page[1].EventID, Limit: 2})
+	if len(page) != 2 || len(next) != 2 || next[0].EventID != history[2].EventID {
+		t.Fatalf("pages = %+v, %+v", page, next)
+	}
+
+	later := time.Now().Add(time.Minute)
+	if got := list(models.EventFilter{Since: &start, Until: &later}); len(got) != len(list(models.EventFilter{})) {
+		t.Fatalf("time range covering everything returned %d events", len(got))
+	}
+	if got := list(models.EventFilter{Since: &later}); len(got) != 0 {
+		t.Fatalf("events in the future = %+v", got)
+	}
+}
+
+func testWebhooks(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "u1", "u2", "u3")
+
+	merges := &models.Webhook{URL: "http://merges", Secret: "s1", EventTypes: []string{models.EventPRMerged}}
+	assignments := &models.Webhook{
+		URL: "http://assignments", Secret: "s2", EventTypes: []string{models.EventReviewerAssigned, models.EventPRMerged},
+	}
+	for _, webhook := range []*models.Webhook{merges, assignments} {
+		if err := store.CreateWebhook(ctx, webhook); err != nil || webhook.WebhookID == 0 {
+			t.Fatalf("CreateWebhook = %+v, %v", webhook, err)
+		}
+	}
+	webhooks, err := store.ListWebhooks(ctx)
+	if err != nil || len(webhooks) != 2 || webhooks[1].Secret != "s2" || len(webhooks[1].EventTypes) != 2 {
+		t.Fatalf("ListWebhooks = %+v, %v", webhooks, err)
+	}
+
+	if err := store.CreatePullRequest(ctx, "pr-1", "Feature", "u1", false, 1, []string{"u2"}, noAudit); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.MergePullRequest(ctx, "pr-1", 0, noAudit); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := store.ListWebhookDeliveries(ctx, models.WebhookDeliveryFilter{})
+	if err != nil || len(all) != 3 {
+		t.Fatalf("deliveries = %+v, %v; want assigned + 2 merged", all, err)
+	}
+	if all[0].DeliveryID < all[2].DeliveryID || all[0].Status != models.DeliveryPending || all[0].NextAttemptAt == nil {
+		t.Fatalf("deliveries not newest first or not pending: %+v", all)
+	}
+
+	claimed, err := store.ClaimWebhookDeliveries(ctx, 2, time.Hour)
+	if err != nil || len(claimed) != 2 {
+		t.Fatalf("ClaimWebhookDeliveries = %+v, %v", claimed, err)
+	}
+	first := claimed[0]
+	if first.URL != "http://assignments" || first.Secret != "s2" || first.Event.Type != models.EventReviewerAssigned ||
+		first.Event.UserID != "u2" || first.Delivery.EventType != models.EventReviewerAssigned {
+		t.Fatalf("first claimed = %+v", first)
+	}
+	if again, err := store.ClaimWebhookDeliveries(ctx, 10, time.Hour); err != nil || len(again) != 1 {
+		t.Fatalf("claim while leased = %+v, %v; want only the unclaimed delivery", again, err)
+	}
+
+	err = store.RecordWebhookAttempt(ctx, first.Delivery.DeliveryID, models.WebhookAttempt{
+		Status: models.DeliveryPending, StatusCode: 500, Error: "boom", NextAttemptAt: time.Now().Add(-time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	retried, err := store.ClaimWebhookDeliveries(ctx, 10, time.Hour)
+	if err != nil || len(retried) != 1 || retried[0].Delivery.Attempts != 1 || retried[0].Delivery.LastError != "boom" {
+		t.Fatalf("claim after failed attempt = %+v, %v", retried, err)
+	}
+
+	deadID := claimed[1].Delivery.DeliveryID
+	gone := models.WebhookAttempt{Status: models.DeliveryDead, Error: "gone"}
+	if err := store.RecordWebhookAttempt(ctx, deadID, gone); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RecordWebhookAttempt(ctx, first.Delivery.DeliveryID, models.WebhookAttempt{
+		Status: models.DeliveryDelivered, StatusCode: 204,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	delivered, err := store.GetWebhookDelivery(ctx, first.Delivery.DeliveryID)
+	if err != nil || delivered.Status != models.DeliveryDelivered || delivered.DeliveredAt == nil ||
+		delivered.NextAttemptAt != nil || delivered.Attempts != 2 {
+		t.Fatalf("delivered = %+v, %v", delivered, err)
+	}
+
+	dead, err := store.ListWebhookDeliveries(ctx, models.WebhookDeliveryFilter{Status: models.DeliveryDead})
+	if err != nil || len(dead) != 1 || dead[0].DeliveryID != deadID {
+		t.Fatalf("dead deliveries = %+v, %v", dead, err)
+	}
+	if err := store.RetryWebhookDelivery(ctx, first.Delivery.DeliveryID); err != sql.ErrNoRows {
+		t.Fatalf("RetryWebhookDelivery(delivered): err = %v, want sql.ErrNoRows", err)
+	}
+	if err := store.RetryWebhookDelivery(ctx, deadID); err != nil {
+		t.Fatal(err)
+	}
+	requeued, err := store.GetWebhookDelivery(ctx, deadID)
+	if err != nil || requeued.Status != models.DeliveryPending || requeued.Attempts != 0 {
+		t.Fatalf("requeued = %+v, %v", requeued, err)
+	}
+
+	if err := store.DeleteWebhook(ctx, assignments.WebhookID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteWebhook(ctx, assignments.WebhookID); err != sql.ErrNoRows {
+		t.Fatalf("DeleteWebhook(again): err = %v, want sql.ErrNoRows", err)
+	}
+	remaining, err := store.ListWebhookDeliveries(ctx, models.WebhookDeliveryFilter{WebhookID: merges.WebhookID})
+	if err != nil || len(remaining) != 1 {
+		t.Fatalf("deliveries of remaining webhook = %+v, %v", remaining, err)
+	}
+	if _, err := store.GetWebhook(ctx, assignments.WebhookID); err != sql.ErrNoRows {
+		t.Fatalf("GetWebhook(deleted): err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testExternalAccounts(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "u1", "u2")
+
+	for _, account := range []models.ExternalAccount{
+		{Provider: "github", Login: "alice", UserID: "u1"},
+		{Provider: "github", Login: "alice", UserID: "u2"},
+		{Provider: "gitlab", Login: "alice", UserID: "u1"},
+	} {
+		if err := store.SetExternalAccount(ctx, &account); err != nil {
+			t.Fatalf("SetExternalAccount(%+v): %v", account, err)
+		}
+	}
+
+	userID, err := store.GetExternalAccountUser(ctx, "github", "alice")
+	if err != nil || userID != "u2" {
+		t.Fatalf("GetExternalAccountUser = %q, %v; want the latest mapping u2", userID, err)
+	}
+	if _, err := store.GetExternalAccountUser(ctx, "github", "bob"); err != sql.ErrNoRows {
+		t.Fatalf("GetExternalAccountUser(unmapped): err = %v, want sql.ErrNoRows", err)
+	}
+
+	err = store.SetExternalAccount(ctx, &models.ExternalAccount{Provider: "github", Login: "ghost", UserID: "ghost"})
+	if !errors.Is(err, database.ErrForeignKeyViolation) {
+		t.Fatalf("SetExternalAccount(unknown user): err = %v, want ErrForeignKeyViolation", err)
+	}
+
+	accounts, err := store.ListExternalAccounts(ctx, "github")
+	if err != nil || len(accounts) != 1 || accounts[0].UserID != "u2" {
+		t.Fatalf("ListExternalAccounts(github) = %+v, %v", accounts, err)
+	}
+	if accounts, err := store.ListExternalAccounts(ctx, ""); err != nil || len(accounts) != 2 {
+		t.Fatalf("ListExternalAccounts(all) = %+v, %v", accounts, err)
+	}
+}
+
+func testRejectedEvents(t *testing.T, store database.Store) {
+	for _, event := range []models.RejectedEvent{
+		{Provider: "github", EventType: "pull_request", Action: "opened", Login: "ghost", Reason: "unknown"},
+		{Provider: "gitlab", EventType: "Merge Request Hook", Action: "open", Login: "ghost", Reason: "unknown"},
+		{Provider: "gitlab", EventType: "Merge Request Hook", Action: "open", Login: "bob", Reason: "unknown"},
+	} {
+		event.Payload = json.RawMessage(`{"login":"` + event.Login + `"}`)
+		if err := store.CreateRejectedEvent(ctx, &event); err != nil || event.RejectedID == 0 || event.CreatedAt.IsZero() {
+			t.Fatalf("CreateRejectedEvent(%+v): %v", event, err)
+		}
+	}
+
+	events, err := store.ListRejectedEvents(ctx, "gitlab", 10)
+	if err != nil || len(events) != 2 || events[0].Login != "bob" || events[0].RejectedID <= events[1].RejectedID {
+		t.Fatalf("ListRejectedEvents(gitlab) = %+v, %v; want newest first", events, err)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal(events[0].Payload, &payload); err != nil || payload["login"] != "bob" {
+		t.Fatalf("payload = %s, %v", events[0].Payload, err)
+	}
+
+	if events, err := store.ListRejectedEvents(ctx, "", 2); err != nil || len(events) != 2 {
+		t.Fatalf("ListRejectedEvents(all, limit 2) = %+v, %v", events, err)
+	}
+}
+
+func testAPITokens(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "u1")
+
+	admin := &models.APIToken{Name: "ops", Scopes: []string{models.ScopeAdmin}}
+	if err := store.CreateAPIToken(ctx, admin, "hash-admin"); err != nil || admin.TokenID == 0 {
+		t.Fatalf("CreateAPIToken: %+v, %v", admin, err)
+	}
+	ghost := &models.APIToken{Name: "ghost", UserID: "ghost", Scopes: []string{"read"}}
+	err := store.CreateAPIToken(ctx, ghost, "hash-ghost")
+	if !errors.Is(err, database.ErrForeignKeyViolation) {
+		t.Fatalf("CreateAPIToken(unknown user): err = %v, want ErrForeignKeyViolation", err)
+	}
+	reader := &models.APIToken{Name: "dashboard", UserID: "u1", Scopes: []string{models.ScopeRead}}
+	if err := store.CreateAPIToken(ctx, reader, "hash-reader"); err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	err = store.CreateAPIToken(ctx, &models.APIToken{Name: "dup", Scopes: []string{models.ScopeRead}}, "hash-reader")
+	if !errors.Is(err, database.ErrUniqueViolation) {
+		t.Fatalf("CreateAPIToken(duplicate hash): err = %v, want ErrUniqueViolation", err)
+	}
+
+	token, err := store.GetAPITokenByHash(ctx, "hash-reader")
+	if err != nil || token.TokenID != reader.TokenID || token.UserID != "u1" ||
+		!reflect.DeepEqual(token.Scopes, reader.Scopes) {
+		t.Fatalf("GetAPITokenByHash = %+v, %v", token, err)
+	}
+
+	if err := store.RevokeAPIToken(ctx, reader.TokenID); err != nil {
+		t.Fatalf("RevokeAPIToken: %v", err)
+	}
+	if err := store.RevokeAPIToken(ctx, reader.TokenID); err != sql.ErrNoRows {
+		t.Fatalf("RevokeAPIToken(revoked): err = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := store.GetAPITokenByHash(ctx, "hash-reader"); err != sql.ErrNoRows {
+		t.Fatalf("GetAPITokenByHash(revoked): err = %v, want sql.ErrNoRows", err)
+	}
+
+	tokens, err := store.ListAPITokens(ctx)
+	if err != nil || len(tokens) != 2 || tokens[0].RevokedAt != nil || tokens[1].RevokedAt == nil {
+		t.Fatalf("ListAPITokens = %+v, %v", tokens, err)
+	}
+}
+
+func testStats(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "u1", "u2", "u3")
+
+	if err := store.CreatePullRequest(ctx, "pr-1", "One", "u1", false, 2, []string{"u2", "u3"}, noAudit); err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+	if err := store.CreatePullRequest(ctx, "pr-2", "Two", "u1", false, 2, []string{"u3"}, noAudit); err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+	if err := store.CreatePullRequest(ctx, "pr-3", "Three", "u1", false, 2, []string{"u2"}, noAudit); err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+	if err := store.ClosePullRequest(ctx, "pr-3", 0, noAudit); err != nil {
+		t.Fatalf("ClosePullRequest: %v", err)
+	}
+	if err := store.CreatePullRequest(ctx, "pr-4", "Draft", "u2", true, 2, nil, noAudit); err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+
+	users, err := store.GetUserStats(ctx)
+	if err != nil {
+		t.Fatalf("GetUserStats: %v", err)
+	}
+	wantUsers := []models.UserStats{
+		{UserID: "u3", Username: "name-u3", AssignedPRsCount: 2},
+		{UserID: "u2", Username: "name-u2", AssignedPRsCount: 1},
+		{UserID: "u1", Username: "name-u1", AssignedPRsCount: 0},
+	}
+	if !reflect.DeepEqual(users, wantUsers) {
+		t.Fatalf("GetUserStats = %+v, want %+v", users, wantUsers)
+	}
+
+	prs, err := store.GetPRStats(ctx, false)
+	if err != nil {
+		t.Fatalf("GetPRStats: %v", err)
+	}
+	var ids []string
+	for _, pr := range prs {
+		ids = append(ids, pr.PullRequestID)
+	}
+	expectStrings(t, "PR stats order", ids, []string{"pr-1", "pr-2", "pr-3"})
+
+	drafts, err := store.GetPRStats(ctx, true)
+	if err != nil || len(drafts) != 1 || drafts[0].PullRequestID != "pr-4" {
+		t.Fatalf("GetPRStats(drafts) = %+v, %v", drafts, err)
+	}
+
+	if total, err := store.GetTotalUsersCount(ctx); err != nil || total != 3 {
+		t.Fatalf("GetTotalUsersCount = %d, %v", total, err)
+	}
+	if total, err := store.GetTotalPRsCount(ctx, false); err != nil || total != 3 {
+		t.Fatalf("GetTotalPRsCount = %d, %v", total, err)
+	}
+	if total, err := store.GetTotalPRsCount(ctx, true); err != nil || total != 1 {
+		t.Fatalf("GetTotalPRsCount(drafts) = %d, %v", total, err)
+	}
+
+	workload, err := store.GetWorkload(ctx)
+	want := &models.Workload{OpenPRs: 3, ActiveUsers: 3, OpenReviews: map[string]int{"u2": 1, "u3": 2}}
+	if err != nil || !reflect.DeepEqual(workload, want) {
+		t.Fatalf("GetWorkload = %+v, %v; want %+v", workload, err, want)
+	}
+}
+
+func testConcurrentCreate(t *testing.T, store database.Store) {
+	seedTeam(t, store, "backend", "u1", "u2")
+
+	const workers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- store.CreatePullRequest(ctx, "pr-race", "Race", "u1", false, 1, []string{"u2"}, noAudit)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, database.ErrUniqueViolation):
+			t.Fatalf("concurrent CreatePullRequest: unexpected error %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d concurrent creates succeeded, want exactly 1", succeeded)
+	}
+}
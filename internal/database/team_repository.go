@@ -1,15 +1,19 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"pr-review-service/internal/models"
+	"strconv"
+
+	"github.com/lib/pq"
 )
 
-func (db *DB) GetTeam(teamName string) (*models.Team, error) {
+func (db *DB) GetTeam(ctx context.Context, teamName string) (*models.Team, error) {
 	team := &models.Team{TeamName: teamName}
 
-	rows, err := db.Query(`
-		SELECT user_id, username, is_active 
+	rows, err := db.QueryContext(ctx, `
+		SELECT user_id, username, is_active, role
 		FROM users 
 		WHERE team_name = $1 
 		ORDER BY user_id
@@ -21,7 +25,7 @@ func (db *DB) GetTeam(teamName string) (*models.Team, error) {
 
 	for rows.Next() {
 		var member models.TeamMember
-		if err := rows.Scan(&member.UserID, &member.Username, &member.IsActive); err != nil {
+		if err := rows.Scan(&member.UserID, &member.Username, &member.IsActive, &member.Role); err != nil {
 			return nil, err
 		}
 		team.Members = append(team.Members, member)
@@ -31,45 +35,206 @@ func (db *DB) GetTeam(teamName string) (*models.Team, error) {
 		return nil, sql.ErrNoRows
 	}
 
+	err = db.QueryRowContext(ctx, `
+		SELECT COALESCE(reviewer_strategy, ''), COALESCE(default_reviewers, 0), COALESCE(capacity_fallback, ''), version
+		FROM teams
+		WHERE team_name = $1
+	`, teamName).Scan(&team.ReviewerStrategy, &team.DefaultReviewers, &team.CapacityFallback, &team.Version)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
 	return team, nil
 }
 
-func (db *DB) TeamExists(teamName string) (bool, error) {
+func (db *DB) GetTeamReviewerStrategy(ctx context.Context, teamName string) (string, error) {
+	var strategy string
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(reviewer_strategy, '')
+		FROM teams
+		WHERE team_name = $1
+	`, teamName).Scan(&strategy)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return strategy, err
+}
+
+func (db *DB) SetTeamReviewerStrategy(
+	ctx context.Context, teamName, strategy string, version int64, audit models.Audit,
+) error {
+	event := teamEvent(audit, models.EventTeamUpdated, teamName, map[string]string{"reviewer_strategy": strategy})
+	return db.updateWithEvents(ctx, []models.Event{event}, `
+		UPDATE teams
+		SET reviewer_strategy = NULLIF($1, ''), version = version + 1
+		WHERE team_name = $2 AND ($3::BIGINT = 0 OR version = $3::BIGINT)
+	`, strategy, teamName, version)
+}
+
+func (db *DB) GetTeamDefaultReviewers(ctx context.Context, teamName string) (int, error) {
+	var count int
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(default_reviewers, 0)
+		FROM teams
+		WHERE team_name = $1
+	`, teamName).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return count, err
+}
+
+func (db *DB) SetTeamDefaultReviewers(
+	ctx context.Context, teamName string, count int, version int64, audit models.Audit,
+) error {
+	event := teamEvent(audit, models.EventTeamUpdated, teamName,
+		map[string]string{"default_reviewers": strconv.Itoa(count)})
+	return db.updateWithEvents(ctx, []models.Event{event}, `
+		UPDATE teams
+		SET default_reviewers = NULLIF($1, 0), version = version + 1
+		WHERE team_name = $2 AND ($3::BIGINT = 0 OR version = $3::BIGINT)
+	`, count, teamName, version)
+}
+
+func (db *DB) GetTeamCapacityFallback(ctx context.Context, teamName string) (string, error) {
+	var fallback string
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(capacity_fallback, '')
+		FROM teams
+		WHERE team_name = $1
+	`, teamName).Scan(&fallback)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return fallback, err
+}
+
+func (db *DB) SetTeamCapacityFallback(
+	ctx context.Context, teamName, fallback string, version int64, audit models.Audit,
+) error {
+	event := teamEvent(audit, models.EventTeamUpdated, teamName, map[string]string{"capacity_fallback": fallback})
+	return db.updateWithEvents(ctx, []models.Event{event}, `
+		UPDATE teams
+		SET capacity_fallback = NULLIF($1, ''), version = version + 1
+		WHERE team_name = $2 AND ($3::BIGINT = 0 OR version = $3::BIGINT)
+	`, fallback, teamName, version)
+}
+
+func (db *DB) TeamExists(ctx context.Context, teamName string) (bool, error) {
 	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM teams WHERE team_name = $1)", teamName).Scan(&exists)
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM teams WHERE team_name = $1)", teamName).Scan(&exists)
 	return exists, err
 }
 
-func (db *DB) CreateTeam(team *models.Team) error {
-	tx, err := db.Begin()
+func (db *DB) CreateTeam(ctx context.Context, team *models.Team, audit models.Audit) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	if _, err := tx.Exec("INSERT INTO teams (team_name) VALUES ($1) ON CONFLICT DO NOTHING", team.TeamName); err != nil {
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO teams (team_name, reviewer_strategy, default_reviewers, capacity_fallback)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, 0), NULLIF($4, ''))
+		ON CONFLICT (team_name) DO UPDATE SET version = teams.version + 1
+		RETURNING version
+	`, team.TeamName, team.ReviewerStrategy, team.DefaultReviewers, team.CapacityFallback).Scan(&team.Version)
+	if err != nil {
+		return translateError(err)
+	}
+
+	moved, err := movedMembers(ctx, tx, team)
+	if err != nil {
 		return err
 	}
+	if len(moved) > 0 {
+		oldTeams := make([]string, 0, len(moved))
+		for teamName := range moved {
+			oldTeams = append(oldTeams, teamName)
+		}
+		_, err := tx.ExecContext(ctx, `
+			UPDATE teams SET version = version + 1 WHERE team_name = ANY($1)
+		`, pq.Array(oldTeams))
+		if err != nil {
+			return err
+		}
+	}
 
 	for _, member := range team.Members {
-		_, err := tx.Exec(`
-			INSERT INTO users (user_id, username, team_name, is_active) 
-			VALUES ($1, $2, $3, $4)
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO users (user_id, username, team_name, is_active, role) 
+			VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'member'))
 			ON CONFLICT (user_id) 
-			DO UPDATE SET username = $2, team_name = $3, is_active = $4
-		`, member.UserID, member.Username, team.TeamName, member.IsActive)
+			DO UPDATE SET username = $2, team_name = $3, is_active = $4, role = COALESCE(NULLIF($5, ''), users.role),
+				version = users.version + 1
+		`, member.UserID, member.Username, team.TeamName, member.IsActive, member.Role)
 		if err != nil {
-			return err
+			return translateError(err)
 		}
 	}
 
+	events := append([]models.Event{teamCreatedEvent(audit, team)}, membersRemovedEvents(audit, moved)...)
+	if err := insertEvents(ctx, tx, events); err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
-func (db *DB) BulkDeactivateTeamUsers(teamName string) ([]string, error) {
-	rows, err := db.Query(`
+// movedMembers locks the team's members that currently belong to another
+// team and groups them by that team.
+func movedMembers(ctx context.Context, tx *sql.Tx, team *models.Team) (map[string][]string, error) {
+	userIDs := make([]string, 0, len(team.Members))
+	for _, member := range team.Members {
+		userIDs = append(userIDs, member.UserID)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT user_id, team_name FROM users
+		WHERE user_id = ANY($1) AND team_name <> $2
+		ORDER BY user_id
+		FOR UPDATE
+	`, pq.Array(userIDs), team.TeamName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	moved := make(map[string][]string)
+	for rows.Next() {
+		var userID, teamName string
+		if err := rows.Scan(&userID, &teamName); err != nil {
+			return nil, err
+		}
+		moved[teamName] = append(moved[teamName], userID)
+	}
+	return moved, rows.Err()
+}
+
+func (db *DB) BulkDeactivateTeamUsers(
+	ctx context.Context, teamName string, version int64, audit models.Audit,
+) ([]string, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE teams
+		SET version = version + 1
+		WHERE team_name = $1 AND ($2::BIGINT = 0 OR version = $2::BIGINT)
+	`, teamName, version)
+	if err != nil {
+		return nil, err
+	}
+	if err := expectRow(result); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
 		UPDATE users 
-		SET is_active = false 
+		SET is_active = false, version = version + 1
 		WHERE team_name = $1 AND is_active = true
 		RETURNING user_id
 	`, teamName)
@@ -86,57 +251,79 @@ func (db *DB) BulkDeactivateTeamUsers(teamName string) ([]string, error) {
 		}
 		userIDs = append(userIDs, userID)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	events := make([]models.Event, 0, len(userIDs))
+	for _, userID := range userIDs {
+		events = append(events, userEvent(audit, models.EventUserDeactivated, userID, teamName, nil))
+	}
+	if err := insertEvents(ctx, tx, events); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 
 	return userIDs, nil
 }
 
-func (db *DB) GetOpenPRsWithReviewers(deactivatedUserIDs []string) (map[string][]string, map[string]string, error) {
-	if len(deactivatedUserIDs) == 0 {
-		return make(map[string][]string), make(map[string]string), nil
+// GetOpenPRsWithReviewers returns the ID, author, every reviewer and the
+// version of each OPEN PR that at least one of the given users reviews,
+// ordered by ID.
+func (db *DB) GetOpenPRsWithReviewers(ctx context.Context, userIDs []string) ([]models.PullRequest, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
 	}
 
 	query := `
 		SELECT 
 			pr.pull_request_id, 
 			pr.author_id,
-			array_agg(prr.reviewer_id) as reviewer_ids
+			pr.version,
+			array_agg(prr.reviewer_id ORDER BY prr.reviewer_id) as reviewer_ids
 		FROM pull_requests pr
 		INNER JOIN pr_reviewers prr ON pr.pull_request_id = prr.pull_request_id
-		WHERE pr.status = 'OPEN' AND prr.reviewer_id = ANY($1)
-		GROUP BY pr.pull_request_id, pr.author_id
+		WHERE pr.status = 'OPEN' AND EXISTS (
+			SELECT 1 FROM pr_reviewers target
+			WHERE target.pull_request_id = pr.pull_request_id AND target.reviewer_id = ANY($1)
+		)
+		GROUP BY pr.pull_request_id, pr.author_id, pr.version
+		ORDER BY pr.pull_request_id
 	`
 
-	rows, err := db.Query(query, deactivatedUserIDs)
+	rows, err := db.QueryContext(ctx, query, pq.Array(userIDs))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	prReviewers := make(map[string][]string)
-	prAuthors := make(map[string]string)
-
+	var prs []models.PullRequest
 	for rows.Next() {
-		var prID, authorID string
-		var reviewerIDs []string
-		if err := rows.Scan(&prID, &authorID, &reviewerIDs); err != nil {
-			return nil, nil, err
+		var pr models.PullRequest
+		if err := rows.Scan(&pr.PullRequestID, &pr.AuthorID, &pr.Version, pq.Array(&pr.AssignedReviewers)); err != nil {
+			return nil, err
 		}
-		prReviewers[prID] = reviewerIDs
-		prAuthors[prID] = authorID
+		prs = append(prs, pr)
 	}
 
-	return prReviewers, prAuthors, nil
+	return prs, rows.Err()
 }
 
-func (db *DB) GetActiveTeamMembersForReplacement(teamName string, excludeUserIDs []string) ([]string, error) {
+func (db *DB) GetActiveTeamMembersForReplacement(
+	ctx context.Context, teamName string, excludeUserIDs []string,
+) ([]string, error) {
 	query := `
 		SELECT user_id 
 		FROM users 
-		WHERE team_name = $1 AND is_active = true AND user_id != ALL($2)
+		WHERE team_name = $1 AND is_active = true AND user_id != ALL($2) AND ` + availableUserClause + `
 		ORDER BY user_id
 	`
 
-	rows, err := db.Query(query, teamName, excludeUserIDs)
+	rows, err := db.QueryContext(ctx, query, teamName, pq.Array(excludeUserIDs))
 	if err != nil {
 		return nil, err
 	}
@@ -154,8 +341,10 @@ func (db *DB) GetActiveTeamMembersForReplacement(teamName string, excludeUserIDs
 	return userIDs, nil
 }
 
-func (db *DB) BulkReassignReviewers(reassignments map[string]map[string]string) ([]string, error) {
-	tx, err := db.Begin()
+func (db *DB) BulkReassignReviewers(
+	ctx context.Context, plans map[string]models.ReviewerPlan, audit models.Audit,
+) ([]string, error) {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -163,22 +352,40 @@ func (db *DB) BulkReassignReviewers(reassignments map[string]map[string]string)
 
 	var reassignedPRs []string
 
-	for prID, replacements := range reassignments {
-		for oldReviewerID, newReviewerID := range replacements {
-			_, err = tx.Exec(`
+	for prID, plan := range plans {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE pull_requests
+			SET version = version + 1
+			WHERE pull_request_id = $1 AND status = 'OPEN' AND version = $2
+		`, prID, plan.Version)
+		if err != nil {
+			return nil, err
+		}
+		if err := expectRow(result); err == ErrVersionConflict {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for oldReviewerID, newReviewerID := range plan.Replacements {
+			_, err = tx.ExecContext(ctx, `
 				DELETE FROM pr_reviewers 
 				WHERE pull_request_id = $1 AND reviewer_id = $2
 			`, prID, oldReviewerID)
 			if err != nil {
-				return nil, err
+				return nil, translateError(err)
 			}
 
-			_, err = tx.Exec(`
+			_, err = tx.ExecContext(ctx, `
 				INSERT INTO pr_reviewers (pull_request_id, reviewer_id)
 				VALUES ($1, $2)
 				ON CONFLICT (pull_request_id, reviewer_id) DO NOTHING
 			`, prID, newReviewerID)
 			if err != nil {
+				return nil, translateError(err)
+			}
+
+			if err := insertEvents(ctx, tx, reassignEvents(audit, prID, oldReviewerID, newReviewerID)); err != nil {
 				return nil, err
 			}
 		}
@@ -186,13 +393,13 @@ func (db *DB) BulkReassignReviewers(reassignments map[string]map[string]string)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return reassignedPRs, nil
 }
 
-func (db *DB) GetTeamNameForUsers(userIDs []string) (map[string]string, error) {
+func (db *DB) GetTeamNameForUsers(ctx context.Context, userIDs []string) (map[string]string, error) {
 	if len(userIDs) == 0 {
 		return make(map[string]string), nil
 	}
@@ -203,7 +410,7 @@ func (db *DB) GetTeamNameForUsers(userIDs []string) (map[string]string, error) {
 		WHERE user_id = ANY($1)
 	`
 
-	rows, err := db.Query(query, userIDs)
+	rows, err := db.QueryContext(ctx, query, pq.Array(userIDs))
 	if err != nil {
 		return nil, err
 	}
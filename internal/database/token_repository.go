@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"pr-review-service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+func (db *DB) CreateAPIToken(ctx context.Context, token *models.APIToken, hash string) error {
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO api_tokens (name, user_id, token_hash, scopes)
+		VALUES ($1, NULLIF($2, ''), $3, $4)
+		RETURNING token_id, created_at
+	`, token.Name, token.UserID, hash, pq.Array(token.Scopes)).Scan(&token.TokenID, &token.CreatedAt)
+	return translateError(err)
+}
+
+// GetAPITokenByHash returns the unrevoked token with the given hash.
+func (db *DB) GetAPITokenByHash(ctx context.Context, hash string) (*models.APIToken, error) {
+	row := db.QueryRowContext(ctx, `
+		SELECT token_id, name, COALESCE(user_id, ''), scopes, created_at, revoked_at
+		FROM api_tokens
+		WHERE token_hash = $1 AND revoked_at IS NULL
+	`, hash)
+	return scanAPIToken(row)
+}
+
+func (db *DB) ListAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT token_id, name, COALESCE(user_id, ''), scopes, created_at, revoked_at
+		FROM api_tokens
+		ORDER BY token_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken revokes an active token and returns sql.ErrNoRows when there
+// is none with that id.
+func (db *DB) RevokeAPIToken(ctx context.Context, tokenID int64) error {
+	result, err := db.ExecContext(ctx, `
+		UPDATE api_tokens SET revoked_at = NOW()
+		WHERE token_id = $1 AND revoked_at IS NULL
+	`, tokenID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanAPIToken(row rowScanner) (*models.APIToken, error) {
+	token := &models.APIToken{}
+	var revokedAt sql.NullTime
+	err := row.Scan(&token.TokenID, &token.Name, &token.UserID, pq.Array(&token.Scopes), &token.CreatedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return token, nil
+}
@@ -1,30 +1,148 @@
 package database
 
-import "pr-review-service/internal/models"
+import (
+	"context"
+	"database/sql"
+	"pr-review-service/internal/models"
+	"strconv"
 
-func (db *DB) GetUser(userID string) (*models.User, error) {
+	"github.com/lib/pq"
+)
+
+func (db *DB) GetUser(ctx context.Context, userID string) (*models.User, error) {
 	user := &models.User{}
-	err := db.QueryRow(`
-		SELECT user_id, username, team_name, is_active 
+	err := db.QueryRowContext(ctx, `
+		SELECT user_id, username, team_name, is_active, role, COALESCE(max_open_reviews, 0), version
 		FROM users 
 		WHERE user_id = $1
-	`, userID).Scan(&user.UserID, &user.Username, &user.TeamName, &user.IsActive)
+	`, userID).Scan(
+		&user.UserID, &user.Username, &user.TeamName, &user.IsActive, &user.Role, &user.MaxOpenReviews, &user.Version,
+	)
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-func (db *DB) SetUserActive(userID string, isActive bool) error {
-	_, err := db.Exec("UPDATE users SET is_active = $1 WHERE user_id = $2", isActive, userID)
-	return err
+// SetUserActive also bumps the version of the user's team, whose member list
+// shows the flag.
+func (db *DB) SetUserActive(
+	ctx context.Context, userID string, isActive bool, version int64, audit models.Audit,
+) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var teamName string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users
+		SET is_active = $1, version = version + 1
+		WHERE user_id = $2 AND ($3::BIGINT = 0 OR version = $3::BIGINT)
+		RETURNING team_name
+	`, isActive, userID, version).Scan(&teamName)
+	if err == sql.ErrNoRows {
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE teams SET version = version + 1 WHERE team_name = $1", teamName); err != nil {
+		return err
+	}
+
+	event := userEvent(audit, activationEventType(isActive), userID, teamName, nil)
+	if err := insertEvents(ctx, tx, []models.Event{event}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (db *DB) GetActiveTeamMembers(teamName string, excludeUserID string) ([]string, error) {
-	rows, err := db.Query(`
+// SetUserRole also bumps the version of the user's team, whose member list
+// shows the role.
+func (db *DB) SetUserRole(ctx context.Context, userID, role string, version int64, audit models.Audit) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var teamName string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users
+		SET role = $1, version = version + 1
+		WHERE user_id = $2 AND ($3::BIGINT = 0 OR version = $3::BIGINT)
+		RETURNING team_name
+	`, role, userID, version).Scan(&teamName)
+	if err == sql.ErrNoRows {
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE teams SET version = version + 1 WHERE team_name = $1", teamName); err != nil {
+		return err
+	}
+
+	event := userEvent(audit, models.EventUserUpdated, userID, teamName, map[string]string{"role": role})
+	if err := insertEvents(ctx, tx, []models.Event{event}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) SetUserMaxOpenReviews(
+	ctx context.Context, userID string, maxOpenReviews int, version int64, audit models.Audit,
+) error {
+	event := userEvent(audit, models.EventUserUpdated, userID, "",
+		map[string]string{"max_open_reviews": strconv.Itoa(maxOpenReviews)})
+	return db.updateWithEvents(ctx, []models.Event{event}, `
+		UPDATE users
+		SET max_open_reviews = NULLIF($1, 0), version = version + 1
+		WHERE user_id = $2 AND ($3::BIGINT = 0 OR version = $3::BIGINT)
+	`, maxOpenReviews, userID, version)
+}
+
+// GetMaxOpenReviews returns review limits for the given users; users without
+// a limit are absent from the map.
+func (db *DB) GetMaxOpenReviews(ctx context.Context, userIDs []string) (map[string]int, error) {
+	limits := make(map[string]int)
+	if len(userIDs) == 0 {
+		return limits, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT user_id, max_open_reviews
+		FROM users
+		WHERE user_id = ANY($1) AND max_open_reviews IS NOT NULL
+	`, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		var limit int
+		if err := rows.Scan(&userID, &limit); err != nil {
+			return nil, err
+		}
+		limits[userID] = limit
+	}
+
+	return limits, rows.Err()
+}
+
+func (db *DB) GetActiveTeamMembers(ctx context.Context, teamName string, excludeUserID string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `
 		SELECT user_id 
 		FROM users 
-		WHERE team_name = $1 AND is_active = true AND user_id != $2
+		WHERE team_name = $1 AND is_active = true AND user_id != $2 AND `+availableUserClause+`
 		ORDER BY user_id
 	`, teamName, excludeUserID)
 	if err != nil {
@@ -44,14 +162,17 @@ func (db *DB) GetActiveTeamMembers(teamName string, excludeUserID string) ([]str
 	return userIDs, nil
 }
 
-func (db *DB) GetUserPullRequests(userID string) ([]models.PullRequestShort, error) {
-	rows, err := db.Query(`
-		SELECT pr.pull_request_id, pr.pull_request_name, pr.author_id, pr.status
+func (db *DB) GetUserPullRequests(
+	ctx context.Context, userID string, awaitingOnly bool,
+) ([]models.PullRequestShort, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT pr.pull_request_id, pr.pull_request_name, pr.author_id, pr.status, pr.is_draft, prr.review_state
 		FROM pull_requests pr
 		INNER JOIN pr_reviewers prr ON pr.pull_request_id = prr.pull_request_id
-		WHERE prr.reviewer_id = $1
+		WHERE prr.reviewer_id = $1 AND pr.status != 'CLOSED'
+			AND (NOT $2 OR (pr.status = 'OPEN' AND prr.review_state IN ('PENDING', 'COMMENTED')))
 		ORDER BY pr.pull_request_id
-	`, userID)
+	`, userID, awaitingOnly)
 	if err != nil {
 		return nil, err
 	}
@@ -60,7 +181,7 @@ func (db *DB) GetUserPullRequests(userID string) ([]models.PullRequestShort, err
 	var prs []models.PullRequestShort
 	for rows.Next() {
 		var pr models.PullRequestShort
-		if err := rows.Scan(&pr.PullRequestID, &pr.PullRequestName, &pr.AuthorID, &pr.Status); err != nil {
+		if err := rows.Scan(&pr.PullRequestID, &pr.PullRequestName, &pr.AuthorID, &pr.Status, &pr.IsDraft, &pr.ReviewState); err != nil {
 			return nil, err
 		}
 		prs = append(prs, pr)
@@ -68,3 +189,33 @@ func (db *DB) GetUserPullRequests(userID string) ([]models.PullRequestShort, err
 
 	return prs, nil
 }
+
+func (db *DB) GetOpenReviewCounts(ctx context.Context, userIDs []string) (map[string]int, error) {
+	counts := make(map[string]int, len(userIDs))
+	if len(userIDs) == 0 {
+		return counts, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT prr.reviewer_id, COUNT(*)
+		FROM pr_reviewers prr
+		INNER JOIN pull_requests pr ON pr.pull_request_id = prr.pull_request_id
+		WHERE pr.status = 'OPEN' AND NOT pr.is_draft AND prr.reviewer_id = ANY($1)
+		GROUP BY prr.reviewer_id
+	`, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		var count int
+		if err := rows.Scan(&userID, &count); err != nil {
+			return nil, err
+		}
+		counts[userID] = count
+	}
+
+	return counts, rows.Err()
+}
@@ -0,0 +1,240 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"pr-review-service/internal/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func (db *DB) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	return db.QueryRowContext(ctx, `
+		INSERT INTO webhooks (url, secret, event_types)
+		VALUES ($1, $2, $3)
+		RETURNING webhook_id, created_at
+	`, webhook.URL, webhook.Secret, pq.Array(webhook.EventTypes)).Scan(&webhook.WebhookID, &webhook.CreatedAt)
+}
+
+func (db *DB) GetWebhook(ctx context.Context, webhookID int64) (*models.Webhook, error) {
+	webhook := &models.Webhook{}
+	err := db.QueryRowContext(ctx, `
+		SELECT webhook_id, url, secret, event_types, created_at
+		FROM webhooks
+		WHERE webhook_id = $1
+	`, webhookID).Scan(
+		&webhook.WebhookID, &webhook.URL, &webhook.Secret, pq.Array(&webhook.EventTypes), &webhook.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (db *DB) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT webhook_id, url, secret, event_types, created_at
+		FROM webhooks
+		ORDER BY webhook_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var webhook models.Webhook
+		err := rows.Scan(
+			&webhook.WebhookID, &webhook.URL, &webhook.Secret, pq.Array(&webhook.EventTypes), &webhook.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook removes the webhook together with its delivery log.
+func (db *DB) DeleteWebhook(ctx context.Context, webhookID int64) error {
+	result, err := db.ExecContext(ctx, "DELETE FROM webhooks WHERE webhook_id = $1", webhookID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries returns up to limit due PENDING deliveries and pushes
+// their next attempt lease into the future, so concurrent workers skip them
+// and a worker that dies mid-send only delays the retry.
+func (db *DB) ClaimWebhookDeliveries(
+	ctx context.Context, limit int, lease time.Duration,
+) ([]models.WebhookDispatch, error) {
+	rows, err := db.QueryContext(ctx, `
+		WITH due AS (
+			SELECT delivery_id
+			FROM webhook_deliveries
+			WHERE status = 'PENDING' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, delivery_id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		), claimed AS (
+			UPDATE webhook_deliveries d
+			SET next_attempt_at = NOW() + $2::DOUBLE PRECISION * INTERVAL '1 second'
+			FROM due
+			WHERE d.delivery_id = due.delivery_id
+			RETURNING d.*
+		)
+		SELECT `+eventColumns+`, `+deliveryColumns+`, webhooks.url, webhooks.secret
+		FROM claimed d
+		JOIN events ON events.event_id = d.event_id
+		JOIN webhooks ON webhooks.webhook_id = d.webhook_id
+		ORDER BY d.delivery_id
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dispatches []models.WebhookDispatch
+	for rows.Next() {
+		var dispatch models.WebhookDispatch
+		var deliveredAt, nextAttemptAt sql.NullTime
+		extra := append(deliveryDest(&dispatch.Delivery, &nextAttemptAt, &deliveredAt), &dispatch.URL, &dispatch.Secret)
+		if err := scanEvent(rows, &dispatch.Event, extra...); err != nil {
+			return nil, err
+		}
+		setDeliveryTimes(&dispatch.Delivery, nextAttemptAt, deliveredAt)
+		dispatches = append(dispatches, dispatch)
+	}
+
+	return dispatches, rows.Err()
+}
+
+func (db *DB) RecordWebhookAttempt(ctx context.Context, deliveryID int64, attempt models.WebhookAttempt) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $1,
+			attempts = attempts + 1,
+			last_status_code = $2,
+			last_error = $3,
+			next_attempt_at = CASE WHEN $1 = 'PENDING' THEN $4 ELSE next_attempt_at END,
+			delivered_at = CASE WHEN $1 = 'DELIVERED' THEN NOW() END
+		WHERE delivery_id = $5
+	`, attempt.Status, attempt.StatusCode, attempt.Error, attempt.NextAttemptAt, deliveryID)
+	return err
+}
+
+// RetryWebhookDelivery puts a DEAD delivery back in the queue with a fresh
+// attempt budget.
+func (db *DB) RetryWebhookDelivery(ctx context.Context, deliveryID int64) error {
+	result, err := db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'PENDING', attempts = 0, next_attempt_at = NOW()
+		WHERE delivery_id = $1 AND status = 'DEAD'
+	`, deliveryID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (db *DB) GetWebhookDelivery(ctx context.Context, deliveryID int64) (*models.WebhookDelivery, error) {
+	row := db.QueryRowContext(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries d
+		JOIN events ON events.event_id = d.event_id
+		WHERE d.delivery_id = $1
+	`, deliveryID)
+	return scanDelivery(row)
+}
+
+func (db *DB) ListWebhookDeliveries(
+	ctx context.Context, filter models.WebhookDeliveryFilter,
+) ([]models.WebhookDelivery, error) {
+	var where whereClause
+	if filter.WebhookID != 0 {
+		where.add("d.webhook_id = ?", filter.WebhookID)
+	}
+	if filter.Status != "" {
+		where.add("d.status = ?", filter.Status)
+	}
+
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries d
+		JOIN events ON events.event_id = d.event_id
+		WHERE ` + where.String() + `
+		ORDER BY d.delivery_id DESC`
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := db.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+const deliveryColumns = `d.delivery_id, d.webhook_id, d.event_id, events.event_type, d.status, d.attempts,
+	d.last_status_code, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at`
+
+func deliveryDest(delivery *models.WebhookDelivery, nextAttemptAt, deliveredAt *sql.NullTime) []interface{} {
+	return []interface{}{
+		&delivery.DeliveryID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Status,
+		&delivery.Attempts, &delivery.LastStatusCode, &delivery.LastError, nextAttemptAt, &delivery.CreatedAt,
+		deliveredAt,
+	}
+}
+
+func scanDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{}
+	var nextAttemptAt, deliveredAt sql.NullTime
+	if err := row.Scan(deliveryDest(delivery, &nextAttemptAt, &deliveredAt)...); err != nil {
+		return nil, err
+	}
+	setDeliveryTimes(delivery, nextAttemptAt, deliveredAt)
+	return delivery, nil
+}
+
+// setDeliveryTimes exposes the next attempt only while one is scheduled.
+func setDeliveryTimes(delivery *models.WebhookDelivery, nextAttemptAt, deliveredAt sql.NullTime) {
+	if nextAttemptAt.Valid && delivery.Status == models.DeliveryPending {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if deliveredAt.Valid {
+		delivery.DeliveredAt = &deliveredAt.Time
+	}
+}
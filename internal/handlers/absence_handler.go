@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"pr-review-service/internal/models"
+)
+
+// POST /users/addAbsence
+func (h *Handlers) AddAbsence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var absence models.Absence
+	if err := json.NewDecoder(r.Body).Decode(&absence); err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	created, err := h.service.CreateAbsence(r.Context(), callerFromRequest(r), &absence)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, map[string]interface{}{"absence": created})
+}
+
+// GET /users/getAbsences
+func (h *Handlers) GetAbsences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "user_id parameter is required")
+		return
+	}
+
+	absences, err := h.service.GetUserAbsences(r.Context(), userID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":  userID,
+		"absences": absences,
+	})
+}
+
+// POST /users/cancelAbsence
+func (h *Handlers) CancelAbsence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		AbsenceID int64 `json:"absence_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	absence, err := h.service.CancelAbsence(r.Context(), callerFromRequest(r), req.AbsenceID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"absence": absence})
+}
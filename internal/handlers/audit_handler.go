@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"pr-review-service/internal/models"
+	"strconv"
+	"time"
+)
+
+// GET /pullRequest/history
+func (h *Handlers) GetPullRequestHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	prID := r.URL.Query().Get("pull_request_id")
+	if prID == "" {
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "pull_request_id parameter is required")
+		return
+	}
+
+	events, err := h.service.GetPullRequestHistory(r.Context(), prID)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"pull_request_id": prID,
+		"events":          events,
+	})
+}
+
+// GET /audit
+func (h *Handlers) ListEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseEventFilter(r.URL.Query())
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+
+	events, err := h.service.ListEvents(r.Context(), filter)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"events": events})
+}
+
+func parseEventFilter(query url.Values) (models.EventFilter, error) {
+	filter := models.EventFilter{
+		Actor:         query.Get("actor"),
+		PullRequestID: query.Get("pull_request_id"),
+		UserID:        query.Get("user_id"),
+		TeamName:      query.Get("team_name"),
+		Type:          query.Get("type"),
+	}
+
+	for name, target := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if raw := query.Get(name); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return filter, errors.New(name + " must be an RFC3339 timestamp")
+			}
+			*target = &parsed
+		}
+	}
+
+	if raw := query.Get("after_id"); raw != "" {
+		afterID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return filter, errors.New("after_id must be an integer")
+		}
+		filter.AfterID = afterID
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil {
+			return filter, errors.New("limit must be an integer")
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
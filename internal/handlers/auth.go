@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/service"
+	"strconv"
+	"strings"
+)
+
+type tokenContextKey struct{}
+
+// requireScope lets a request through only with an "Authorization: Bearer"
+// token granting scope. The token is stored in the request context for
+// callerFromRequest.
+func (h *Handlers) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := bearerToken(r)
+		if !ok {
+			h.writeAuthError(w, r, service.ErrUnauthenticated, scope)
+			return
+		}
+
+		token, err := h.service.Authenticate(r.Context(), secret)
+		if err != nil {
+			h.writeAuthError(w, r, err, scope)
+			return
+		}
+		if !token.HasScope(scope) {
+			h.writeAuthError(w, r, service.ErrInsufficientScope, scope)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey{}, token)))
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < len("Bearer ") || !strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	secret := strings.TrimSpace(header[len("Bearer "):])
+	return secret, secret != ""
+}
+
+// writeAuthError adds the WWW-Authenticate challenge RFC 6750 asks for.
+func (h *Handlers) writeAuthError(w http.ResponseWriter, r *http.Request, err error, scope string) {
+	switch err {
+	case service.ErrUnauthenticated:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="pr-review-service"`)
+	case service.ErrInsufficientScope:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="pr-review-service", error="insufficient_scope", scope="`+scope+`"`)
+	}
+	h.handleServiceError(w, r, err)
+}
+
+// callerFromRequest describes the authenticated token for the service layer's
+// role checks and audit log.
+func callerFromRequest(r *http.Request) models.Caller {
+	token, ok := r.Context().Value(tokenContextKey{}).(*models.APIToken)
+	if !ok {
+		return models.Caller{}
+	}
+	return models.Caller{
+		UserID: token.UserID,
+		Admin:  token.HasScope(models.ScopeAdmin),
+		Source: "token:" + strconv.FormatInt(token.TokenID, 10),
+	}
+}
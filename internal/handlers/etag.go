@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ifMatch reads the expected resource version from the If-Match header. A
+// missing header or "*" yields 0, meaning no precondition. On a malformed
+// header it writes the error response and returns false.
+func (h *Handlers) ifMatch(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, true
+	}
+
+	value = strings.TrimPrefix(value, "W/")
+	version, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+	if err != nil || version <= 0 {
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "If-Match must hold a single resource version")
+		return 0, false
+	}
+	return version, true
+}
+
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+}
@@ -2,53 +2,203 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"pr-review-service/internal/health"
+	"pr-review-service/internal/logging"
+	"pr-review-service/internal/metrics"
 	"pr-review-service/internal/models"
 	"pr-review-service/internal/service"
+	"pr-review-service/internal/tracing"
+	"strings"
+	"time"
 )
 
+type Options struct {
+	// Metrics receives the request metrics and is served on /metrics.
+	Metrics *metrics.Registry
+	// Logger receives access and error lines; slog.Default() when nil.
+	Logger *slog.Logger
+	// Tracer starts a server span per request; nil disables tracing.
+	Tracer *tracing.Tracer
+	// RequestTimeout bounds the context of every request; zero means none.
+	RequestTimeout time.Duration
+	// MaxBodyBytes caps request bodies, except on routes listed in
+	// routeBodyLimits; zero means no limit.
+	MaxBodyBytes int64
+	// Health backs /readyz and /startupz; when nil the service counts as
+	// started and has no checks.
+	Health *health.Registry
+}
+
 type Handlers struct {
-	service *service.Service
+	service        *service.Service
+	registry       *metrics.Registry
+	metrics        httpMetrics
+	logger         *slog.Logger
+	tracer         *tracing.Tracer
+	requestTimeout time.Duration
+	maxBodyBytes   int64
+	health         *health.Registry
 }
 
-func NewHandlers(svc *service.Service) *Handlers {
-	return &Handlers{service: svc}
+func NewHandlers(svc *service.Service, opts Options) *Handlers {
+	h := &Handlers{
+		service:        svc,
+		registry:       opts.Metrics,
+		logger:         opts.Logger,
+		tracer:         opts.Tracer,
+		requestTimeout: opts.RequestTimeout,
+		maxBodyBytes:   opts.MaxBodyBytes,
+		health:         opts.Health,
+	}
+	if h.registry == nil {
+		h.registry = metrics.NewRegistry()
+	}
+	if h.logger == nil {
+		h.logger = slog.Default()
+	}
+	if h.health == nil {
+		h.health = health.NewRegistry()
+		h.health.MarkStarted()
+	}
+	h.metrics = newHTTPMetrics(h.registry)
+	return h
 }
 
 func (h *Handlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Error encoding JSON response: %v", err)
+		h.logger.Error("encoding JSON response failed",
+			"request_id", w.Header().Get(logging.RequestIDHeader), "error", err)
 	}
 }
 
+// writeError echoes the request id that handle put on the response, so a
+// client can quote it when reporting the failure.
 func (h *Handlers) writeError(w http.ResponseWriter, status int, code, message string) {
 	h.writeJSON(w, status, models.ErrorResponse{
 		Error: models.ErrorDetail{
 			Code:    code,
 			Message: message,
 		},
+		RequestID: w.Header().Get(logging.RequestIDHeader),
 	})
 }
 
-func (h *Handlers) handleServiceError(w http.ResponseWriter, err error) {
+// writeBodyError reports a body that could not be read or decoded, and one
+// cut off by the size limit as 413.
+func (h *Handlers) writeBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.writeError(w, http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE",
+			fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+		return
+	}
+	h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+}
+
+func (h *Handlers) handleServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	if service.IsRetryable(err) {
+		markRetryable(w)
+	}
+
+	var blocked *service.MergeBlockedError
+	if errors.As(err, &blocked) {
+		h.writeError(w, http.StatusConflict, "MERGE_BLOCKED", blocked.Error())
+		return
+	}
+	if service.IsTimeout(err) {
+		h.logger.WarnContext(r.Context(), "request timed out", "error", err)
+		h.writeError(w, http.StatusGatewayTimeout, "TIMEOUT", "request did not complete in time, retry it")
+		return
+	}
+
 	switch err {
 	case service.ErrTeamExists:
 		h.writeError(w, http.StatusBadRequest, "TEAM_EXISTS", "team_name already exists")
-	case service.ErrTeamNotFound, service.ErrUserNotFound, service.ErrPRNotFound:
+	case service.ErrTeamNotFound, service.ErrUserNotFound, service.ErrPRNotFound, service.ErrAbsenceNotFound,
+		service.ErrWebhookNotFound, service.ErrDeliveryNotFound, service.ErrTokenNotFound:
 		h.writeError(w, http.StatusNotFound, "NOT_FOUND", "resource not found")
 	case service.ErrPRExists:
 		h.writeError(w, http.StatusConflict, "PR_EXISTS", "PR id already exists")
 	case service.ErrPRMerged:
-		h.writeError(w, http.StatusConflict, "PR_MERGED", "cannot reassign on merged PR")
+		h.writeError(w, http.StatusConflict, "PR_MERGED", "pull request is merged")
+	case service.ErrPRClosed:
+		h.writeError(w, http.StatusConflict, "PR_CLOSED", "operation not allowed on closed PR")
+	case service.ErrPRDraft:
+		h.writeError(w, http.StatusConflict, "PR_DRAFT", "PR is a draft")
 	case service.ErrNotAssigned:
 		h.writeError(w, http.StatusConflict, "NOT_ASSIGNED", "reviewer is not assigned to this PR")
+	case service.ErrInvalidMergePolicy:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "min_approvals must not be negative")
+	case service.ErrInvalidReviewersCount:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST",
+			fmt.Sprintf("reviewers count must be between 0 (team default) and %d", models.MaxReviewersPerPR))
+	case service.ErrInvalidAbsence:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "ends_at must be after starts_at and in the future")
+	case service.ErrInvalidCapacityFallback:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "capacity_fallback must be least_loaded or error")
+	case service.ErrInvalidMaxOpenReviews:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "max_open_reviews must not be negative")
+	case service.ErrInvalidStrategy:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "unknown reviewer strategy")
+	case service.ErrInvalidReviewState:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "state must be APPROVED, CHANGES_REQUESTED or COMMENTED")
+	case service.ErrAllAtCapacity:
+		h.writeError(w, http.StatusConflict, "ALL_AT_CAPACITY", "all candidates reached their open review limit")
+	case service.ErrVersionMismatch:
+		h.writeError(w, http.StatusPreconditionFailed, "PRECONDITION_FAILED", "resource version does not match If-Match")
+	case service.ErrConcurrentUpdate:
+		h.writeError(w, http.StatusConflict, "CONCURRENT_UPDATE", "resource was modified concurrently, retry the request")
+	case service.ErrIdempotencyKeyReused:
+		h.writeError(w, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED",
+			"Idempotency-Key was already used with a different request")
+	case service.ErrIdempotencyInProgress:
+		h.writeError(w, http.StatusConflict, "IDEMPOTENCY_IN_PROGRESS",
+			"a request with this Idempotency-Key is still in progress")
+	case service.ErrInvalidEventFilter:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST",
+			fmt.Sprintf("limit must be between 0 and %d, after_id must not be negative and since must be before until",
+				service.MaxEventsLimit))
+	case service.ErrInvalidWebhook:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST",
+			"url must be an http(s) URL, secret is required and event_types must be one of "+
+				strings.Join(service.WebhookEventTypes, ", "))
+	case service.ErrInvalidDeliveryFilter:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST",
+			fmt.Sprintf("status must be PENDING, DELIVERED or DEAD and limit between 0 and %d", service.MaxEventsLimit))
+	case service.ErrDeliveryNotDead:
+		h.writeError(w, http.StatusConflict, "DELIVERY_NOT_DEAD", "only DEAD deliveries can be retried")
+	case service.ErrIntegrationDisabled:
+		h.writeError(w, http.StatusNotFound, "NOT_CONFIGURED", "integration is not configured")
+	case service.ErrInvalidSignature:
+		h.writeError(w, http.StatusUnauthorized, "INVALID_SIGNATURE", "webhook signature or token does not match")
+	case service.ErrInvalidPayload:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "unsupported webhook payload")
+	case service.ErrUnknownAccount:
+		h.writeError(w, http.StatusUnprocessableEntity, "UNKNOWN_ACCOUNT", "account is not mapped to a user")
+	case service.ErrInvalidAccount:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "provider must be github or gitlab and login is required")
+	case service.ErrUnauthenticated:
+		h.writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "a valid bearer token is required")
+	case service.ErrForbidden:
+		h.writeError(w, http.StatusForbidden, "FORBIDDEN", "the caller's role does not allow this operation")
+	case service.ErrUnboundToken:
+		h.writeError(w, http.StatusForbidden, "FORBIDDEN", "token is not bound to a user; only admin tokens may act for others")
+	case service.ErrInvalidRole:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "role must be lead or member")
+	case service.ErrInsufficientScope:
+		h.writeError(w, http.StatusForbidden, "INSUFFICIENT_SCOPE", "token scope does not allow this operation")
+	case service.ErrInvalidToken:
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "name is required and scopes must be admin, write or read")
 	case service.ErrNoCandidate:
 		h.writeError(w, http.StatusConflict, "NO_CANDIDATE", "no active replacement candidate in team")
 	default:
-		log.Printf("Unexpected error: %v", err)
+		h.logger.ErrorContext(r.Context(), "unexpected error", "error", err)
 		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
 	}
 }
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"pr-review-service/internal/database"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/service"
+	"strings"
+	"testing"
+)
+
+func newTestHandlers(t *testing.T, opts Options) *Handlers {
+	t.Helper()
+	opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewHandlers(service.NewService(database.NewMemoryStore(), service.Options{}), opts)
+}
+
+// withToken marks r as authenticated the way requireScope does.
+func withToken(r *http.Request, tokenID int64) *http.Request {
+	token := &models.APIToken{TokenID: tokenID, Scopes: []string{models.ScopeWrite}}
+	return r.WithContext(context.WithValue(r.Context(), tokenContextKey{}, token))
+}
+
+func TestOversizedBodyIsRejectedWith413(t *testing.T) {
+	h := newTestHandlers(t, Options{MaxBodyBytes: 64})
+	mux := http.NewServeMux()
+	h.SetupRoutes(mux)
+	issued, err := h.service.IssueAPIToken(context.Background(), "ci", "", []string{models.ScopeWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"team_name":"backend","members":[{"user_id":"` + strings.Repeat("u", 100) + `"}]}`
+	r := httptest.NewRequest(http.MethodPost, "/team/add", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+issued.Token)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "PAYLOAD_TOO_LARGE") {
+		t.Fatalf("POST /team/add = %d %s, want 413 PAYLOAD_TOO_LARGE", w.Code, w.Body)
+	}
+}
@@ -4,14 +4,57 @@ import (
 	"net/http"
 )
 
+// GET /livez
+// Liveness only says the process serves HTTP; it never touches dependencies,
+// so a database outage does not get the service restarted.
+func (h *Handlers) Livez(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// GET /readyz
+func (h *Handlers) Readyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := h.health.Check(r.Context())
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	h.writeJSON(w, status, report)
+}
+
+// GET /startupz
+// Startup stays unavailable until schema initialization has finished.
+func (h *Handlers) Startupz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.health.Started() {
+		h.writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "starting"})
+		return
+	}
+	h.writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
 // GET /health
+// Kept for existing monitors: plain-text readiness.
 func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if err := h.service.HealthCheck(); err != nil {
+	if !h.health.Check(r.Context()).Ready() {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
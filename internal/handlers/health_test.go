@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"pr-review-service/internal/health"
+	"testing"
+)
+
+func TestReadinessFailsOnceShutdownStarts(t *testing.T) {
+	probes := health.NewRegistry()
+	probes.MarkStarted()
+	h := newTestHandlers(t, Options{Health: probes})
+	mux := http.NewServeMux()
+	h.SetupRoutes(mux)
+
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	if code := get("/readyz"); code != http.StatusOK {
+		t.Fatalf("/readyz before shutdown = %d, want 200", code)
+	}
+	probes.StartShutdown()
+	for path, want := range map[string]int{
+		"/readyz": http.StatusServiceUnavailable,
+		"/health": http.StatusServiceUnavailable,
+		"/livez":  http.StatusOK,
+	} {
+		if code := get(path); code != want {
+			t.Errorf("%s after StartShutdown = %d, want %d", path, code, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+)
+
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	maxIdempotencyKeyLength = 255
+)
+
+// idempotent lets clients retry a POST safely: a repeated request with the
+// same Idempotency-Key gets the stored response of the first one instead of
+// being executed again. Keys are scoped to the caller's token, so two
+// clients cannot see each other's responses by picking the same key.
+func (h *Handlers) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || r.Method != http.MethodPost {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "Idempotency-Key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.writeBodyError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key = callerFromRequest(r).Source + " " + key
+		record, err := h.service.BeginIdempotentRequest(r.Context(), key, requestHash(r, body))
+		if err != nil {
+			h.handleServiceError(w, r, err)
+			return
+		}
+		if record != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			if record.ETag != "" {
+				w.Header().Set("ETag", record.ETag)
+			}
+			w.WriteHeader(record.StatusCode)
+			if _, err := w.Write(record.Body); err != nil {
+				h.logger.ErrorContext(r.Context(), "writing replayed response failed", "error", err)
+			}
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		// A panicking handler must not leave the key reserved forever, and
+		// neither must one that ran out of time, so the key is released
+		// even after the request's context is done. Responses asking the
+		// client to retry are not stored either.
+		defer func() {
+			ctx := context.WithoutCancel(r.Context())
+			if rec.retryable {
+				if err := h.service.ReleaseIdempotentRequest(ctx, key); err != nil {
+					h.logger.ErrorContext(r.Context(), "releasing idempotency key failed", "error", err)
+				}
+				return
+			}
+			status := rec.status
+			if !rec.done {
+				status = http.StatusInternalServerError
+			}
+			etag := rec.Header().Get("ETag")
+			if err := h.service.FinishIdempotentRequest(ctx, key, status, etag, rec.body.Bytes()); err != nil {
+				h.logger.ErrorContext(r.Context(), "storing idempotent response failed", "error", err)
+			}
+		}()
+
+		next(rec, r)
+		rec.done = true
+	}
+}
+
+// requestHash covers If-Match too: the same body sent against another
+// version is a different request.
+func requestHash(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write([]byte(r.Header.Get("If-Match") + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder passes the response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	done      bool
+	retryable bool
+}
+
+// markRetryable keeps the response to an idempotent request from being
+// replayed, so a retry with the same key runs again.
+func markRetryable(w http.ResponseWriter) {
+	if rec, ok := w.(*responseRecorder); ok {
+		rec.retryable = true
+	}
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	rec.body.Write(p)
+	return rec.ResponseWriter.Write(p)
+}
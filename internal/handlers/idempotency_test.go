@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"pr-review-service/internal/service"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func postWithKey(h http.HandlerFunc, tokenID int64, key, ifMatch, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/team/setDefaultReviewers", strings.NewReader(body))
+	r.Header.Set(idempotencyKeyHeader, key)
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	h(w, withToken(r, tokenID))
+	return w
+}
+
+func TestIdempotentReplaysTheStoredResponse(t *testing.T) {
+	h := newTestHandlers(t, Options{})
+	var calls atomic.Int32
+	handler := h.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		setETag(w, 7)
+		h.writeJSON(w, http.StatusCreated, map[string]string{"ok": "yes"})
+	})
+
+	first := postWithKey(handler, 1, "k1", `"6"`, `{"a":1}`)
+	replay := postWithKey(handler, 1, "k1", `"6"`, `{"a":1}`)
+	if calls.Load() != 1 {
+		t.Fatalf("handler ran %d times, want once", calls.Load())
+	}
+	if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() ||
+		replay.Header().Get("Idempotent-Replayed") != "true" || replay.Header().Get("ETag") != `"7"` {
+		t.Fatalf("replay = %d %q, headers %v", replay.Code, replay.Body, replay.Header())
+	}
+
+	if w := postWithKey(handler, 2, "k1", `"6"`, `{"a":1}`); w.Code != http.StatusCreated ||
+		w.Header().Get("Idempotent-Replayed") != "" || calls.Load() != 2 {
+		t.Fatalf("another token's request = %d, headers %v; want it executed", w.Code, w.Header())
+	}
+}
+
+func TestIdempotentRejectsAReusedKey(t *testing.T) {
+	h := newTestHandlers(t, Options{})
+	handler := h.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		h.writeJSON(w, http.StatusOK, map[string]string{})
+	})
+
+	postWithKey(handler, 1, "k1", `"1"`, `{"a":1}`)
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"body":     postWithKey(handler, 1, "k1", `"1"`, `{"a":2}`),
+		"If-Match": postWithKey(handler, 1, "k1", `"2"`, `{"a":1}`),
+	} {
+		if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "IDEMPOTENCY_KEY_REUSED") {
+			t.Errorf("different %s: %d %s, want 422 IDEMPOTENCY_KEY_REUSED", name, w.Code, w.Body)
+		}
+	}
+}
+
+func TestIdempotentRejectsARetryWhileTheFirstRuns(t *testing.T) {
+	h := newTestHandlers(t, Options{})
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := h.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		h.writeJSON(w, http.StatusOK, map[string]string{})
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postWithKey(handler, 1, "k1", "", `{}`) }()
+	<-started
+
+	w := postWithKey(handler, 1, "k1", "", `{}`)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "IDEMPOTENCY_IN_PROGRESS") {
+		t.Fatalf("retry while running: %d %s, want 409 IDEMPOTENCY_IN_PROGRESS", w.Code, w.Body)
+	}
+
+	close(release)
+	if first := <-done; first.Code != http.StatusOK {
+		t.Fatalf("first request = %d %s", first.Code, first.Body)
+	}
+}
+
+func TestIdempotentRunsARetryAfterAConflict(t *testing.T) {
+	h := newTestHandlers(t, Options{})
+	var calls atomic.Int32
+	handler := h.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			h.handleServiceError(w, r, service.ErrConcurrentUpdate)
+			return
+		}
+		h.writeJSON(w, http.StatusOK, map[string]string{"ok": "yes"})
+	})
+
+	if w := postWithKey(handler, 1, "k1", "", `{}`); w.Code != http.StatusConflict {
+		t.Fatalf("first attempt = %d %s, want 409", w.Code, w.Body)
+	}
+	w := postWithKey(handler, 1, "k1", "", `{}`)
+	if w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" || calls.Load() != 2 {
+		t.Fatalf("retry = %d %s, headers %v; want it executed", w.Code, w.Body, w.Header())
+	}
+	if replay := postWithKey(handler, 1, "k1", "", `{}`); replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("second retry was not replayed: %d %s", replay.Code, replay.Body)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"pr-review-service/internal/models"
+	"strconv"
+)
+
+// maxInboundPayload bounds provider webhook bodies.
+const maxInboundPayload = 5 << 20
+
+// routeBodyLimits overrides Options.MaxBodyBytes for routes whose senders we
+// do not control.
+var routeBodyLimits = map[string]int64{
+	"/integrations/github": maxInboundPayload,
+	"/integrations/gitlab": maxInboundPayload,
+}
+
+// POST /integrations/github
+func (h *Handlers) GitHubWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInboundPayload))
+	if err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	result, err := h.service.HandleGitHubWebhook(
+		r.Context(), r.Header.Get("X-GitHub-Event"), r.Header.Get("X-Hub-Signature-256"), body,
+	)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeInboundResult(w, result)
+}
+
+// POST /integrations/gitlab
+func (h *Handlers) GitLabWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInboundPayload))
+	if err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	result, err := h.service.HandleGitLabWebhook(
+		r.Context(), r.Header.Get("X-Gitlab-Event"), r.Header.Get("X-Gitlab-Token"), body,
+	)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeInboundResult(w, result)
+}
+
+// writeInboundResult answers 202 for rejected events: the delivery was
+// received and stored, so the provider must not retry or disable the hook.
+func (h *Handlers) writeInboundResult(w http.ResponseWriter, result *models.InboundResult) {
+	status := http.StatusOK
+	if result.Rejected {
+		status = http.StatusAccepted
+	}
+	h.writeJSON(w, status, result)
+}
+
+// POST /integrations/setAccount
+func (h *Handlers) SetExternalAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var account models.ExternalAccount
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	saved, err := h.service.SetExternalAccount(r.Context(), &account)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"account": saved})
+}
+
+// GET /integrations/getAccounts
+func (h *Handlers) GetExternalAccounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	accounts, err := h.service.ListExternalAccounts(r.Context(), r.URL.Query().Get("provider"))
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"accounts": accounts})
+}
+
+// GET /integrations/rejectedEvents
+func (h *Handlers) GetRejectedEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var limit int
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil {
+			h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "limit must be an integer")
+			return
+		}
+	}
+
+	events, err := h.service.ListRejectedEvents(r.Context(), r.URL.Query().Get("provider"), limit)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"rejected_events": events})
+}
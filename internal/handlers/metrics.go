@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"pr-review-service/internal/logging"
+	"pr-review-service/internal/metrics"
+	"pr-review-service/internal/tracing"
+	"strconv"
+	"time"
+)
+
+type httpMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+func newHTTPMetrics(reg *metrics.Registry) httpMetrics {
+	return httpMetrics{
+		requests: reg.Counter("pr_review_http_requests_total",
+			"HTTP requests by route, method and status.", "route", "method", "status"),
+		duration: reg.Histogram("pr_review_http_request_duration_seconds",
+			"HTTP request latency by route and status.", metrics.DefaultBuckets, "route", "status"),
+	}
+}
+
+// handle registers next on mux and records its requests under route, so the
+// label stays bounded whatever paths clients send. It also assigns the request
+// id, keeping a valid X-Request-ID from the client, starts the server span,
+// continuing the caller's traceparent, applies the request timeout and body
+// size limit and writes the access log.
+func (h *Handlers) handle(mux *http.ServeMux, route string, next http.HandlerFunc) {
+	mux.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := logging.RequestIDFromHeader(r.Header.Get(logging.RequestIDHeader))
+		w.Header().Set(logging.RequestIDHeader, requestID)
+		ctx := logging.WithRequestID(tracing.Extract(r.Context(), r.Header), requestID)
+		ctx, span := h.tracer.Start(ctx, r.Method+" "+route, tracing.KindServer)
+		defer span.End()
+		if h.requestTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, h.requestTimeout)
+			defer cancel()
+		}
+		r = r.WithContext(ctx)
+		if limit := h.bodyLimit(route); limit > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		span.SetAttr("http.method", r.Method)
+		span.SetAttr("http.route", route)
+		span.SetAttr("http.target", r.URL.Path)
+		span.SetAttr("http.status_code", rec.status)
+		span.SetAttr("request_id", requestID)
+		if rec.status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(rec.status)))
+		}
+
+		elapsed := time.Since(start)
+		status := strconv.Itoa(rec.status)
+		h.metrics.requests.Inc(route, r.Method, status)
+		h.metrics.duration.Observe(elapsed.Seconds(), route, status)
+		h.logger.LogAttrs(r.Context(), slog.LevelInfo, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", rec.status),
+			slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	})
+}
+
+func (h *Handlers) bodyLimit(route string) int64 {
+	if limit, ok := routeBodyLimits[route]; ok {
+		return limit
+	}
+	return h.maxBodyBytes
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
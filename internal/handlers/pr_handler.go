@@ -3,8 +3,17 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"pr-review-service/internal/models"
 )
 
+func prResponse(pr *models.PullRequest, warning string) map[string]interface{} {
+	resp := map[string]interface{}{"pr": pr}
+	if warning != "" {
+		resp["warning"] = warning
+	}
+	return resp
+}
+
 // POST /pullRequest/create
 func (h *Handlers) CreatePullRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -16,19 +25,24 @@ func (h *Handlers) CreatePullRequest(w http.ResponseWriter, r *http.Request) {
 		PullRequestID   string `json:"pull_request_id"`
 		PullRequestName string `json:"pull_request_name"`
 		AuthorID        string `json:"author_id"`
+		IsDraft         bool   `json:"is_draft"`
+		ReviewersCount  int    `json:"reviewers_count"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		h.writeBodyError(w, err)
 		return
 	}
 
-	pr, err := h.service.CreatePullRequest(req.PullRequestID, req.PullRequestName, req.AuthorID)
+	pr, warning, err := h.service.CreatePullRequest(
+		r.Context(), req.PullRequestID, req.PullRequestName, req.AuthorID, req.IsDraft, req.ReviewersCount,
+	)
 	if err != nil {
-		h.handleServiceError(w, err)
+		h.handleServiceError(w, r, err)
 		return
 	}
 
-	h.writeJSON(w, http.StatusCreated, map[string]interface{}{"pr": pr})
+	setETag(w, pr.Version)
+	h.writeJSON(w, http.StatusCreated, prResponse(pr, warning))
 }
 
 // POST /pullRequest/merge
@@ -38,20 +52,27 @@ func (h *Handlers) MergePullRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
 	var req struct {
 		PullRequestID string `json:"pull_request_id"`
+		MergedBy      string `json:"merged_by"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		h.writeBodyError(w, err)
 		return
 	}
 
-	pr, err := h.service.MergePullRequest(req.PullRequestID)
+	pr, err := h.service.MergePullRequest(r.Context(), callerFromRequest(r), req.PullRequestID, req.MergedBy, version)
 	if err != nil {
-		h.handleServiceError(w, err)
+		h.handleServiceError(w, r, err)
 		return
 	}
 
+	setETag(w, pr.Version)
 	h.writeJSON(w, http.StatusOK, map[string]interface{}{"pr": pr})
 }
 
@@ -62,23 +83,155 @@ func (h *Handlers) ReassignReviewer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
 	var req struct {
 		PullRequestID string `json:"pull_request_id"`
 		OldUserID     string `json:"old_user_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		h.writeBodyError(w, err)
 		return
 	}
 
-	pr, newReviewerID, err := h.service.ReassignReviewer(req.PullRequestID, req.OldUserID)
+	pr, newReviewerID, err := h.service.ReassignReviewer(
+		r.Context(), callerFromRequest(r), req.PullRequestID, req.OldUserID, version,
+	)
 	if err != nil {
-		h.handleServiceError(w, err)
+		h.handleServiceError(w, r, err)
 		return
 	}
 
+	setETag(w, pr.Version)
 	h.writeJSON(w, http.StatusOK, map[string]interface{}{
 		"pr":          pr,
 		"replaced_by": newReviewerID,
 	})
 }
+
+// POST /pullRequest/review
+func (h *Handlers) SubmitReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+		ReviewerID    string `json:"reviewer_id"`
+		State         string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	pr, err := h.service.SubmitReview(
+		r.Context(), callerFromRequest(r), req.PullRequestID, req.ReviewerID, req.State, version,
+	)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	setETag(w, pr.Version)
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"pr": pr})
+}
+
+// POST /pullRequest/close
+func (h *Handlers) ClosePullRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	pr, err := h.service.ClosePullRequest(r.Context(), callerFromRequest(r), req.PullRequestID, version)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	setETag(w, pr.Version)
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"pr": pr})
+}
+
+// POST /pullRequest/reopen
+func (h *Handlers) ReopenPullRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	pr, err := h.service.ReopenPullRequest(r.Context(), callerFromRequest(r), req.PullRequestID, version)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	setETag(w, pr.Version)
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"pr": pr})
+}
+
+// POST /pullRequest/markReady
+func (h *Handlers) MarkReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	pr, warning, err := h.service.MarkReady(r.Context(), callerFromRequest(r), req.PullRequestID, version)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	setETag(w, pr.Version)
+	h.writeJSON(w, http.StatusOK, prResponse(pr, warning))
+}
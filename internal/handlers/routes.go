@@ -2,10 +2,16 @@ package handlers
 
 import (
 	"net/http"
+	"pr-review-service/internal/models"
 )
 
+// SetupRoutes registers every endpoint with the token scope it requires.
+// Authentication runs before idempotency so a replayed response is never
+// served to an unauthorized caller. The provider webhooks verify their own
+// signatures, and the health probes and /metrics stay open for probes and
+// scrapers.
 func (h *Handlers) SetupRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	h.handle(mux, "/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/" {
 			http.ServeFile(w, r, "static/index.html")
 		} else {
@@ -13,14 +19,48 @@ func (h *Handlers) SetupRoutes(mux *http.ServeMux) {
 		}
 	})
 
-	mux.HandleFunc("/team/add", h.AddTeam)
-	mux.HandleFunc("/team/get", h.GetTeam)
-	mux.HandleFunc("/team/bulkDeactivate", h.BulkDeactivateTeam)
-	mux.HandleFunc("/users/setIsActive", h.SetUserActive)
-	mux.HandleFunc("/users/getReview", h.GetUserReview)
-	mux.HandleFunc("/pullRequest/create", h.CreatePullRequest)
-	mux.HandleFunc("/pullRequest/merge", h.MergePullRequest)
-	mux.HandleFunc("/pullRequest/reassign", h.ReassignReviewer)
-	mux.HandleFunc("/stats", h.GetStats)
-	mux.HandleFunc("/health", h.HealthCheck)
+	h.handle(mux, "/team/add", h.requireScope(models.ScopeWrite, h.idempotent(h.AddTeam)))
+	h.handle(mux, "/team/get", h.requireScope(models.ScopeRead, h.GetTeam))
+	h.handle(mux, "/team/bulkDeactivate", h.requireScope(models.ScopeWrite, h.idempotent(h.BulkDeactivateTeam)))
+	h.handle(mux, "/team/setReviewerStrategy", h.requireScope(models.ScopeWrite, h.idempotent(h.SetTeamReviewerStrategy)))
+	h.handle(mux, "/team/setDefaultReviewers", h.requireScope(models.ScopeWrite, h.idempotent(h.SetTeamDefaultReviewers)))
+	h.handle(mux, "/team/setCapacityFallback", h.requireScope(models.ScopeWrite, h.idempotent(h.SetTeamCapacityFallback)))
+	h.handle(mux, "/team/getMergePolicy", h.requireScope(models.ScopeRead, h.GetMergePolicy))
+	h.handle(mux, "/team/setMergePolicy", h.requireScope(models.ScopeAdmin, h.idempotent(h.SetMergePolicy)))
+	h.handle(mux, "/users/setIsActive", h.requireScope(models.ScopeWrite, h.idempotent(h.SetUserActive)))
+	h.handle(mux, "/users/setRole", h.requireScope(models.ScopeWrite, h.idempotent(h.SetUserRole)))
+	h.handle(mux, "/users/setMaxOpenReviews", h.requireScope(models.ScopeWrite, h.idempotent(h.SetUserMaxOpenReviews)))
+	h.handle(mux, "/users/getReview", h.requireScope(models.ScopeRead, h.GetUserReview))
+	h.handle(mux, "/users/addAbsence", h.requireScope(models.ScopeWrite, h.idempotent(h.AddAbsence)))
+	h.handle(mux, "/users/getAbsences", h.requireScope(models.ScopeRead, h.GetAbsences))
+	h.handle(mux, "/users/cancelAbsence", h.requireScope(models.ScopeWrite, h.idempotent(h.CancelAbsence)))
+	h.handle(mux, "/pullRequest/create", h.requireScope(models.ScopeWrite, h.idempotent(h.CreatePullRequest)))
+	h.handle(mux, "/pullRequest/merge", h.requireScope(models.ScopeWrite, h.idempotent(h.MergePullRequest)))
+	h.handle(mux, "/pullRequest/markReady", h.requireScope(models.ScopeWrite, h.idempotent(h.MarkReady)))
+	h.handle(mux, "/pullRequest/close", h.requireScope(models.ScopeWrite, h.idempotent(h.ClosePullRequest)))
+	h.handle(mux, "/pullRequest/reopen", h.requireScope(models.ScopeWrite, h.idempotent(h.ReopenPullRequest)))
+	h.handle(mux, "/pullRequest/reassign", h.requireScope(models.ScopeWrite, h.idempotent(h.ReassignReviewer)))
+	h.handle(mux, "/pullRequest/review", h.requireScope(models.ScopeWrite, h.idempotent(h.SubmitReview)))
+	h.handle(mux, "/pullRequest/history", h.requireScope(models.ScopeRead, h.GetPullRequestHistory))
+	h.handle(mux, "/audit", h.requireScope(models.ScopeAdmin, h.ListEvents))
+	h.handle(mux, "/webhooks/add", h.requireScope(models.ScopeAdmin, h.idempotent(h.AddWebhook)))
+	h.handle(mux, "/webhooks/list", h.requireScope(models.ScopeAdmin, h.ListWebhooks))
+	h.handle(mux, "/webhooks/delete", h.requireScope(models.ScopeAdmin, h.idempotent(h.DeleteWebhook)))
+	h.handle(mux, "/webhooks/deliveries", h.requireScope(models.ScopeAdmin, h.ListWebhookDeliveries))
+	h.handle(mux, "/webhooks/retryDelivery", h.requireScope(models.ScopeAdmin, h.idempotent(h.RetryWebhookDelivery)))
+	h.handle(mux, "/integrations/github", h.GitHubWebhook)
+	h.handle(mux, "/integrations/gitlab", h.GitLabWebhook)
+	h.handle(mux, "/integrations/rejectedEvents", h.requireScope(models.ScopeAdmin, h.GetRejectedEvents))
+	h.handle(mux, "/integrations/setAccount", h.requireScope(models.ScopeAdmin, h.idempotent(h.SetExternalAccount)))
+	h.handle(mux, "/integrations/getAccounts", h.requireScope(models.ScopeAdmin, h.GetExternalAccounts))
+	// Not idempotent: a stored response would keep the token secret in the database.
+	h.handle(mux, "/tokens/issue", h.requireScope(models.ScopeAdmin, h.IssueToken))
+	h.handle(mux, "/tokens/list", h.requireScope(models.ScopeAdmin, h.ListTokens))
+	h.handle(mux, "/tokens/revoke", h.requireScope(models.ScopeAdmin, h.idempotent(h.RevokeToken)))
+	h.handle(mux, "/stats", h.requireScope(models.ScopeRead, h.GetStats))
+	h.handle(mux, "/health", h.HealthCheck)
+	h.handle(mux, "/livez", h.Livez)
+	h.handle(mux, "/readyz", h.Readyz)
+	h.handle(mux, "/startupz", h.Startupz)
+	mux.Handle("/metrics", h.registry.Handler(h.logger))
 }
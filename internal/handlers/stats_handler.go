@@ -11,9 +11,9 @@ func (h *Handlers) GetStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stats, err := h.service.GetStats()
+	stats, err := h.service.GetStats(r.Context())
 	if err != nil {
-		h.handleServiceError(w, err)
+		h.handleServiceError(w, r, err)
 		return
 	}
 
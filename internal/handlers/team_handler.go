@@ -15,15 +15,16 @@ func (h *Handlers) AddTeam(w http.ResponseWriter, r *http.Request) {
 
 	var team models.Team
 	if err := json.NewDecoder(r.Body).Decode(&team); err != nil {
-		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		h.writeBodyError(w, err)
 		return
 	}
 
-	if err := h.service.CreateTeam(&team); err != nil {
-		h.handleServiceError(w, err)
+	if err := h.service.CreateTeam(r.Context(), callerFromRequest(r), &team); err != nil {
+		h.handleServiceError(w, r, err)
 		return
 	}
 
+	setETag(w, team.Version)
 	h.writeJSON(w, http.StatusCreated, map[string]interface{}{"team": team})
 }
 
@@ -40,12 +41,13 @@ func (h *Handlers) GetTeam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	team, err := h.service.GetTeam(teamName)
+	team, err := h.service.GetTeam(r.Context(), teamName)
 	if err != nil {
-		h.handleServiceError(w, err)
+		h.handleServiceError(w, r, err)
 		return
 	}
 
+	setETag(w, team.Version)
 	h.writeJSON(w, http.StatusOK, team)
 }
 
@@ -56,9 +58,14 @@ func (h *Handlers) BulkDeactivateTeam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
 	var req models.BulkDeactivateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		h.writeBodyError(w, err)
 		return
 	}
 
@@ -67,11 +74,181 @@ func (h *Handlers) BulkDeactivateTeam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.service.BulkDeactivateTeamUsers(req.TeamName)
+	result, err := h.service.BulkDeactivateTeamUsers(r.Context(), callerFromRequest(r), req.TeamName, version)
 	if err != nil {
-		h.handleServiceError(w, err)
+		h.handleServiceError(w, r, err)
 		return
 	}
 
 	h.writeJSON(w, http.StatusOK, result)
 }
+
+// POST /team/setReviewerStrategy
+func (h *Handlers) SetTeamReviewerStrategy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		TeamName         string `json:"team_name"`
+		ReviewerStrategy string `json:"reviewer_strategy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	if req.TeamName == "" {
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "team_name is required")
+		return
+	}
+
+	team, err := h.service.SetTeamReviewerStrategy(
+		r.Context(), callerFromRequest(r), req.TeamName, req.ReviewerStrategy, version,
+	)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	setETag(w, team.Version)
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"team": team})
+}
+
+// GET /team/getMergePolicy
+func (h *Handlers) GetMergePolicy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	teamName := r.URL.Query().Get("team_name")
+	if teamName == "" {
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "team_name parameter is required")
+		return
+	}
+
+	policy, err := h.service.GetMergePolicy(r.Context(), teamName)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	setETag(w, policy.Version)
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"policy": policy})
+}
+
+// POST /team/setMergePolicy
+func (h *Handlers) SetMergePolicy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var policy models.MergePolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	if policy.TeamName == "" {
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "team_name is required")
+		return
+	}
+
+	updated, err := h.service.SetMergePolicy(r.Context(), callerFromRequest(r), &policy, version)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	setETag(w, updated.Version)
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"policy": updated})
+}
+
+// POST /team/setDefaultReviewers
+func (h *Handlers) SetTeamDefaultReviewers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		TeamName         string `json:"team_name"`
+		DefaultReviewers int    `json:"default_reviewers"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	if req.TeamName == "" {
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "team_name is required")
+		return
+	}
+
+	team, err := h.service.SetTeamDefaultReviewers(
+		r.Context(), callerFromRequest(r), req.TeamName, req.DefaultReviewers, version,
+	)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	setETag(w, team.Version)
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"team": team})
+}
+
+// POST /team/setCapacityFallback
+func (h *Handlers) SetTeamCapacityFallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		TeamName         string `json:"team_name"`
+		CapacityFallback string `json:"capacity_fallback"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	if req.TeamName == "" {
+		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "team_name is required")
+		return
+	}
+
+	team, err := h.service.SetTeamCapacityFallback(
+		r.Context(), callerFromRequest(r), req.TeamName, req.CapacityFallback, version,
+	)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	setETag(w, team.Version)
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"team": team})
+}
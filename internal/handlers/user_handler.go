@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 )
 
 // POST /users/setIsActive
@@ -12,21 +13,58 @@ func (h *Handlers) SetUserActive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
 	var req struct {
 		UserID   string `json:"user_id"`
 		IsActive bool   `json:"is_active"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		h.writeBodyError(w, err)
+		return
+	}
+
+	user, err := h.service.SetUserActive(r.Context(), callerFromRequest(r), req.UserID, req.IsActive, version)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	setETag(w, user.Version)
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"user": user})
+}
+
+// POST /users/setRole
+func (h *Handlers) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		UserID string `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeBodyError(w, err)
 		return
 	}
 
-	user, err := h.service.SetUserActive(req.UserID, req.IsActive)
+	user, err := h.service.SetUserRole(r.Context(), callerFromRequest(r), req.UserID, req.Role, version)
 	if err != nil {
-		h.handleServiceError(w, err)
+		h.handleServiceError(w, r, err)
 		return
 	}
 
+	setETag(w, user.Version)
 	h.writeJSON(w, http.StatusOK, map[string]interface{}{"user": user})
 }
 
@@ -43,9 +81,19 @@ func (h *Handlers) GetUserReview(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	prs, err := h.service.GetUserPullRequests(userID)
+	awaitingOnly := false
+	if raw := r.URL.Query().Get("awaiting"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "awaiting must be a boolean")
+			return
+		}
+		awaitingOnly = parsed
+	}
+
+	prs, err := h.service.GetUserPullRequests(r.Context(), userID, awaitingOnly)
 	if err != nil {
-		h.handleServiceError(w, err)
+		h.handleServiceError(w, r, err)
 		return
 	}
 
@@ -54,3 +102,36 @@ func (h *Handlers) GetUserReview(w http.ResponseWriter, r *http.Request) {
 		"pull_requests": prs,
 	})
 }
+
+// POST /users/setMaxOpenReviews
+func (h *Handlers) SetUserMaxOpenReviews(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		UserID         string `json:"user_id"`
+		MaxOpenReviews int    `json:"max_open_reviews"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeBodyError(w, err)
+		return
+	}
+
+	user, err := h.service.SetUserMaxOpenReviews(
+		r.Context(), callerFromRequest(r), req.UserID, req.MaxOpenReviews, version,
+	)
+	if err != nil {
+		h.handleServiceError(w, r, err)
+		return
+	}
+
+	setETag(w, user.Version)
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"user": user})
+}
@@ -0,0 +1,141 @@
+// Package health collects the checks behind the liveness, readiness and
+// startup probes. Any subsystem can register a check; the readiness report
+// runs all of them and lists each result with its latency.
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCheckTimeout bounds a single check, so one hung dependency cannot
+// stall the whole probe.
+const DefaultCheckTimeout = 2 * time.Second
+
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusStarting     = "starting"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Check returns nil when the dependency it covers is usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Registry holds the registered checks and the process lifecycle state: not
+// started until MarkStarted, shutting down after StartShutdown.
+type Registry struct {
+	timeout      time.Duration
+	mu           sync.RWMutex
+	checks       []namedCheck
+	started      atomic.Bool
+	shuttingDown atomic.Bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{timeout: DefaultCheckTimeout}
+}
+
+// Register adds a readiness check. Registering a name again replaces the
+// earlier check.
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.checks {
+		if r.checks[i].name == name {
+			r.checks[i].check = check
+			return
+		}
+	}
+	r.checks = append(r.checks, namedCheck{name: name, check: check})
+}
+
+// MarkStarted records that startup, including schema initialization, has
+// finished.
+func (r *Registry) MarkStarted() {
+	r.started.Store(true)
+}
+
+func (r *Registry) Started() bool {
+	return r.started.Load()
+}
+
+// StartShutdown makes the service report not ready from now on.
+func (r *Registry) StartShutdown() {
+	r.shuttingDown.Store(true)
+}
+
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+func (rep Report) Ready() bool {
+	return rep.Status == StatusOK
+}
+
+// Check runs every registered check concurrently and reports them in
+// registration order. The overall status is ok only when the service has
+// started, is not shutting down and every check passed.
+func (r *Registry) Check(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]namedCheck(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c namedCheck) {
+			defer wg.Done()
+			results[i] = r.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	if !r.Started() {
+		report.Status = StatusStarting
+	}
+	if r.shuttingDown.Load() {
+		report.Status = StatusShuttingDown
+	}
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, c namedCheck) Result {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.check(ctx)
+	result := Result{
+		Name:      c.name,
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,51 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistryReportsEachCheck(t *testing.T) {
+	reg := NewRegistry()
+	reg.timeout = 20 * time.Millisecond
+	reg.Register("database", func(context.Context) error { return nil })
+	reg.Register("queue", func(context.Context) error { return errors.New("stale") })
+	reg.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := reg.Check(context.Background())
+	if report.Status != StatusStarting || report.Ready() {
+		t.Fatalf("before MarkStarted: status = %q", report.Status)
+	}
+
+	reg.MarkStarted()
+	reg.Register("queue", func(context.Context) error { return nil })
+	report = reg.Check(context.Background())
+	if report.Status != StatusFail || len(report.Checks) != 3 {
+		t.Fatalf("report = %+v", report)
+	}
+	names := []string{"database", "queue", "slow"}
+	for i, result := range report.Checks {
+		if result.Name != names[i] {
+			t.Fatalf("check %d = %q, want registration order %v", i, result.Name, names)
+		}
+	}
+	if slow := report.Checks[2]; slow.Status != StatusFail || slow.Error != context.DeadlineExceeded.Error() ||
+		slow.LatencyMS < 20 {
+		t.Fatalf("slow check = %+v, want it cut off by the check timeout", slow)
+	}
+
+	reg.Register("slow", func(context.Context) error { return nil })
+	if report := reg.Check(context.Background()); !report.Ready() {
+		t.Fatalf("report = %+v, want ready", report)
+	}
+
+	reg.StartShutdown()
+	if report := reg.Check(context.Background()); report.Status != StatusShuttingDown {
+		t.Fatalf("after StartShutdown: status = %q", report.Status)
+	}
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLoggerAddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo).With("component", "test")
+
+	logger.DebugContext(context.Background(), "hidden")
+	logger.InfoContext(WithRequestID(context.Background(), "req-1"), "handled", "status", 200)
+	logger.Info("no request")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	var first, second map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if first["request_id"] != "req-1" || first["msg"] != "handled" || first["component"] != "test" {
+		t.Fatalf("unexpected record %v", first)
+	}
+	if _, ok := second["request_id"]; ok {
+		t.Fatalf("unexpected request_id in %v", second)
+	}
+}
+
+func TestRequestIDFromHeader(t *testing.T) {
+	if got := RequestIDFromHeader("abc-123.x"); got != "abc-123.x" {
+		t.Fatalf("expected client id to be kept, got %q", got)
+	}
+	for _, value := range []string{"", "bad id", strings.Repeat("a", maxRequestIDLength+1), "x\n{}"} {
+		got := RequestIDFromHeader(value)
+		if got == value || len(got) != 32 {
+			t.Fatalf("expected generated id for %q, got %q", value, got)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel("WARN"); err != nil || level != slog.LevelWarn {
+		t.Fatalf("got %v, %v", level, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Fatal("expected error for unknown level")
+	}
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWritesTextFormat(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.Counter("requests_total", "Requests.", "route", "status")
+	depth := reg.Gauge("queue_depth", "Queue depth.")
+	latency := reg.Histogram("latency_seconds", "Latency.", []float64{0.5, 0.1}, "route")
+
+	requests.Inc("/b", "200")
+	requests.Add(2, "/a", "500")
+	requests.Inc("/a", "500")
+	depth.Set(7)
+	latency.Observe(0.05, `/q"x`)
+	latency.Observe(0.3, `/q"x`)
+	latency.Observe(3, `/q"x`)
+
+	var buf bytes.Buffer
+	if err := reg.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{route="/a",status="500"} 3
+requests_total{route="/b",status="200"} 1
+# HELP queue_depth Queue depth.
+# TYPE queue_depth gauge
+queue_depth 7
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/q\"x",le="0.1"} 1
+latency_seconds_bucket{route="/q\"x",le="0.5"} 2
+latency_seconds_bucket{route="/q\"x",le="+Inf"} 3
+latency_seconds_sum{route="/q\"x"} 3.35
+latency_seconds_count{route="/q\"x"} 3
+`
+	if buf.String() != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestGaugeResetAndScrapeHooks(t *testing.T) {
+	reg := NewRegistry()
+	load := reg.Gauge("load", "Load per user.", "user_id")
+	load.Set(1, "gone")
+
+	reg.OnScrape(func() {
+		load.Reset()
+		load.Set(2, "u1")
+	})
+
+	rec := httptest.NewRecorder()
+	reg.Handler(nil).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	if !strings.Contains(body, `load{user_id="u1"} 2`) || strings.Contains(body, "gone") {
+		t.Fatalf("body = %s", body)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+}
+
+// failingWriter is a response whose client went away.
+type failingWriter struct{ *httptest.ResponseRecorder }
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+func TestHandlerLogsWriteErrors(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("c", "C.").Inc()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	reg.Handler(logger).ServeHTTP(failingWriter{httptest.NewRecorder()}, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.Contains(logs.String(), `msg="writing metrics failed"`) ||
+		!strings.Contains(logs.String(), "connection reset") {
+		t.Fatalf("logs = %q", logs.String())
+	}
+}
+
+func TestLabelCountMismatchPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	NewRegistry().Counter("c", "C.", "a").Inc()
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type Absence struct {
+	AbsenceID    int64      `json:"absence_id"`
+	UserID       string     `json:"user_id"`
+	StartsAt     time.Time  `json:"starts_at"`
+	EndsAt       time.Time  `json:"ends_at"`
+	Reason       string     `json:"reason,omitempty"`
+	AutoReassign bool       `json:"auto_reassign"`
+	ReassignedAt *time.Time `json:"reassigned_at,omitempty"`
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+}
@@ -1,7 +1,8 @@
 package models
 
 type ErrorResponse struct {
-	Error ErrorDetail `json:"error"`
+	Error     ErrorDetail `json:"error"`
+	RequestID string      `json:"request_id,omitempty"`
 }
 
 type ErrorDetail struct {
@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+const (
+	EventPRCreated          = "PR_CREATED"
+	EventPRReady            = "PR_READY"
+	EventPRMerged           = "PR_MERGED"
+	EventPRClosed           = "PR_CLOSED"
+	EventPRReopened         = "PR_REOPENED"
+	EventReviewerAssigned   = "REVIEWER_ASSIGNED"
+	EventReviewerUnassigned = "REVIEWER_UNASSIGNED"
+	EventReviewSubmitted    = "REVIEW_SUBMITTED"
+	EventUserActivated      = "USER_ACTIVATED"
+	EventUserDeactivated    = "USER_DEACTIVATED"
+	EventUserUpdated        = "USER_UPDATED"
+	EventTeamCreated        = "TEAM_CREATED"
+	EventTeamUpdated        = "TEAM_UPDATED"
+	EventAbsenceCreated     = "ABSENCE_CREATED"
+	EventAbsenceCancelled   = "ABSENCE_CANCELLED"
+)
+
+// Reasons recorded on reviewer assignment events.
+const (
+	ReasonInitial      = "initial"
+	ReasonReassign     = "reassign"
+	ReasonDeactivation = "deactivation"
+	ReasonAbsence      = "absence"
+	ReasonReopen       = "reopen"
+)
+
+// Event is one entry of the append-only audit log.
+type Event struct {
+	EventID       int64             `json:"event_id"`
+	Type          string            `json:"type"`
+	Actor         string            `json:"actor,omitempty"`
+	PullRequestID string            `json:"pull_request_id,omitempty"`
+	UserID        string            `json:"user_id,omitempty"`
+	TeamName      string            `json:"team_name,omitempty"`
+	Reason        string            `json:"reason,omitempty"`
+	Details       map[string]string `json:"details,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+// Audit says who made a change and why; stores stamp it on the events they
+// write for that change.
+type Audit struct {
+	Actor  string
+	Reason string
+}
+
+// EventFilter selects audit events. Empty fields match everything; results
+// are ordered by EventID and start after AfterID.
+type EventFilter struct {
+	Actor         string
+	PullRequestID string
+	UserID        string
+	TeamName      string
+	Type          string
+	Since         *time.Time
+	Until         *time.Time
+	AfterID       int64
+	Limit         int
+}
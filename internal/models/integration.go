@@ -0,0 +1,42 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+)
+
+// ExternalAccount maps a login on a code hosting provider to a user.
+type ExternalAccount struct {
+	Provider string `json:"provider"`
+	Login    string `json:"login"`
+	UserID   string `json:"user_id"`
+}
+
+// InboundResult describes what an inbound provider webhook did. Rejected
+// events were stored for review instead of being applied.
+type InboundResult struct {
+	Action      string       `json:"action"`
+	Ignored     bool         `json:"ignored,omitempty"`
+	Rejected    bool         `json:"rejected,omitempty"`
+	RejectedID  int64        `json:"rejected_id,omitempty"`
+	PullRequest *PullRequest `json:"pull_request,omitempty"`
+}
+
+// RejectedEvent is an inbound provider webhook that could not be applied,
+// kept with its payload so it can be investigated and replayed.
+type RejectedEvent struct {
+	RejectedID    int64           `json:"rejected_id"`
+	Provider      string          `json:"provider"`
+	EventType     string          `json:"event_type"`
+	Action        string          `json:"action,omitempty"`
+	Login         string          `json:"login,omitempty"`
+	PullRequestID string          `json:"pull_request_id,omitempty"`
+	Reason        string          `json:"reason"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
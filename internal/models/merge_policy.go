@@ -0,0 +1,10 @@
+package models
+
+// MergePolicy is a team setting, so Version is the team's version.
+type MergePolicy struct {
+	TeamName                string `json:"team_name"`
+	MinApprovals            int    `json:"min_approvals"`
+	BlockOnChangesRequested bool   `json:"block_on_changes_requested"`
+	ForbidAuthorSelfMerge   bool   `json:"forbid_author_self_merge"`
+	Version                 int64  `json:"version"`
+}
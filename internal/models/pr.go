@@ -2,14 +2,39 @@ package models
 
 import "time"
 
+const (
+	StatusOpen   = "OPEN"
+	StatusMerged = "MERGED"
+	StatusClosed = "CLOSED"
+)
+
+const (
+	ReviewStatePending          = "PENDING"
+	ReviewStateApproved         = "APPROVED"
+	ReviewStateChangesRequested = "CHANGES_REQUESTED"
+	ReviewStateCommented        = "COMMENTED"
+)
+
 type PullRequest struct {
 	PullRequestID     string     `json:"pull_request_id"`
 	PullRequestName   string     `json:"pull_request_name"`
 	AuthorID          string     `json:"author_id"`
 	Status            string     `json:"status"`
+	IsDraft           bool       `json:"is_draft"`
+	ReviewersCount    int        `json:"reviewers_count"`
 	AssignedReviewers []string   `json:"assigned_reviewers"`
+	Reviews           []Review   `json:"reviews"`
 	CreatedAt         *time.Time `json:"createdAt,omitempty"`
 	MergedAt          *time.Time `json:"mergedAt,omitempty"`
+	ClosedAt          *time.Time `json:"closedAt,omitempty"`
+	Version           int64      `json:"version"`
+}
+
+// ReviewerPlan replaces reviewers of one OPEN PR, mapping each old reviewer
+// to the new one. Version is the PR version the plan was made against.
+type ReviewerPlan struct {
+	Version      int64
+	Replacements map[string]string
 }
 
 type PullRequestShort struct {
@@ -17,4 +42,12 @@ type PullRequestShort struct {
 	PullRequestName string `json:"pull_request_name"`
 	AuthorID        string `json:"author_id"`
 	Status          string `json:"status"`
+	IsDraft         bool   `json:"is_draft"`
+	ReviewState     string `json:"review_state,omitempty"`
+}
+
+type Review struct {
+	ReviewerID string     `json:"reviewer_id"`
+	State      string     `json:"state"`
+	ReviewedAt *time.Time `json:"reviewedAt,omitempty"`
 }
@@ -0,0 +1,29 @@
+package models
+
+// Roles a user holds within their team.
+const (
+	RoleLead   = "lead"
+	RoleMember = "member"
+)
+
+func ValidRole(role string) bool {
+	return role == RoleLead || role == RoleMember
+}
+
+// Caller is who performs an operation, for role checks and the audit log.
+// Admin callers may act on any team; other callers act as UserID, which may be
+// empty for tokens not bound to a user. Source then names the caller instead,
+// such as "token:3" or "github:octocat".
+type Caller struct {
+	UserID string
+	Admin  bool
+	Source string
+}
+
+// Actor is the name recorded as the actor of the caller's changes.
+func (c Caller) Actor() string {
+	if c.UserID != "" {
+		return c.UserID
+	}
+	return c.Source
+}
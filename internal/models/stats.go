@@ -14,8 +14,18 @@ type PRStats struct {
 }
 
 type StatsResponse struct {
-	UsersStats []UserStats `json:"users_stats"`
-	PRsStats   []PRStats   `json:"prs_stats"`
-	TotalUsers int         `json:"total_users"`
-	TotalPRs   int         `json:"total_prs"`
+	UsersStats    []UserStats `json:"users_stats"`
+	PRsStats      []PRStats   `json:"prs_stats"`
+	DraftPRsStats []PRStats   `json:"draft_prs_stats"`
+	TotalUsers    int         `json:"total_users"`
+	TotalPRs      int         `json:"total_prs"`
+	TotalDrafts   int         `json:"total_drafts"`
+}
+
+// Workload is the current load, as exported in metrics gauges. OpenReviews
+// counts review assignments on OPEN, non-draft PRs per reviewer.
+type Workload struct {
+	OpenPRs     int
+	ActiveUsers int
+	OpenReviews map[string]int
 }
@@ -1,12 +1,38 @@
 package models
 
+// Reviewer strategies a team or the server default can use.
+const (
+	StrategyRandom      = "random"
+	StrategyLeastLoaded = "least_loaded"
+)
+
+// Bounds on the number of reviewers assigned to a pull request.
+const (
+	DefaultReviewersPerPR = 2
+	MaxReviewersPerPR     = 5
+)
+
+func ValidStrategy(strategy string) bool {
+	switch strategy {
+	case StrategyRandom, StrategyLeastLoaded:
+		return true
+	}
+	return false
+}
+
 type Team struct {
-	TeamName string       `json:"team_name"`
-	Members  []TeamMember `json:"members"`
+	TeamName         string       `json:"team_name"`
+	Members          []TeamMember `json:"members"`
+	ReviewerStrategy string       `json:"reviewer_strategy,omitempty"`
+	DefaultReviewers int          `json:"default_reviewers,omitempty"`
+	CapacityFallback string       `json:"capacity_fallback,omitempty"`
+	Version          int64        `json:"version"`
 }
 
+// TeamMember.Role defaults to member when creating a team.
 type TeamMember struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
 	IsActive bool   `json:"is_active"`
+	Role     string `json:"role"`
 }
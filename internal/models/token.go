@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Scopes granted to API tokens. Each scope includes the ones below it: admin
+// can do everything, write can also read.
+const (
+	ScopeAdmin = "admin"
+	ScopeWrite = "write"
+	ScopeRead  = "read"
+)
+
+var scopeRank = map[string]int{ScopeRead: 1, ScopeWrite: 2, ScopeAdmin: 3}
+
+// ValidScope reports whether scope is one of the known scopes.
+func ValidScope(scope string) bool {
+	return scopeRank[scope] > 0
+}
+
+// APIToken is a bearer token. Only a hash of the secret is stored; the secret
+// itself is returned once, when the token is issued. A token bound to a user
+// acts with that user's team role.
+type APIToken struct {
+	TokenID   int64      `json:"token_id"`
+	Name      string     `json:"name"`
+	UserID    string     `json:"user_id,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the token grants scope.
+func (t *APIToken) HasScope(scope string) bool {
+	for _, granted := range t.Scopes {
+		if scopeRank[granted] >= scopeRank[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// IssuedToken is a newly issued token together with its secret.
+type IssuedToken struct {
+	APIToken
+	Token string `json:"token"`
+}
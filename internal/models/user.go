@@ -5,4 +5,8 @@ type User struct {
 	Username string `json:"username"`
 	TeamName string `json:"team_name"`
 	IsActive bool   `json:"is_active"`
+	Role     string `json:"role"`
+
+	MaxOpenReviews int   `json:"max_open_reviews,omitempty"`
+	Version        int64 `json:"version"`
 }
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+const (
+	DeliveryPending   = "PENDING"
+	DeliveryDelivered = "DELIVERED"
+	DeliveryDead      = "DEAD"
+)
+
+// Webhook is a subscriber that receives events of the listed types. The
+// secret signs payloads and is never returned by the API.
+type Webhook struct {
+	WebhookID  int64     `json:"webhook_id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"`
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookDelivery tracks sending one event to one webhook.
+type WebhookDelivery struct {
+	DeliveryID     int64      `json:"delivery_id"`
+	WebhookID      int64      `json:"webhook_id"`
+	EventID        int64      `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// WebhookDispatch is a claimed delivery with everything needed to send it.
+type WebhookDispatch struct {
+	Delivery WebhookDelivery
+	URL      string
+	Secret   string
+	Event    Event
+}
+
+// WebhookAttempt is the outcome of one delivery attempt. NextAttemptAt is set
+// only when Status is DeliveryPending.
+type WebhookAttempt struct {
+	Status        string
+	StatusCode    int
+	Error         string
+	NextAttemptAt time.Time
+}
+
+type WebhookDeliveryFilter struct {
+	WebhookID int64
+	Status    string
+	Limit     int
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
+	"time"
+)
+
+var (
+	ErrAbsenceNotFound = errors.New("absence not found")
+	ErrInvalidAbsence  = errors.New("invalid absence window")
+)
+
+// CreateAbsence registers an absence window. While it is in effect the user is
+// skipped by reviewer selection; with AutoReassign set their OPEN reviews are
+// handed over as soon as the window begins. Only the user, their team's lead
+// or an admin may register it. Once stored the absence is returned even if
+// the immediate reassignment fails; the absence worker retries it then.
+func (s *Service) CreateAbsence(
+	ctx context.Context, caller models.Caller, absence *models.Absence,
+) (*models.Absence, error) {
+	ctx, span := tracing.Start(ctx, "service.CreateAbsence")
+	defer span.End()
+
+	if absence.StartsAt.IsZero() || !absence.EndsAt.After(absence.StartsAt) || !absence.EndsAt.After(time.Now()) {
+		return nil, ErrInvalidAbsence
+	}
+
+	user, err := s.db.GetUser(ctx, absence.UserID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	if err := s.authorizeUserChange(ctx, caller, user); err != nil {
+		return nil, err
+	}
+
+	audit := models.Audit{Actor: caller.Actor(), Reason: models.ReasonAbsence}
+	if err := s.db.CreateAbsence(ctx, absence, audit); err != nil {
+		return nil, err
+	}
+
+	if absence.AutoReassign && !absence.StartsAt.After(time.Now()) {
+		if err := s.reassignAbsentReviews(ctx, absence, audit); err != nil {
+			s.logger.WarnContext(ctx, "absence reassignment failed, leaving it to the worker",
+				"absence_id", absence.AbsenceID, "user_id", absence.UserID, "error", err)
+		}
+	}
+
+	return s.db.GetAbsence(ctx, absence.AbsenceID)
+}
+
+func (s *Service) GetUserAbsences(ctx context.Context, userID string) ([]models.Absence, error) {
+	ctx, span := tracing.Start(ctx, "service.GetUserAbsences")
+	defer span.End()
+
+	if _, err := s.db.GetUser(ctx, userID); err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+
+	return s.db.GetUserAbsences(ctx, userID)
+}
+
+// CancelAbsence ends an absence; the same callers as for CreateAbsence may
+// do it.
+func (s *Service) CancelAbsence(ctx context.Context, caller models.Caller, absenceID int64) (*models.Absence, error) {
+	ctx, span := tracing.Start(ctx, "service.CancelAbsence")
+	defer span.End()
+
+	absence, err := s.db.GetAbsence(ctx, absenceID)
+	if err != nil {
+		return nil, notFound(err, ErrAbsenceNotFound)
+	}
+	user, err := s.db.GetUser(ctx, absence.UserID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	if err := s.authorizeUserChange(ctx, caller, user); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.CancelAbsence(ctx, absenceID, models.Audit{Actor: caller.Actor()}); err != nil {
+		return nil, err
+	}
+
+	return s.db.GetAbsence(ctx, absenceID)
+}
+
+// ProcessStartedAbsences reassigns open reviews of users whose auto-reassign
+// absence has begun. It is safe to call repeatedly. An absence that cannot be
+// handled does not hold up the others; the failures are returned together.
+func (s *Service) ProcessStartedAbsences(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "service.ProcessStartedAbsences")
+	defer span.End()
+
+	absences, err := s.db.GetStartedAbsencesToReassign(ctx)
+	if err != nil {
+		return err
+	}
+
+	audit := models.Audit{Actor: SystemActor, Reason: models.ReasonAbsence}
+	var errs []error
+	for i := range absences {
+		absence := &absences[i]
+		if err := s.reassignAbsentReviews(ctx, absence, audit); err != nil {
+			s.logger.ErrorContext(ctx, "absence reassignment failed",
+				"absence_id", absence.AbsenceID, "user_id", absence.UserID, "error", err)
+			errs = append(errs, fmt.Errorf("absence %d: %w", absence.AbsenceID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RunAbsenceWorker calls ProcessStartedAbsences every interval until stop is closed.
+func (s *Service) RunAbsenceWorker(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.runTraced("worker.absences", s.ProcessStartedAbsences); err != nil {
+				s.logger.Error("absence reassignment failed", "error", err)
+			}
+		}
+	}
+}
+
+// reassignAbsentReviews hands over the absent user's open reviews on behalf
+// of audit.Actor: whoever registered an absence that has already begun, or
+// the worker once a later one begins.
+func (s *Service) reassignAbsentReviews(ctx context.Context, absence *models.Absence, audit models.Audit) error {
+	user, err := s.db.GetUser(ctx, absence.UserID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.reassignUnavailable(ctx, []string{absence.UserID}, user.TeamName, audit); err != nil {
+		return err
+	}
+
+	return s.db.MarkAbsenceReassigned(ctx, absence.AbsenceID)
+}
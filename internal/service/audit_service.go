@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
+)
+
+const (
+	// SystemActor is recorded as the actor of changes made by background workers.
+	SystemActor = "system"
+
+	DefaultEventsLimit = 100
+	MaxEventsLimit     = 1000
+)
+
+var ErrInvalidEventFilter = errors.New("invalid event filter")
+
+// GetPullRequestHistory returns every recorded event of a PR, oldest first.
+func (s *Service) GetPullRequestHistory(ctx context.Context, prID string) ([]models.Event, error) {
+	ctx, span := tracing.Start(ctx, "service.GetPullRequestHistory")
+	defer span.End()
+
+	exists, err := s.db.PRExists(ctx, prID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrPRNotFound
+	}
+
+	return s.db.ListEvents(ctx, models.EventFilter{PullRequestID: prID})
+}
+
+// ListEvents queries the audit log. Results are ordered by event id; callers
+// page through them by passing the last seen id as AfterID.
+func (s *Service) ListEvents(ctx context.Context, filter models.EventFilter) ([]models.Event, error) {
+	ctx, span := tracing.Start(ctx, "service.ListEvents")
+	defer span.End()
+
+	if filter.Limit < 0 || filter.Limit > MaxEventsLimit || filter.AfterID < 0 {
+		return nil, ErrInvalidEventFilter
+	}
+	if filter.Since != nil && filter.Until != nil && !filter.Since.Before(*filter.Until) {
+		return nil, ErrInvalidEventFilter
+	}
+	if filter.Limit == 0 {
+		filter.Limit = DefaultEventsLimit
+	}
+
+	return s.db.ListEvents(ctx, filter)
+}
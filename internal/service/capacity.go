@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
+)
+
+const (
+	CapacityFallbackLeastLoaded = "least_loaded"
+	CapacityFallbackError       = "error"
+)
+
+var (
+	ErrAllAtCapacity           = errors.New("all candidates are at review capacity")
+	ErrInvalidCapacityFallback = errors.New("unknown capacity fallback")
+	ErrInvalidMaxOpenReviews   = errors.New("invalid max open reviews")
+)
+
+func ValidCapacityFallback(fallback string) bool {
+	return fallback == CapacityFallbackLeastLoaded || fallback == CapacityFallbackError
+}
+
+// chooseReviewers drops candidates that reached their max_open_reviews and
+// hands the rest to the team's selector. When every candidate is at capacity
+// the team's fallback decides between the least-loaded ones and ErrAllAtCapacity.
+func (s *Service) chooseReviewers(
+	ctx context.Context, teamName string, candidates []string, n int, loader ReviewLoader,
+) ([]string, error) {
+	if len(candidates) == 0 || n <= 0 {
+		return []string{}, nil
+	}
+
+	limits, err := s.db.GetMaxOpenReviews(ctx, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	loads, err := loader.GetOpenReviewCounts(ctx, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	var available []string
+	for _, candidate := range candidates {
+		limit, limited := limits[candidate]
+		if !limited || loads[candidate] < limit {
+			available = append(available, candidate)
+		}
+	}
+
+	if len(available) > 0 {
+		selector, err := s.selectorForTeam(ctx, teamName, loader)
+		if err != nil {
+			return nil, err
+		}
+		return selector.Select(ctx, available, n)
+	}
+
+	fallback, err := s.db.GetTeamCapacityFallback(ctx, teamName)
+	if err != nil {
+		return nil, err
+	}
+	if fallback == CapacityFallbackError {
+		return nil, ErrAllAtCapacity
+	}
+
+	return NewLeastLoadedSelector(loader).Select(ctx, candidates, n)
+}
+
+// SetUserMaxOpenReviews sets the user's open review limit. The user, their
+// team's lead or an admin may change it.
+func (s *Service) SetUserMaxOpenReviews(
+	ctx context.Context, caller models.Caller, userID string, maxOpenReviews int, version int64,
+) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "service.SetUserMaxOpenReviews")
+	defer span.End()
+
+	if maxOpenReviews < 0 {
+		return nil, ErrInvalidMaxOpenReviews
+	}
+
+	user, err := s.db.GetUser(ctx, userID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	if err := s.authorizeUserChange(ctx, caller, user); err != nil {
+		return nil, err
+	}
+
+	audit := models.Audit{Actor: caller.Actor()}
+	if err := s.db.SetUserMaxOpenReviews(ctx, userID, maxOpenReviews, version, audit); err != nil {
+		return nil, versionError(err, version)
+	}
+
+	return s.db.GetUser(ctx, userID)
+}
+
+func (s *Service) SetTeamCapacityFallback(
+	ctx context.Context, caller models.Caller, teamName, fallback string, version int64,
+) (*models.Team, error) {
+	ctx, span := tracing.Start(ctx, "service.SetTeamCapacityFallback")
+	defer span.End()
+
+	if fallback != "" && !ValidCapacityFallback(fallback) {
+		return nil, ErrInvalidCapacityFallback
+	}
+
+	exists, err := s.db.TeamExists(ctx, teamName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrTeamNotFound
+	}
+
+	audit := models.Audit{Actor: caller.Actor()}
+	if err := s.db.SetTeamCapacityFallback(ctx, teamName, fallback, version, audit); err != nil {
+		return nil, versionError(err, version)
+	}
+
+	return s.GetTeam(ctx, teamName)
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
+)
+
+type githubUser struct {
+	Login string `json:"login"`
+}
+
+// githubPullRequestEvent is the part of a GitHub "pull_request" webhook
+// payload the service uses.
+type githubPullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Title    string      `json:"title"`
+		Draft    bool        `json:"draft"`
+		Merged   bool        `json:"merged"`
+		User     githubUser  `json:"user"`
+		MergedBy *githubUser `json:"merged_by"`
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender githubUser `json:"sender"`
+}
+
+// HandleGitHubWebhook applies a GitHub webhook delivery. eventType is the
+// X-GitHub-Event header and signature the X-Hub-Signature-256 header. PRs are
+// identified as "<owner>/<repo>#<number>"; events other than the supported
+// pull_request actions are acknowledged and ignored. A PR opened by an
+// unmapped author is stored as a rejected event; merges are recorded without
+// checking the merge policy.
+func (s *Service) HandleGitHubWebhook(
+	ctx context.Context, eventType, signature string, body []byte,
+) (*models.InboundResult, error) {
+	ctx, span := tracing.Start(ctx, "service.HandleGitHubWebhook")
+	defer span.End()
+
+	if s.githubWebhookSecret == "" {
+		return nil, ErrIntegrationDisabled
+	}
+	if err := verifySignature(s.githubWebhookSecret, body, signature); err != nil {
+		return nil, err
+	}
+
+	if eventType != "pull_request" {
+		return &models.InboundResult{Action: eventType, Ignored: true}, nil
+	}
+
+	var event githubPullRequestEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, ErrInvalidPayload
+	}
+	if event.Repository.FullName == "" || event.Number <= 0 {
+		return nil, ErrInvalidPayload
+	}
+	prID := fmt.Sprintf("%s#%d", event.Repository.FullName, event.Number)
+
+	var pr *models.PullRequest
+	var caller models.Caller
+	var err error
+	switch event.Action {
+	case "opened":
+		return s.openExternalPullRequest(ctx, models.RejectedEvent{
+			Provider:      models.ProviderGitHub,
+			EventType:     eventType,
+			Action:        event.Action,
+			Login:         event.PullRequest.User.Login,
+			PullRequestID: prID,
+		}, event.PullRequest.Title, event.PullRequest.Draft, body)
+	case "closed":
+		if event.PullRequest.Merged {
+			pr, err = s.mergeGitHubPullRequest(ctx, prID, &event)
+		} else if caller, err = s.externalCaller(ctx, models.ProviderGitHub, event.Sender.Login); err == nil {
+			pr, err = s.ClosePullRequest(ctx, caller, prID, 0)
+		}
+	case "reopened":
+		if caller, err = s.externalCaller(ctx, models.ProviderGitHub, event.Sender.Login); err == nil {
+			pr, err = s.ReopenPullRequest(ctx, caller, prID, 0)
+		}
+	case "ready_for_review":
+		if caller, err = s.externalCaller(ctx, models.ProviderGitHub, event.Sender.Login); err == nil {
+			pr, _, err = s.MarkReady(ctx, caller, prID, 0)
+		}
+	default:
+		return &models.InboundResult{Action: event.Action, Ignored: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.InboundResult{Action: event.Action, PullRequest: pr}, nil
+}
+
+func (s *Service) mergeGitHubPullRequest(
+	ctx context.Context, prID string, event *githubPullRequestEvent,
+) (*models.PullRequest, error) {
+	var login string
+	if event.PullRequest.MergedBy != nil {
+		login = event.PullRequest.MergedBy.Login
+	}
+	caller, err := s.externalCaller(ctx, models.ProviderGitHub, login)
+	if err != nil {
+		return nil, err
+	}
+	return s.recordExternalMerge(ctx, caller, prID)
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
+	"strings"
+)
+
+// gitlabMergeRequestHook is the X-Gitlab-Event value for merge request events.
+const gitlabMergeRequestHook = "Merge Request Hook"
+
+// gitlabDraftPrefixes are the title prefixes GitLab treats as marking a draft,
+// compared in lower case.
+var gitlabDraftPrefixes = []string{"draft:", "[draft]", "(draft)", "wip:", "[wip]"}
+
+// gitlabMergeRequestEvent is the part of a GitLab "Merge Request Hook" payload
+// the service uses. User is whoever triggered the event, not necessarily the
+// merge request's author.
+type gitlabMergeRequestEvent struct {
+	ObjectKind string `json:"object_kind"`
+	User       struct {
+		ID       int64  `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID            int    `json:"iid"`
+		AuthorID       int64  `json:"author_id"`
+		Title          string `json:"title"`
+		Action         string `json:"action"`
+		Draft          bool   `json:"draft"`
+		WorkInProgress bool   `json:"work_in_progress"`
+	} `json:"object_attributes"`
+}
+
+// authorLogin is the login the author is mapped by. The payload only names
+// the author by numeric id, so the login is known only when the author
+// triggered the event and is "" otherwise.
+func (e *gitlabMergeRequestEvent) authorLogin() string {
+	if e.ObjectAttributes.AuthorID == 0 || e.ObjectAttributes.AuthorID == e.User.ID {
+		return e.User.Username
+	}
+	return ""
+}
+
+func (e *gitlabMergeRequestEvent) isDraft() bool {
+	if e.ObjectAttributes.Draft || e.ObjectAttributes.WorkInProgress {
+		return true
+	}
+	title := strings.ToLower(strings.TrimSpace(e.ObjectAttributes.Title))
+	for _, prefix := range gitlabDraftPrefixes {
+		if strings.HasPrefix(title, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleGitLabWebhook applies a GitLab webhook delivery. eventType is the
+// X-Gitlab-Event header and token the X-Gitlab-Token header. PRs are
+// identified as "<namespace>/<project>!<iid>"; events other than the supported
+// merge request actions are acknowledged and ignored. Merges are recorded
+// without checking the merge policy or the local draft flag.
+func (s *Service) HandleGitLabWebhook(
+	ctx context.Context, eventType, token string, body []byte,
+) (*models.InboundResult, error) {
+	ctx, span := tracing.Start(ctx, "service.HandleGitLabWebhook")
+	defer span.End()
+
+	if s.gitlabWebhookToken == "" {
+		return nil, ErrIntegrationDisabled
+	}
+	if subtle.ConstantTimeCompare([]byte(s.gitlabWebhookToken), []byte(token)) != 1 {
+		return nil, ErrInvalidSignature
+	}
+
+	if eventType != gitlabMergeRequestHook {
+		return &models.InboundResult{Action: eventType, Ignored: true}, nil
+	}
+
+	var event gitlabMergeRequestEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, ErrInvalidPayload
+	}
+	if event.ObjectKind != "merge_request" || event.Project.PathWithNamespace == "" || event.ObjectAttributes.IID <= 0 {
+		return nil, ErrInvalidPayload
+	}
+	prID := fmt.Sprintf("%s!%d", event.Project.PathWithNamespace, event.ObjectAttributes.IID)
+	action := event.ObjectAttributes.Action
+
+	var pr *models.PullRequest
+	var caller models.Caller
+	var err error
+	switch action {
+	case "open":
+		return s.openExternalPullRequest(ctx, models.RejectedEvent{
+			Provider:      models.ProviderGitLab,
+			EventType:     eventType,
+			Action:        action,
+			Login:         event.authorLogin(),
+			PullRequestID: prID,
+		}, event.ObjectAttributes.Title, event.isDraft(), body)
+	case "update":
+		return s.updateGitLabMergeRequest(ctx, prID, &event)
+	case "merge":
+		if caller, err = s.externalCaller(ctx, models.ProviderGitLab, event.User.Username); err == nil {
+			pr, err = s.recordExternalMerge(ctx, caller, prID)
+		}
+	case "close":
+		if caller, err = s.externalCaller(ctx, models.ProviderGitLab, event.User.Username); err == nil {
+			pr, err = s.ClosePullRequest(ctx, caller, prID, 0)
+		}
+	case "reopen":
+		if caller, err = s.externalCaller(ctx, models.ProviderGitLab, event.User.Username); err == nil {
+			pr, err = s.ReopenPullRequest(ctx, caller, prID, 0)
+		}
+	default:
+		return &models.InboundResult{Action: action, Ignored: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.InboundResult{Action: action, PullRequest: pr}, nil
+}
+
+// updateGitLabMergeRequest marks a draft PR ready once the merge request stops
+// being a draft. Other updates, including turning a PR back into a draft, are
+// ignored.
+func (s *Service) updateGitLabMergeRequest(
+	ctx context.Context, prID string, event *gitlabMergeRequestEvent,
+) (*models.InboundResult, error) {
+	action := event.ObjectAttributes.Action
+	pr, err := s.db.GetPullRequest(ctx, prID)
+	if err == sql.ErrNoRows {
+		return &models.InboundResult{Action: action, Ignored: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !pr.IsDraft || pr.Status != models.StatusOpen || event.isDraft() {
+		return &models.InboundResult{Action: action, Ignored: true}, nil
+	}
+
+	caller, err := s.externalCaller(ctx, models.ProviderGitLab, event.User.Username)
+	if err != nil {
+		return nil, err
+	}
+	pr, _, err = s.MarkReady(ctx, caller, prID, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &models.InboundResult{Action: action, PullRequest: pr}, nil
+}
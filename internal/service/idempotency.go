@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
+	"time"
+)
+
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+var (
+	ErrIdempotencyKeyReused  = errors.New("idempotency key reused with a different request")
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is still in progress")
+)
+
+// BeginIdempotentRequest claims key for a request identified by requestHash.
+// It returns nil when the caller should execute the request and then call
+// FinishIdempotentRequest, or the stored record when the response should be
+// replayed.
+func (s *Service) BeginIdempotentRequest(
+	ctx context.Context, key, requestHash string,
+) (*models.IdempotencyRecord, error) {
+	ctx, span := tracing.Start(ctx, "service.BeginIdempotentRequest")
+	defer span.End()
+
+	// A second attempt covers a record that expired or was released between
+	// the reservation and the lookup.
+	for attempt := 0; attempt < 2; attempt++ {
+		reserved, err := s.db.ReserveIdempotencyKey(ctx, &models.IdempotencyRecord{
+			Key:         key,
+			RequestHash: requestHash,
+			ExpiresAt:   time.Now().Add(s.idempotencyTTL),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if reserved {
+			return nil, nil
+		}
+
+		record, err := s.db.GetIdempotencyKey(ctx, key)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if record.RequestHash != requestHash {
+			return nil, ErrIdempotencyKeyReused
+		}
+		if record.StatusCode == 0 {
+			return nil, ErrIdempotencyInProgress
+		}
+		return record, nil
+	}
+
+	return nil, ErrIdempotencyInProgress
+}
+
+// FinishIdempotentRequest stores the response and its ETag for replay. Server
+// errors are not stored, so the client can retry them with the same key.
+func (s *Service) FinishIdempotentRequest(
+	ctx context.Context, key string, statusCode int, etag string, body []byte,
+) error {
+	ctx, span := tracing.Start(ctx, "service.FinishIdempotentRequest")
+	defer span.End()
+
+	if statusCode >= http.StatusInternalServerError {
+		return s.db.DeleteIdempotencyKey(ctx, key)
+	}
+	return s.db.CompleteIdempotencyKey(ctx, key, statusCode, etag, body)
+}
+
+// ReleaseIdempotentRequest frees key without storing the response, for a
+// request that failed in a way worth retrying with the same key.
+func (s *Service) ReleaseIdempotentRequest(ctx context.Context, key string) error {
+	ctx, span := tracing.Start(ctx, "service.ReleaseIdempotentRequest")
+	defer span.End()
+
+	return s.db.DeleteIdempotencyKey(ctx, key)
+}
+
+// IsRetryable reports whether err is a transient failure the client is told
+// to retry: a lost race with a concurrent update or a timeout.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrConcurrentUpdate) || IsTimeout(err)
+}
+
+// RunIdempotencyCleanup drops expired idempotency keys every interval until
+// stop is closed.
+func (s *Service) RunIdempotencyCleanup(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := s.runTraced("worker.idempotencyCleanup", func(ctx context.Context) error {
+				_, err := s.db.DeleteExpiredIdempotencyKeys(ctx)
+				return err
+			})
+			if err != nil {
+				s.logger.Error("idempotency key cleanup failed", "error", err)
+			}
+		}
+	}
+}
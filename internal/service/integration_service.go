@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"pr-review-service/internal/database"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
+)
+
+var (
+	ErrIntegrationDisabled = errors.New("integration is not configured")
+	ErrInvalidSignature    = errors.New("invalid webhook signature")
+	ErrInvalidPayload      = errors.New("invalid webhook payload")
+	ErrUnknownAccount      = errors.New("external account is not mapped to a user")
+	ErrUnknownAuthor       = errors.New("event does not name the author's login")
+	ErrInvalidAccount      = errors.New("invalid external account")
+)
+
+// SetExternalAccount maps a provider login to a user, replacing any previous
+// mapping of that login.
+func (s *Service) SetExternalAccount(
+	ctx context.Context, account *models.ExternalAccount,
+) (*models.ExternalAccount, error) {
+	ctx, span := tracing.Start(ctx, "service.SetExternalAccount")
+	defer span.End()
+
+	if !validProvider(account.Provider) || account.Login == "" {
+		return nil, ErrInvalidAccount
+	}
+
+	if err := s.db.SetExternalAccount(ctx, account); err != nil {
+		if errors.Is(err, database.ErrForeignKeyViolation) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *Service) ListExternalAccounts(ctx context.Context, provider string) ([]models.ExternalAccount, error) {
+	ctx, span := tracing.Start(ctx, "service.ListExternalAccounts")
+	defer span.End()
+
+	if provider != "" && !validProvider(provider) {
+		return nil, ErrInvalidAccount
+	}
+	return s.db.ListExternalAccounts(ctx, provider)
+}
+
+func validProvider(provider string) bool {
+	return provider == models.ProviderGitHub || provider == models.ProviderGitLab
+}
+
+// ListRejectedEvents returns inbound events that could not be applied, newest
+// first.
+func (s *Service) ListRejectedEvents(ctx context.Context, provider string, limit int) ([]models.RejectedEvent, error) {
+	ctx, span := tracing.Start(ctx, "service.ListRejectedEvents")
+	defer span.End()
+
+	if provider != "" && !validProvider(provider) {
+		return nil, ErrInvalidAccount
+	}
+	if limit < 0 || limit > MaxEventsLimit {
+		return nil, ErrInvalidEventFilter
+	}
+	if limit == 0 {
+		limit = DefaultEventsLimit
+	}
+	return s.db.ListRejectedEvents(ctx, provider, limit)
+}
+
+// openExternalPullRequest creates a PR for a provider event. An author without
+// an account mapping does not fail the delivery; the event is stored as
+// rejected so it can be replayed once the mapping exists, and so is an event
+// without the author's login.
+func (s *Service) openExternalPullRequest(
+	ctx context.Context, rejected models.RejectedEvent, title string, isDraft bool, body []byte,
+) (*models.InboundResult, error) {
+	authorID, err := "", ErrUnknownAuthor
+	if rejected.Login != "" {
+		authorID, err = s.resolveAccount(ctx, rejected.Provider, rejected.Login)
+	}
+	if err == ErrUnknownAccount || err == ErrUnknownAuthor {
+		rejected.Reason = err.Error()
+		rejected.Payload = json.RawMessage(body)
+		if err := s.db.CreateRejectedEvent(ctx, &rejected); err != nil {
+			return nil, err
+		}
+		return &models.InboundResult{Action: rejected.Action, Rejected: true, RejectedID: rejected.RejectedID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, err = s.CreatePullRequest(ctx, rejected.PullRequestID, title, authorID, isDraft, 0)
+	if err := ignoreRedelivery(err); err != nil {
+		return nil, err
+	}
+
+	pr, err := s.db.GetPullRequest(ctx, rejected.PullRequestID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.InboundResult{Action: rejected.Action, PullRequest: pr}, nil
+}
+
+// resolveAccount returns the user mapped to login, or ErrUnknownAccount.
+func (s *Service) resolveAccount(ctx context.Context, provider, login string) (string, error) {
+	userID, err := s.db.GetExternalAccountUser(ctx, provider, login)
+	if err == sql.ErrNoRows {
+		return "", ErrUnknownAccount
+	}
+	return userID, err
+}
+
+// optionalAccount resolves login when it is mapped and returns "" otherwise.
+func (s *Service) optionalAccount(ctx context.Context, provider, login string) (string, error) {
+	if login == "" {
+		return "", nil
+	}
+	userID, err := s.resolveAccount(ctx, provider, login)
+	if err == ErrUnknownAccount {
+		return "", nil
+	}
+	return userID, err
+}
+
+// externalCaller is the caller for a change triggered by login on provider: the
+// mapped user, or the provider login itself when it is not mapped.
+func (s *Service) externalCaller(ctx context.Context, provider, login string) (models.Caller, error) {
+	userID, err := s.optionalAccount(ctx, provider, login)
+	if err != nil || userID != "" {
+		return models.Caller{UserID: userID}, err
+	}
+	if login == "" {
+		return models.Caller{Source: provider}, nil
+	}
+	return models.Caller{Source: provider + ":" + login}, nil
+}
+
+// recordExternalMerge marks prID merged because its provider merged it. The
+// merge already happened upstream, so unlike MergePullRequest it applies no
+// merge policy and accepts drafts and closed PRs: refusing would only leave
+// the local state behind the provider's.
+func (s *Service) recordExternalMerge(
+	ctx context.Context, caller models.Caller, prID string,
+) (*models.PullRequest, error) {
+	pr, err := s.db.GetPullRequest(ctx, prID)
+	if err != nil {
+		return nil, notFound(err, ErrPRNotFound)
+	}
+	if pr.Status == models.StatusMerged {
+		return pr, nil
+	}
+
+	if err := s.db.MergePullRequest(ctx, prID, pr.Version, models.Audit{Actor: caller.Actor()}); err != nil {
+		return nil, versionError(err, 0)
+	}
+	return s.db.GetPullRequest(ctx, prID)
+}
+
+// verifySignature checks a "sha256=<hex>" HMAC of body, as produced by
+// SignPayload, in constant time.
+func verifySignature(secret string, body []byte, signature string) error {
+	if !hmac.Equal([]byte(SignPayload(secret, body)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ignoreRedelivery treats the outcome of replaying an already applied
+// provider event as success.
+func ignoreRedelivery(err error) error {
+	if err == ErrPRExists {
+		return nil
+	}
+	return err
+}
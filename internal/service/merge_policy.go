@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
+	"strings"
+)
+
+const (
+	RuleMinApprovals     = "min_approvals"
+	RuleChangesRequested = "no_changes_requested"
+	RuleAuthorSelfMerge  = "author_self_merge"
+)
+
+var ErrInvalidMergePolicy = errors.New("invalid merge policy")
+
+// MergeBlockedError lists the merge policy rules an OPEN PR currently fails.
+type MergeBlockedError struct {
+	Violations []string
+}
+
+func (e *MergeBlockedError) Error() string {
+	return "merge blocked by policy: " + strings.Join(e.Violations, ", ")
+}
+
+func (s *Service) GetMergePolicy(ctx context.Context, teamName string) (*models.MergePolicy, error) {
+	ctx, span := tracing.Start(ctx, "service.GetMergePolicy")
+	defer span.End()
+
+	exists, err := s.db.TeamExists(ctx, teamName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrTeamNotFound
+	}
+
+	return s.db.GetMergePolicy(ctx, teamName)
+}
+
+func (s *Service) SetMergePolicy(
+	ctx context.Context, caller models.Caller, policy *models.MergePolicy, version int64,
+) (*models.MergePolicy, error) {
+	ctx, span := tracing.Start(ctx, "service.SetMergePolicy")
+	defer span.End()
+
+	if policy.MinApprovals < 0 {
+		return nil, ErrInvalidMergePolicy
+	}
+
+	exists, err := s.db.TeamExists(ctx, policy.TeamName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrTeamNotFound
+	}
+
+	audit := models.Audit{Actor: caller.Actor()}
+	if err := s.db.SetMergePolicy(ctx, policy, version, audit); err != nil {
+		return nil, versionError(err, version)
+	}
+
+	return s.db.GetMergePolicy(ctx, policy.TeamName)
+}
+
+func checkMergePolicy(policy *models.MergePolicy, pr *models.PullRequest, mergedBy string) error {
+	approvals := 0
+	changesRequested := false
+	for _, review := range pr.Reviews {
+		switch review.State {
+		case models.ReviewStateApproved:
+			approvals++
+		case models.ReviewStateChangesRequested:
+			changesRequested = true
+		}
+	}
+
+	var violations []string
+	if approvals < policy.MinApprovals {
+		violations = append(violations, fmt.Sprintf("%s (%d/%d)", RuleMinApprovals, approvals, policy.MinApprovals))
+	}
+	if policy.BlockOnChangesRequested && changesRequested {
+		violations = append(violations, RuleChangesRequested)
+	}
+	// Without approvals a merge by an unknown user may be the author's own, so
+	// the rule needs to know who merges.
+	if policy.ForbidAuthorSelfMerge && approvals == 0 {
+		switch mergedBy {
+		case pr.AuthorID:
+			violations = append(violations, RuleAuthorSelfMerge)
+		case "":
+			violations = append(violations, RuleAuthorSelfMerge+" (merged_by unknown)")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &MergeBlockedError{Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"pr-review-service/internal/metrics"
+	"pr-review-service/internal/models"
+)
+
+type serviceMetrics struct {
+	reassignments *metrics.CounterVec
+	noCandidate   *metrics.CounterVec
+	openPRs       *metrics.GaugeVec
+	activeUsers   *metrics.GaugeVec
+	openReviews   *metrics.GaugeVec
+}
+
+// registerMetrics adds the service counters to reg and refreshes the workload
+// gauges from the store on every scrape.
+func (s *Service) registerMetrics(reg *metrics.Registry) {
+	s.metrics = serviceMetrics{
+		reassignments: reg.Counter("pr_review_reassignments_total",
+			"Reviewer replacements by reason (reassign, deactivation, absence).", "reason"),
+		noCandidate: reg.Counter("pr_review_no_candidate_total",
+			"Reassignments that failed with NO_CANDIDATE."),
+		openPRs:     reg.Gauge("pr_review_open_prs", "Pull requests in status OPEN, drafts included."),
+		activeUsers: reg.Gauge("pr_review_active_users", "Users with is_active set."),
+		openReviews: reg.Gauge("pr_review_open_reviews",
+			"Review assignments on open, non-draft pull requests per reviewer.", "user_id"),
+	}
+	reg.OnScrape(s.refreshWorkloadMetrics)
+}
+
+func (s *Service) refreshWorkloadMetrics() {
+	workload, err := s.db.GetWorkload(context.Background())
+	if err != nil {
+		s.logger.Error("reading workload for metrics failed", "error", err)
+		return
+	}
+
+	s.metrics.openPRs.Set(float64(workload.OpenPRs))
+	s.metrics.activeUsers.Set(float64(workload.ActiveUsers))
+	s.metrics.openReviews.Reset()
+	for userID, count := range workload.OpenReviews {
+		s.metrics.openReviews.Set(float64(count), userID)
+	}
+}
+
+// countReassignments records every reviewer replaced by the applied plans.
+func (s *Service) countReassignments(reason string, plans map[string]models.ReviewerPlan, applied []string) {
+	for _, prID := range applied {
+		s.metrics.reassignments.Add(float64(len(plans[prID].Replacements)), reason)
+	}
+}
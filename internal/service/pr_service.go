@@ -1,70 +1,232 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"pr-review-service/internal/database"
 	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
 )
 
 var (
 	ErrPRExists    = errors.New("PR already exists")
 	ErrPRNotFound  = errors.New("PR not found")
 	ErrPRMerged    = errors.New("PR is merged")
+	ErrPRClosed    = errors.New("PR is closed")
+	ErrPRDraft     = errors.New("PR is a draft")
 	ErrNotAssigned = errors.New("reviewer is not assigned")
 	ErrNoCandidate = errors.New("no active replacement candidate")
+
+	ErrInvalidReviewState    = errors.New("invalid review state")
+	ErrInvalidReviewersCount = errors.New("invalid reviewers count")
 )
 
-func (s *Service) CreatePullRequest(prID, prName, authorID string) (*models.PullRequest, error) {
-	exists, err := s.db.PRExists(prID)
+// CreatePullRequest creates an OPEN PR. Drafts get no reviewers until they are
+// marked ready. reviewersCount overrides the team default when positive; the
+// returned warning is set when fewer candidates than requested were available.
+func (s *Service) CreatePullRequest(
+	ctx context.Context, prID, prName, authorID string, isDraft bool, reviewersCount int,
+) (*models.PullRequest, string, error) {
+	ctx, span := tracing.Start(ctx, "service.CreatePullRequest")
+	defer span.End()
+
+	if reviewersCount < 0 || reviewersCount > models.MaxReviewersPerPR {
+		return nil, "", ErrInvalidReviewersCount
+	}
+
+	exists, err := s.db.PRExists(ctx, prID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	if exists {
-		return nil, ErrPRExists
+		return nil, "", ErrPRExists
 	}
 
-	author, err := s.db.GetUser(authorID)
+	author, err := s.db.GetUser(ctx, authorID)
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, "", notFound(err, ErrUserNotFound)
+	}
+
+	if reviewersCount == 0 {
+		reviewersCount, err = s.teamReviewersCount(ctx, author.TeamName)
+		if err != nil {
+			return nil, "", err
+		}
 	}
 
-	candidates, err := s.db.GetActiveTeamMembers(author.TeamName, authorID)
+	reviewers := []string{}
+	warning := ""
+	if !isDraft {
+		reviewers, err = s.pickReviewers(ctx, author, reviewersCount)
+		if err != nil {
+			return nil, "", err
+		}
+		warning = shortageWarning(len(reviewers), reviewersCount)
+	}
+
+	audit := models.Audit{Actor: authorID, Reason: models.ReasonInitial}
+	// The existence check above is only a fast path: a concurrent create of
+	// the same ID loses on the primary key and is reported the same way.
+	if err := s.db.CreatePullRequest(ctx, prID, prName, authorID, isDraft, reviewersCount, reviewers, audit); err != nil {
+		if errors.Is(err, database.ErrUniqueViolation) {
+			return nil, "", ErrPRExists
+		}
+		return nil, "", err
+	}
+
+	pr, err := s.db.GetPullRequest(ctx, prID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	reviewers := selectRandomReviewers(candidates, 2)
+	return pr, warning, nil
+}
 
-	if err := s.db.CreatePullRequest(prID, prName, authorID, reviewers); err != nil {
+func (s *Service) pickReviewers(ctx context.Context, author *models.User, n int) ([]string, error) {
+	candidates, err := s.db.GetActiveTeamMembers(ctx, author.TeamName, author.UserID)
+	if err != nil {
 		return nil, err
 	}
 
-	return s.db.GetPullRequest(prID)
+	return s.chooseReviewers(ctx, author.TeamName, candidates, n, s.db)
+}
+
+func shortageWarning(assigned, requested int) string {
+	if assigned >= requested {
+		return ""
+	}
+	return fmt.Sprintf("only %d of %d requested reviewers available", assigned, requested)
 }
 
-func (s *Service) MergePullRequest(prID string) (*models.PullRequest, error) {
-	_, err := s.db.GetPullRequest(prID)
+// MarkReady takes a PR out of draft and assigns reviewers at that moment.
+func (s *Service) MarkReady(
+	ctx context.Context, caller models.Caller, prID string, version int64,
+) (*models.PullRequest, string, error) {
+	ctx, span := tracing.Start(ctx, "service.MarkReady")
+	defer span.End()
+
+	pr, err := s.db.GetPullRequest(ctx, prID)
+	if err != nil {
+		return nil, "", notFound(err, ErrPRNotFound)
+	}
+	if err := checkVersion(pr.Version, version); err != nil {
+		return nil, "", err
+	}
+
+	switch pr.Status {
+	case models.StatusMerged:
+		return nil, "", ErrPRMerged
+	case models.StatusClosed:
+		return nil, "", ErrPRClosed
+	}
+
+	if !pr.IsDraft {
+		return pr, "", nil
+	}
+
+	author, err := s.db.GetUser(ctx, pr.AuthorID)
 	if err != nil {
-		return nil, ErrPRNotFound
+		return nil, "", notFound(err, ErrUserNotFound)
 	}
 
-	if err := s.db.MergePullRequest(prID); err != nil {
+	reviewers, err := s.pickReviewers(ctx, author, pr.ReviewersCount)
+	if err != nil {
+		return nil, "", err
+	}
+
+	audit := models.Audit{Actor: caller.Actor(), Reason: models.ReasonInitial}
+	if err := s.db.MarkPullRequestReady(ctx, prID, pr.Version, reviewers, audit); err != nil {
+		return nil, "", versionError(err, version)
+	}
+
+	updatedPR, err := s.db.GetPullRequest(ctx, prID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return updatedPR, shortageWarning(len(reviewers), pr.ReviewersCount), nil
+}
+
+// MergePullRequest merges an OPEN PR once it satisfies the author team's merge
+// policy. mergedBy defaults to the caller, and only admins may merge on behalf
+// of someone else. It may only end up empty when the policy does not forbid
+// the author merging an unapproved PR.
+func (s *Service) MergePullRequest(
+	ctx context.Context, caller models.Caller, prID, mergedBy string, version int64,
+) (*models.PullRequest, error) {
+	ctx, span := tracing.Start(ctx, "service.MergePullRequest")
+	defer span.End()
+
+	mergedBy, err := actingUser(caller, mergedBy)
+	if err != nil {
 		return nil, err
 	}
 
-	return s.db.GetPullRequest(prID)
+	pr, err := s.db.GetPullRequest(ctx, prID)
+	if err != nil {
+		return nil, notFound(err, ErrPRNotFound)
+	}
+	if err := checkVersion(pr.Version, version); err != nil {
+		return nil, err
+	}
+
+	if pr.Status == models.StatusMerged {
+		return pr, nil
+	}
+	if pr.Status == models.StatusClosed {
+		return nil, ErrPRClosed
+	}
+	if pr.IsDraft {
+		return nil, ErrPRDraft
+	}
+
+	author, err := s.db.GetUser(ctx, pr.AuthorID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+
+	policy, err := s.db.GetMergePolicy(ctx, author.TeamName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkMergePolicy(policy, pr, mergedBy); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.MergePullRequest(ctx, prID, pr.Version, models.Audit{Actor: caller.Actor()}); err != nil {
+		return nil, versionError(err, version)
+	}
+
+	return s.db.GetPullRequest(ctx, prID)
 }
 
-func (s *Service) ReassignReviewer(prID, oldReviewerID string) (*models.PullRequest, string, error) {
-	pr, err := s.db.GetPullRequest(prID)
+// ReassignReviewer replaces oldReviewerID on the PR. Reviewers may reassign
+// themselves; replacing someone else is a lead's decision for the reviewer's
+// team.
+func (s *Service) ReassignReviewer(
+	ctx context.Context, caller models.Caller, prID, oldReviewerID string, version int64,
+) (*models.PullRequest, string, error) {
+	ctx, span := tracing.Start(ctx, "service.ReassignReviewer")
+	defer span.End()
+
+	pr, err := s.db.GetPullRequest(ctx, prID)
 	if err != nil {
-		return nil, "", ErrPRNotFound
+		return nil, "", notFound(err, ErrPRNotFound)
+	}
+	if err := checkVersion(pr.Version, version); err != nil {
+		return nil, "", err
 	}
 
-	if pr.Status == "MERGED" {
+	if pr.Status == models.StatusMerged {
 		return nil, "", ErrPRMerged
 	}
+	if pr.Status == models.StatusClosed {
+		return nil, "", ErrPRClosed
+	}
 
-	isAssigned, err := s.db.IsReviewerAssigned(prID, oldReviewerID)
+	isAssigned, err := s.db.IsReviewerAssigned(ctx, prID, oldReviewerID)
 	if err != nil {
 		return nil, "", err
 	}
@@ -72,37 +234,208 @@ func (s *Service) ReassignReviewer(prID, oldReviewerID string) (*models.PullRequ
 		return nil, "", ErrNotAssigned
 	}
 
-	oldReviewer, err := s.db.GetUser(oldReviewerID)
+	oldReviewer, err := s.db.GetUser(ctx, oldReviewerID)
 	if err != nil {
-		return nil, "", ErrUserNotFound
+		return nil, "", notFound(err, ErrUserNotFound)
+	}
+	if caller.UserID != oldReviewerID {
+		if err := s.authorizeTeamLead(ctx, caller, oldReviewer.TeamName); err != nil {
+			return nil, "", err
+		}
 	}
 
-	candidates, err := s.db.GetActiveTeamMembers(oldReviewer.TeamName, oldReviewerID)
+	candidates, err := s.db.GetActiveTeamMembers(ctx, oldReviewer.TeamName, oldReviewerID)
 	if err != nil {
 		return nil, "", err
 	}
 
+	assigned := make(map[string]bool, len(pr.AssignedReviewers))
+	for _, reviewerID := range pr.AssignedReviewers {
+		assigned[reviewerID] = true
+	}
+
 	var filteredCandidates []string
 	for _, candidate := range candidates {
-		if candidate != pr.AuthorID {
+		if candidate != pr.AuthorID && !assigned[candidate] {
 			filteredCandidates = append(filteredCandidates, candidate)
 		}
 	}
 
 	if len(filteredCandidates) == 0 {
+		s.metrics.noCandidate.Inc()
 		return nil, "", ErrNoCandidate
 	}
 
-	newReviewerID := selectRandomReviewers(filteredCandidates, 1)[0]
-
-	if err := s.db.ReassignReviewer(prID, oldReviewerID, newReviewerID); err != nil {
+	selected, err := s.chooseReviewers(ctx, oldReviewer.TeamName, filteredCandidates, 1, s.db)
+	if err != nil {
 		return nil, "", err
 	}
+	newReviewerID := selected[0]
+
+	audit := models.Audit{Actor: caller.Actor(), Reason: models.ReasonReassign}
+	if err := s.db.ReassignReviewer(ctx, prID, pr.Version, oldReviewerID, newReviewerID, audit); err != nil {
+		return nil, "", versionError(err, version)
+	}
+	s.metrics.reassignments.Inc(models.ReasonReassign)
 
-	updatedPR, err := s.db.GetPullRequest(prID)
+	updatedPR, err := s.db.GetPullRequest(ctx, prID)
 	if err != nil {
 		return nil, "", err
 	}
 
 	return updatedPR, newReviewerID, nil
 }
+
+// SubmitReview records the review of reviewerID, who defaults to the caller.
+// Only admins may submit a review on behalf of someone else.
+func (s *Service) SubmitReview(
+	ctx context.Context, caller models.Caller, prID, reviewerID, state string, version int64,
+) (*models.PullRequest, error) {
+	ctx, span := tracing.Start(ctx, "service.SubmitReview")
+	defer span.End()
+
+	reviewerID, err := actingUser(caller, reviewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch state {
+	case models.ReviewStateApproved, models.ReviewStateChangesRequested, models.ReviewStateCommented:
+	default:
+		return nil, ErrInvalidReviewState
+	}
+
+	pr, err := s.db.GetPullRequest(ctx, prID)
+	if err != nil {
+		return nil, notFound(err, ErrPRNotFound)
+	}
+	if err := checkVersion(pr.Version, version); err != nil {
+		return nil, err
+	}
+
+	if pr.Status == models.StatusMerged {
+		return nil, ErrPRMerged
+	}
+	if pr.Status == models.StatusClosed {
+		return nil, ErrPRClosed
+	}
+
+	isAssigned, err := s.db.IsReviewerAssigned(ctx, prID, reviewerID)
+	if err != nil {
+		return nil, err
+	}
+	if !isAssigned {
+		return nil, ErrNotAssigned
+	}
+
+	audit := models.Audit{Actor: caller.Actor()}
+	if err := s.db.SetReviewState(ctx, prID, pr.Version, reviewerID, state, audit); err != nil {
+		return nil, versionError(err, version)
+	}
+
+	return s.db.GetPullRequest(ctx, prID)
+}
+
+func (s *Service) ClosePullRequest(
+	ctx context.Context, caller models.Caller, prID string, version int64,
+) (*models.PullRequest, error) {
+	ctx, span := tracing.Start(ctx, "service.ClosePullRequest")
+	defer span.End()
+
+	pr, err := s.db.GetPullRequest(ctx, prID)
+	if err != nil {
+		return nil, notFound(err, ErrPRNotFound)
+	}
+	if err := checkVersion(pr.Version, version); err != nil {
+		return nil, err
+	}
+
+	switch pr.Status {
+	case models.StatusMerged:
+		return nil, ErrPRMerged
+	case models.StatusClosed:
+		return pr, nil
+	}
+
+	if err := s.db.ClosePullRequest(ctx, prID, pr.Version, models.Audit{Actor: caller.Actor()}); err != nil {
+		return nil, versionError(err, version)
+	}
+
+	return s.db.GetPullRequest(ctx, prID)
+}
+
+// ReopenPullRequest moves a CLOSED PR back to OPEN. Reviewers that became
+// inactive while the PR was closed are replaced by a fresh selection.
+func (s *Service) ReopenPullRequest(
+	ctx context.Context, caller models.Caller, prID string, version int64,
+) (*models.PullRequest, error) {
+	ctx, span := tracing.Start(ctx, "service.ReopenPullRequest")
+	defer span.End()
+
+	pr, err := s.db.GetPullRequest(ctx, prID)
+	if err != nil {
+		return nil, notFound(err, ErrPRNotFound)
+	}
+	if err := checkVersion(pr.Version, version); err != nil {
+		return nil, err
+	}
+
+	switch pr.Status {
+	case models.StatusMerged:
+		return nil, ErrPRMerged
+	case models.StatusOpen:
+		return pr, nil
+	}
+
+	// Reviewers who are inactive or absent now are replaced, using the same
+	// availability filter as reviewer selection.
+	available := make(map[string]map[string]bool)
+	var kept, removed []string
+	for _, reviewerID := range pr.AssignedReviewers {
+		reviewer, err := s.db.GetUser(ctx, reviewerID)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := available[reviewer.TeamName]; !ok {
+			members, err := s.db.GetActiveTeamMembers(ctx, reviewer.TeamName, "")
+			if err != nil {
+				return nil, err
+			}
+			available[reviewer.TeamName] = make(map[string]bool, len(members))
+			for _, userID := range members {
+				available[reviewer.TeamName][userID] = true
+			}
+		}
+		if available[reviewer.TeamName][reviewerID] {
+			kept = append(kept, reviewerID)
+		} else {
+			removed = append(removed, reviewerID)
+		}
+	}
+
+	var added []string
+	if missing := pr.ReviewersCount - len(kept); !pr.IsDraft && len(removed) > 0 && missing > 0 {
+		author, err := s.db.GetUser(ctx, pr.AuthorID)
+		if err != nil {
+			return nil, err
+		}
+
+		exclude := append([]string{pr.AuthorID}, pr.AssignedReviewers...)
+		candidates, err := s.db.GetActiveTeamMembersForReplacement(ctx, author.TeamName, exclude)
+		if err != nil {
+			return nil, err
+		}
+
+		added, err = s.chooseReviewers(ctx, author.TeamName, candidates, missing, s.db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	audit := models.Audit{Actor: caller.Actor(), Reason: models.ReasonReopen}
+	if err := s.db.ReopenPullRequest(ctx, prID, pr.Version, removed, added, audit); err != nil {
+		return nil, versionError(err, version)
+	}
+
+	return s.db.GetPullRequest(ctx, prID)
+}
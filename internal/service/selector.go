@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"pr-review-service/internal/models"
+	"sort"
+)
+
+var ErrInvalidStrategy = errors.New("unknown reviewer strategy")
+
+// ReviewerSelector picks up to n reviewers out of the given candidates.
+type ReviewerSelector interface {
+	Select(ctx context.Context, candidates []string, n int) ([]string, error)
+}
+
+// ReviewLoader reports how many OPEN pull requests each user is reviewing.
+type ReviewLoader interface {
+	GetOpenReviewCounts(ctx context.Context, userIDs []string) (map[string]int, error)
+}
+
+type RandomSelector struct{}
+
+func (RandomSelector) Select(ctx context.Context, candidates []string, n int) ([]string, error) {
+	return selectRandomReviewers(candidates, n), nil
+}
+
+// LeastLoadedSelector prefers candidates with the fewest open reviews,
+// breaking ties randomly.
+type LeastLoadedSelector struct {
+	loader ReviewLoader
+}
+
+func NewLeastLoadedSelector(loader ReviewLoader) *LeastLoadedSelector {
+	return &LeastLoadedSelector{loader: loader}
+}
+
+func (s *LeastLoadedSelector) Select(ctx context.Context, candidates []string, n int) ([]string, error) {
+	if len(candidates) == 0 || n <= 0 {
+		return []string{}, nil
+	}
+
+	loads, err := s.loader.GetOpenReviewCounts(ctx, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	shuffled := make([]string, len(candidates))
+	copy(shuffled, candidates)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	sort.SliceStable(shuffled, func(i, j int) bool {
+		return loads[shuffled[i]] < loads[shuffled[j]]
+	})
+
+	if len(shuffled) > n {
+		shuffled = shuffled[:n]
+	}
+	return shuffled, nil
+}
+
+// pendingLoader adds reassignments that are planned but not yet committed
+// on top of the stored counts, so a batch does not pile onto one reviewer.
+type pendingLoader struct {
+	base    ReviewLoader
+	pending map[string]int
+}
+
+func newPendingLoader(base ReviewLoader) *pendingLoader {
+	return &pendingLoader{base: base, pending: make(map[string]int)}
+}
+
+func (l *pendingLoader) GetOpenReviewCounts(ctx context.Context, userIDs []string) (map[string]int, error) {
+	counts, err := l.base.GetOpenReviewCounts(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, userID := range userIDs {
+		counts[userID] += l.pending[userID]
+	}
+	return counts, nil
+}
+
+func (l *pendingLoader) assign(userID string) {
+	l.pending[userID]++
+}
+
+func newSelector(strategy string, loader ReviewLoader) (ReviewerSelector, error) {
+	switch strategy {
+	case models.StrategyRandom:
+		return RandomSelector{}, nil
+	case models.StrategyLeastLoaded:
+		return NewLeastLoadedSelector(loader), nil
+	}
+	return nil, ErrInvalidStrategy
+}
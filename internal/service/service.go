@@ -1,16 +1,153 @@
 package service
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
 	"math/rand"
+	"net/http"
 	"pr-review-service/internal/database"
+	"pr-review-service/internal/health"
+	"pr-review-service/internal/metrics"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
+	"sync/atomic"
+	"time"
 )
 
+type Options struct {
+	DefaultReviewerStrategy string
+	// DefaultReviewersCount applies to teams without their own default;
+	// models.DefaultReviewersPerPR when zero.
+	DefaultReviewersCount int
+	IdempotencyTTL        time.Duration
+
+	WebhookMaxAttempts int
+	WebhookBackoff     time.Duration
+	// WebhookClient sends webhook deliveries; its Timeout bounds one attempt.
+	WebhookClient *http.Client
+
+	// GitHubWebhookSecret enables the GitHub receiver when set.
+	GitHubWebhookSecret string
+	// GitLabWebhookToken enables the GitLab receiver when set.
+	GitLabWebhookToken string
+
+	// Metrics receives the service counters and workload gauges.
+	Metrics *metrics.Registry
+	// Logger receives background worker failures; slog.Default() when nil.
+	Logger *slog.Logger
+	// Tracer starts the root spans of background workers; nil disables them.
+	// Request spans come from the context passed to each method.
+	Tracer *tracing.Tracer
+	// Health receives the database and webhook worker readiness checks.
+	Health *health.Registry
+}
+
 type Service struct {
-	db *database.DB
+	db                      database.Store
+	defaultReviewerStrategy string
+	defaultReviewersCount   int
+	idempotencyTTL          time.Duration
+
+	webhookMaxAttempts int
+	webhookBackoff     time.Duration
+	webhookClient      *http.Client
+
+	githubWebhookSecret string
+	gitlabWebhookToken  string
+
+	metrics serviceMetrics
+	logger  *slog.Logger
+	tracer  *tracing.Tracer
+
+	webhookWorkerRunning atomic.Bool
 }
 
-func NewService(db *database.DB) *Service {
-	return &Service{db: db}
+func NewService(db database.Store, opts Options) *Service {
+	strategy := opts.DefaultReviewerStrategy
+	if strategy == "" {
+		strategy = models.StrategyRandom
+	}
+	idempotencyTTL := opts.IdempotencyTTL
+	if idempotencyTTL <= 0 {
+		idempotencyTTL = DefaultIdempotencyTTL
+	}
+
+	svc := &Service{
+		db:                      db,
+		defaultReviewerStrategy: strategy,
+		defaultReviewersCount:   opts.DefaultReviewersCount,
+		idempotencyTTL:          idempotencyTTL,
+		webhookMaxAttempts:      opts.WebhookMaxAttempts,
+		webhookBackoff:          opts.WebhookBackoff,
+		webhookClient:           opts.WebhookClient,
+		githubWebhookSecret:     opts.GitHubWebhookSecret,
+		gitlabWebhookToken:      opts.GitLabWebhookToken,
+		logger:                  opts.Logger,
+		tracer:                  opts.Tracer,
+	}
+	if svc.defaultReviewersCount <= 0 {
+		svc.defaultReviewersCount = models.DefaultReviewersPerPR
+	}
+	if svc.webhookMaxAttempts <= 0 {
+		svc.webhookMaxAttempts = DefaultWebhookMaxAttempts
+	}
+	if svc.webhookBackoff <= 0 {
+		svc.webhookBackoff = DefaultWebhookBackoff
+	}
+	if svc.webhookClient == nil {
+		svc.webhookClient = &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+	if svc.logger == nil {
+		svc.logger = slog.Default()
+	}
+
+	registry := opts.Metrics
+	if registry == nil {
+		registry = metrics.NewRegistry()
+	}
+	svc.registerMetrics(registry)
+	if opts.Health != nil {
+		svc.registerHealthChecks(opts.Health)
+	}
+	return svc
+}
+
+func (s *Service) registerHealthChecks(reg *health.Registry) {
+	reg.Register("database", s.HealthCheck)
+	reg.Register("webhook_worker", func(context.Context) error {
+		if !s.webhookWorkerRunning.Load() {
+			return errors.New("webhook worker is not running")
+		}
+		return nil
+	})
+}
+
+// notFound reports a missing row as notFoundErr and passes every other
+// failure, such as a timed out query, through unchanged.
+func notFound(err, notFoundErr error) error {
+	if err == sql.ErrNoRows {
+		return notFoundErr
+	}
+	return err
+}
+
+// IsTimeout reports whether err means the request or one of its queries ran
+// out of time or was abandoned by the client.
+func IsTimeout(err error) bool {
+	return database.IsCanceled(err)
+}
+
+// runTraced runs one pass of a background worker under its own root span, so
+// its queries are traced like those of a request.
+func (s *Service) runTraced(name string, fn func(ctx context.Context) error) error {
+	ctx, span := s.tracer.Start(context.Background(), name, tracing.KindInternal)
+	defer span.End()
+
+	err := fn(ctx)
+	span.SetError(err)
+	return err
 }
 
 func selectRandomReviewers(candidates []string, n int) []string {
@@ -31,6 +168,34 @@ func selectRandomReviewers(candidates []string, n int) []string {
 	return shuffled[:n]
 }
 
-func (s *Service) HealthCheck() error {
-	return s.db.Ping()
+// selectorForTeam returns the selector configured for the team, falling back
+// to the service-wide default strategy.
+func (s *Service) selectorForTeam(ctx context.Context, teamName string, loader ReviewLoader) (ReviewerSelector, error) {
+	strategy, err := s.db.GetTeamReviewerStrategy(ctx, teamName)
+	if err != nil {
+		return nil, err
+	}
+	if strategy == "" {
+		strategy = s.defaultReviewerStrategy
+	}
+	return newSelector(strategy, loader)
+}
+
+// teamReviewersCount returns how many reviewers a team's PRs get by default.
+func (s *Service) teamReviewersCount(ctx context.Context, teamName string) (int, error) {
+	count, err := s.db.GetTeamDefaultReviewers(ctx, teamName)
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		count = s.defaultReviewersCount
+	}
+	return count, nil
+}
+
+func (s *Service) HealthCheck(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "service.HealthCheck")
+	defer span.End()
+
+	return s.db.Ping(ctx)
 }
@@ -0,0 +1,1293 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pr-review-service/internal/database"
+	"pr-review-service/internal/health"
+	"pr-review-service/internal/metrics"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// admin passes every role check.
+var admin = models.Caller{Admin: true}
+
+// ctx is passed to every call; no test cancels it.
+var ctx = context.Background()
+
+func newTestService(t *testing.T, teams map[string][]string) (*Service, *database.MemoryStore) {
+	t.Helper()
+
+	store := database.NewMemoryStore()
+	for teamName, userIDs := range teams {
+		team := &models.Team{TeamName: teamName}
+		for _, userID := range userIDs {
+			team.Members = append(team.Members, models.TeamMember{UserID: userID, Username: userID, IsActive: true})
+		}
+		if err := store.CreateTeam(ctx, team, models.Audit{}); err != nil {
+			t.Fatalf("CreateTeam(%s): %v", teamName, err)
+		}
+	}
+
+	return NewService(store, Options{}), store
+}
+
+func TestCreatePullRequestExcludesAuthorAndInactive(t *testing.T) {
+	svc, store := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3", "u4"}})
+	if err := store.SetUserActive(ctx, "u3", false, 0, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, warning, err := svc.CreatePullRequest(ctx, "pr-1", "Add search", "u1", false, 0)
+	if err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+	if warning != "" {
+		t.Fatalf("unexpected warning %q", warning)
+	}
+	if len(pr.AssignedReviewers) != 2 || pr.AssignedReviewers[0] != "u2" || pr.AssignedReviewers[1] != "u4" {
+		t.Fatalf("reviewers = %v, want [u2 u4]", pr.AssignedReviewers)
+	}
+
+	if _, _, err := svc.CreatePullRequest(ctx, "pr-1", "Again", "u1", false, 0); err != ErrPRExists {
+		t.Fatalf("duplicate create: err = %v, want ErrPRExists", err)
+	}
+}
+
+// racingStore hides existing PRs from PRExists, as if a concurrent request
+// inserted the same ID right after the check.
+type racingStore struct {
+	*database.MemoryStore
+}
+
+func (racingStore) PRExists(context.Context, string) (bool, error) {
+	return false, nil
+}
+
+func TestCreatePullRequestMapsConcurrentDuplicate(t *testing.T) {
+	_, store := newTestService(t, map[string][]string{"backend": {"u1", "u2"}})
+	svc := NewService(racingStore{store}, Options{})
+
+	if _, _, err := svc.CreatePullRequest(ctx, "pr-1", "First", "u1", false, 1); err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+	if _, _, err := svc.CreatePullRequest(ctx, "pr-1", "Second", "u1", false, 1); err != ErrPRExists {
+		t.Fatalf("duplicate create: err = %v, want ErrPRExists", err)
+	}
+}
+
+// slowStore answers GetUser only when the caller gives up, like a query
+// stuck behind a lock.
+type slowStore struct {
+	*database.MemoryStore
+}
+
+func (slowStore) GetUser(ctx context.Context, _ string) (*models.User, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestLookupTimeoutIsNotReportedAsNotFound(t *testing.T) {
+	_, store := newTestService(t, map[string][]string{"backend": {"u1", "u2"}})
+	svc := NewService(slowStore{store}, Options{})
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, _, err := svc.CreatePullRequest(timeoutCtx, "pr-1", "Slow", "u1", false, 1)
+	if !IsTimeout(err) || err == ErrUserNotFound {
+		t.Fatalf("CreatePullRequest: err = %v, want a timeout", err)
+	}
+	if _, err := svc.GetTeam(ctx, "missing"); err != ErrTeamNotFound {
+		t.Fatalf("GetTeam: err = %v, want ErrTeamNotFound", err)
+	}
+}
+
+func TestHealthChecksFollowWebhookWorker(t *testing.T) {
+	probes := health.NewRegistry()
+	probes.MarkStarted()
+	svc := NewService(database.NewMemoryStore(), Options{Health: probes})
+
+	report := probes.Check(ctx)
+	if report.Ready() || len(report.Checks) != 2 || report.Checks[1].Name != "webhook_worker" {
+		t.Fatalf("before the worker starts: %+v", report)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		svc.RunWebhookWorker(time.Hour, stop)
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for !probes.Check(ctx).Ready() {
+		if time.Now().After(deadline) {
+			t.Fatalf("worker running: %+v", probes.Check(ctx))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(stop)
+	<-done
+	if report := probes.Check(ctx); report.Ready() {
+		t.Fatalf("after the worker stopped: %+v", report)
+	}
+}
+
+func TestIdempotentRequestLifecycle(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+
+	record, err := svc.BeginIdempotentRequest(ctx, "key-1", "hash-a")
+	if err != nil || record != nil {
+		t.Fatalf("first Begin = %+v, %v; want a fresh reservation", record, err)
+	}
+	if _, err := svc.BeginIdempotentRequest(ctx, "key-1", "hash-a"); err != ErrIdempotencyInProgress {
+		t.Fatalf("Begin while running: err = %v, want ErrIdempotencyInProgress", err)
+	}
+
+	if err := svc.FinishIdempotentRequest(ctx, "key-1", 201, `"1"`, []byte(`{"pr":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+	record, err = svc.BeginIdempotentRequest(ctx, "key-1", "hash-a")
+	if err != nil || record == nil || record.StatusCode != 201 || string(record.Body) != `{"pr":{}}` {
+		t.Fatalf("Begin after finish = %+v, %v; want stored response", record, err)
+	}
+	if _, err := svc.BeginIdempotentRequest(ctx, "key-1", "hash-b"); err != ErrIdempotencyKeyReused {
+		t.Fatalf("Begin with another body: err = %v, want ErrIdempotencyKeyReused", err)
+	}
+
+	if _, err := svc.BeginIdempotentRequest(ctx, "key-2", "hash-a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.FinishIdempotentRequest(ctx, "key-2", 500, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if record, err := svc.BeginIdempotentRequest(ctx, "key-2", "hash-a"); err != nil || record != nil {
+		t.Fatalf("Begin after server error = %+v, %v; want the request to run again", record, err)
+	}
+}
+
+func TestCreatePullRequestWarnsOnShortage(t *testing.T) {
+	svc, _ := newTestService(t, map[string][]string{"pair": {"u1", "u2"}})
+
+	pr, warning, err := svc.CreatePullRequest(ctx, "pr-1", "Small team", "u1", false, 3)
+	if err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+	if len(pr.AssignedReviewers) != 1 || warning == "" {
+		t.Fatalf("reviewers = %v, warning = %q", pr.AssignedReviewers, warning)
+	}
+}
+
+func TestLeastLoadedStrategyPrefersIdleReviewers(t *testing.T) {
+	svc, store := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3", "u4"}})
+	if err := store.SetTeamReviewerStrategy(ctx, "backend", models.StrategyLeastLoaded, 0, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+	err := store.CreatePullRequest(ctx, "busy-1", "Busy", "u4", false, 2, []string{"u2", "u3"}, models.Audit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreatePullRequest(ctx, "busy-2", "Busy", "u4", false, 2, []string{"u2"}, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, _, err := svc.CreatePullRequest(ctx, "pr-1", "Feature", "u1", false, 1)
+	if err != nil {
+		t.Fatalf("CreatePullRequest: %v", err)
+	}
+	if len(pr.AssignedReviewers) != 1 || pr.AssignedReviewers[0] != "u4" {
+		t.Fatalf("reviewers = %v, want [u4]", pr.AssignedReviewers)
+	}
+}
+
+func TestReassignReviewerRules(t *testing.T) {
+	svc, store := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3"}})
+	err := store.CreatePullRequest(ctx, "pr-1", "Feature", "u1", false, 2, []string{"u2", "u3"}, models.Audit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := svc.ReassignReviewer(ctx, admin, "pr-1", "u2", 0); err != ErrNoCandidate {
+		t.Fatalf("ReassignReviewer without candidates: err = %v, want ErrNoCandidate", err)
+	}
+	if _, _, err := svc.ReassignReviewer(ctx, admin, "pr-1", "u1", 0); err != ErrNotAssigned {
+		t.Fatalf("ReassignReviewer(author): err = %v, want ErrNotAssigned", err)
+	}
+
+	if err := store.CreateTeam(ctx, &models.Team{
+		TeamName: "backend",
+		Members:  []models.TeamMember{{UserID: "u5", Username: "u5", IsActive: true}},
+	}, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+	pr, replacedBy, err := svc.ReassignReviewer(ctx, admin, "pr-1", "u2", 0)
+	if err != nil {
+		t.Fatalf("ReassignReviewer: %v", err)
+	}
+	if replacedBy != "u5" || pr.AssignedReviewers[0] != "u3" || pr.AssignedReviewers[1] != "u5" {
+		t.Fatalf("replaced_by = %s, reviewers = %v", replacedBy, pr.AssignedReviewers)
+	}
+
+	if _, err := svc.MergePullRequest(ctx, admin, "pr-1", "", 0); err != nil {
+		t.Fatalf("MergePullRequest: %v", err)
+	}
+	if _, _, err := svc.ReassignReviewer(ctx, admin, "pr-1", "u3", 0); err != ErrPRMerged {
+		t.Fatalf("ReassignReviewer on merged PR: err = %v, want ErrPRMerged", err)
+	}
+}
+
+func TestBulkDeactivateFallsBackToAuthorTeam(t *testing.T) {
+	svc, store := newTestService(t, map[string][]string{
+		"backend": {"b1", "b2"},
+		"qa":      {"q1", "q2"},
+	})
+	err := store.CreatePullRequest(ctx, "pr-1", "Feature", "b1", false, 2, []string{"b2", "q1"}, models.Audit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.CreatePullRequest(ctx, "pr-2", "Fix", "b1", false, 2, []string{"q1", "q2"}, models.Audit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := svc.BulkDeactivateTeamUsers(ctx, admin, "qa", 0)
+	if err != nil {
+		t.Fatalf("BulkDeactivateTeamUsers: %v", err)
+	}
+	if result.DeactivatedCount != 2 {
+		t.Fatalf("deactivated = %v", result.DeactivatedUsers)
+	}
+
+	pr, err := store.GetPullRequest(ctx, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.AssignedReviewers) != 2 || pr.AssignedReviewers[1] != "q1" {
+		t.Fatalf("pr-1 reviewers = %v, want q1 kept (no free candidate left)", pr.AssignedReviewers)
+	}
+
+	pr, err = store.GetPullRequest(ctx, "pr-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.AssignedReviewers) != 2 || pr.AssignedReviewers[0] != "b2" || pr.AssignedReviewers[1] != "q2" {
+		t.Fatalf("pr-2 reviewers = %v, want [b2 q2]: one slot filled from the author's team", pr.AssignedReviewers)
+	}
+}
+
+// interferingStore runs interfere once, between planning a bulk reassignment
+// and applying it, like a concurrent request.
+type interferingStore struct {
+	*database.MemoryStore
+	once      sync.Once
+	interfere func()
+}
+
+func (s *interferingStore) BulkReassignReviewers(
+	ctx context.Context, plans map[string]models.ReviewerPlan, audit models.Audit,
+) ([]string, error) {
+	s.once.Do(s.interfere)
+	return s.MemoryStore.BulkReassignReviewers(ctx, plans, audit)
+}
+
+func TestBulkDeactivateReplansConcurrentlyChangedPRs(t *testing.T) {
+	_, memory := newTestService(t, map[string][]string{
+		"backend": {"b1", "b2", "b3"},
+		"qa":      {"q1"},
+	})
+	store := &interferingStore{MemoryStore: memory}
+	svc := NewService(store, Options{})
+	for _, prID := range []string{"pr-1", "pr-2"} {
+		err := store.CreatePullRequest(ctx, prID, "Feature", "b1", false, 2, []string{"b2", "q1"}, models.Audit{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.interfere = func() {
+		if err := store.SetReviewState(ctx, "pr-1", 0, "b2", models.ReviewStateApproved, models.Audit{}); err != nil {
+			t.Error(err)
+		}
+		if err := store.MergePullRequest(ctx, "pr-2", 0, models.Audit{}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	result, err := svc.BulkDeactivateTeamUsers(ctx, admin, "qa", 0)
+	if err != nil {
+		t.Fatalf("BulkDeactivateTeamUsers: %v", err)
+	}
+	if len(result.ReassignedPRs) != 1 || result.ReassignedPRs[0] != "pr-1" {
+		t.Fatalf("reassigned = %v, want [pr-1] replanned after the review", result.ReassignedPRs)
+	}
+
+	pr, err := store.GetPullRequest(ctx, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.AssignedReviewers[1] != "b3" || pr.Reviews[0].State != models.ReviewStateApproved {
+		t.Fatalf("pr-1 = %+v, want q1 replaced by b3 and the approval kept", pr)
+	}
+	pr, err = store.GetPullRequest(ctx, "pr-2")
+	if err != nil || pr.Status != models.StatusMerged || pr.AssignedReviewers[1] != "q1" {
+		t.Fatalf("pr-2 = %+v, want the merged PR left alone", pr)
+	}
+}
+
+func TestCapacityFallbackError(t *testing.T) {
+	svc, store := newTestService(t, map[string][]string{"backend": {"u1", "u2"}})
+	if err := store.SetUserMaxOpenReviews(ctx, "u2", 1, 0, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreatePullRequest(ctx, "busy", "Busy", "u1", false, 1, []string{"u2"}, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, _, err := svc.CreatePullRequest(ctx, "pr-1", "Fallback", "u1", false, 1)
+	if err != nil {
+		t.Fatalf("CreatePullRequest with least_loaded fallback: %v", err)
+	}
+	if len(pr.AssignedReviewers) != 1 {
+		t.Fatalf("reviewers = %v, want the least-loaded candidate", pr.AssignedReviewers)
+	}
+
+	if err := store.SetTeamCapacityFallback(ctx, "backend", CapacityFallbackError, 0, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.CreatePullRequest(ctx, "pr-2", "Blocked", "u1", false, 1); err != ErrAllAtCapacity {
+		t.Fatalf("CreatePullRequest: err = %v, want ErrAllAtCapacity", err)
+	}
+}
+
+func TestMergePolicyBlocksMerge(t *testing.T) {
+	svc, store := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3"}})
+	if err := store.SetMergePolicy(ctx, &models.MergePolicy{
+		TeamName:                "backend",
+		MinApprovals:            1,
+		BlockOnChangesRequested: true,
+	}, 0, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+	err := store.CreatePullRequest(ctx, "pr-1", "Feature", "u1", false, 2, []string{"u2", "u3"}, models.Audit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SubmitReview(ctx, admin, "pr-1", "u3", models.ReviewStateChangesRequested, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = svc.MergePullRequest(ctx, admin, "pr-1", "u1", 0)
+	var blocked *MergeBlockedError
+	if !errors.As(err, &blocked) || len(blocked.Violations) != 2 {
+		t.Fatalf("MergePullRequest: err = %v, want two violations", err)
+	}
+
+	if _, err := svc.SubmitReview(ctx, admin, "pr-1", "u2", models.ReviewStateApproved, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SubmitReview(ctx, admin, "pr-1", "u3", models.ReviewStateApproved, 0); err != nil {
+		t.Fatal(err)
+	}
+	pr, err := svc.MergePullRequest(ctx, admin, "pr-1", "u1", 0)
+	if err != nil || pr.Status != models.StatusMerged {
+		t.Fatalf("MergePullRequest = %+v, %v", pr, err)
+	}
+}
+
+func TestSelfMergeRuleNeedsAKnownMerger(t *testing.T) {
+	svc, store := newTestService(t, map[string][]string{"backend": {"u1", "u2"}})
+	if err := store.SetMergePolicy(ctx, &models.MergePolicy{
+		TeamName:              "backend",
+		ForbidAuthorSelfMerge: true,
+	}, 0, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreatePullRequest(ctx, "pr-1", "Feature", "u1", false, 1, []string{"u2"}, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mergedBy := range []string{"", "u1"} {
+		_, err := svc.MergePullRequest(ctx, admin, "pr-1", mergedBy, 0)
+		var blocked *MergeBlockedError
+		if !errors.As(err, &blocked) || !strings.HasPrefix(blocked.Violations[0], RuleAuthorSelfMerge) {
+			t.Fatalf("merge by %q: err = %v, want %s", mergedBy, err, RuleAuthorSelfMerge)
+		}
+	}
+
+	pr, err := svc.MergePullRequest(ctx, admin, "pr-1", "u2", 0)
+	if err != nil || pr.Status != models.StatusMerged {
+		t.Fatalf("merge by another user = %+v, %v", pr, err)
+	}
+}
+
+func TestReviewAndMergeActAsTheCaller(t *testing.T) {
+	svc, store := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3"}})
+	err := store.CreatePullRequest(ctx, "pr-1", "Feature", "u1", false, 2, []string{"u2", "u3"}, models.Audit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewer := models.Caller{UserID: "u2"}
+
+	if _, err := svc.SubmitReview(ctx, reviewer, "pr-1", "u3", models.ReviewStateApproved, 0); err != ErrForbidden {
+		t.Fatalf("review as someone else: err = %v, want ErrForbidden", err)
+	}
+	unbound := models.Caller{Source: "token:7"}
+	if _, err := svc.SubmitReview(ctx, unbound, "pr-1", "u3", models.ReviewStateApproved, 0); err != ErrUnboundToken {
+		t.Fatalf("review by a token without a user: err = %v, want ErrUnboundToken", err)
+	}
+	pr, err := svc.SubmitReview(ctx, reviewer, "pr-1", "", models.ReviewStateApproved, 0)
+	if err != nil || pr.Reviews[0].ReviewerID != "u2" || pr.Reviews[0].State != models.ReviewStateApproved {
+		t.Fatalf("review as the caller = %+v, %v", pr, err)
+	}
+	if _, err := svc.SubmitReview(ctx, admin, "pr-1", "u3", models.ReviewStateCommented, 0); err != nil {
+		t.Fatalf("admin review on behalf of u3: %v", err)
+	}
+
+	if _, err := svc.MergePullRequest(ctx, reviewer, "pr-1", "u1", 0); err != ErrForbidden {
+		t.Fatalf("merge as someone else: err = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.MergePullRequest(ctx, reviewer, "pr-1", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	merged, err := svc.ListEvents(ctx, models.EventFilter{Type: models.EventPRMerged})
+	if err != nil || len(merged) != 1 || merged[0].Actor != "u2" {
+		t.Fatalf("merge events = %+v, %v", merged, err)
+	}
+}
+
+func TestVersionPreconditions(t *testing.T) {
+	svc, store := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3"}})
+	if err := store.CreatePullRequest(ctx, "pr-1", "Feature", "u1", false, 1, []string{"u2"}, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.ClosePullRequest(ctx, admin, "pr-1", 7); err != ErrVersionMismatch {
+		t.Fatalf("ClosePullRequest(stale If-Match): err = %v, want ErrVersionMismatch", err)
+	}
+
+	pr, err := svc.SubmitReview(ctx, admin, "pr-1", "u2", models.ReviewStateApproved, 1)
+	if err != nil {
+		t.Fatalf("SubmitReview(current version): %v", err)
+	}
+	if pr.Version != 2 {
+		t.Fatalf("version after review = %d, want 2", pr.Version)
+	}
+
+	if _, err := svc.SetTeamDefaultReviewers(ctx, admin, "backend", 2, 99); err != ErrVersionMismatch {
+		t.Fatalf("SetTeamDefaultReviewers(stale If-Match): err = %v, want ErrVersionMismatch", err)
+	}
+	team, err := svc.SetTeamDefaultReviewers(ctx, admin, "backend", 2, 0)
+	if err != nil {
+		t.Fatalf("SetTeamDefaultReviewers: %v", err)
+	}
+	if _, err := svc.SetTeamReviewerStrategy(ctx, admin, "backend", models.StrategyLeastLoaded, team.Version); err != nil {
+		t.Fatalf("SetTeamReviewerStrategy(current version): %v", err)
+	}
+}
+
+func TestPullRequestHistoryRecordsReasons(t *testing.T) {
+	svc, _ := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3"}})
+	created, _, err := svc.CreatePullRequest(ctx, "pr-1", "Feature", "u1", false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, newReviewerID, err := svc.ReassignReviewer(ctx, admin, "pr-1", created.AssignedReviewers[0], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.BulkDeactivateTeamUsers(ctx, admin, "backend", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := svc.GetPullRequestHistory(ctx, pr.PullRequestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reasons []string
+	for _, event := range history {
+		if event.UserID == newReviewerID && event.Type == models.EventReviewerAssigned {
+			reasons = append(reasons, event.Reason)
+		}
+	}
+	if len(reasons) != 1 || reasons[0] != models.ReasonReassign {
+		t.Fatalf("assignment reasons of %s = %v, want [reassign]", newReviewerID, reasons)
+	}
+	if history[0].Actor != "u1" || history[0].Type != models.EventPRCreated {
+		t.Fatalf("first event = %+v", history[0])
+	}
+
+	deactivated, err := svc.ListEvents(ctx, models.EventFilter{Type: models.EventUserDeactivated})
+	if err != nil || len(deactivated) != 3 {
+		t.Fatalf("deactivation events = %+v, %v", deactivated, err)
+	}
+
+	if _, err := svc.GetPullRequestHistory(ctx, "missing"); err != ErrPRNotFound {
+		t.Fatalf("history of unknown PR: err = %v, want ErrPRNotFound", err)
+	}
+	if _, err := svc.ListEvents(ctx, models.EventFilter{Limit: MaxEventsLimit + 1}); err != ErrInvalidEventFilter {
+		t.Fatalf("oversized limit: err = %v, want ErrInvalidEventFilter", err)
+	}
+}
+
+func TestChangesRecordTheCallerAsActor(t *testing.T) {
+	svc, store := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3"}})
+	if _, _, err := svc.CreatePullRequest(ctx, "pr-1", "Feature", "u1", true, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetUserRole(ctx, "u2", models.RoleLead, 0, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+	setup, err := svc.ListEvents(ctx, models.EventFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lead := models.Caller{UserID: "u2"}
+	token := models.Caller{Admin: true, Source: "token:7"}
+
+	if _, _, err := svc.MarkReady(ctx, lead, "pr-1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ClosePullRequest(ctx, token, "pr-1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ReopenPullRequest(ctx, lead, "pr-1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetTeamDefaultReviewers(ctx, token, "backend", 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetMergePolicy(ctx, token, &models.MergePolicy{TeamName: "backend"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetUserMaxOpenReviews(ctx, lead, "u3", 4, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := svc.ListEvents(ctx, models.EventFilter{AfterID: setup[len(setup)-1].EventID})
+	if err != nil || len(events) < 6 {
+		t.Fatalf("events = %+v, %v", events, err)
+	}
+	want := map[string]string{
+		models.EventPRReady:    "u2",
+		models.EventPRClosed:   "token:7",
+		models.EventPRReopened: "u2",
+	}
+	for _, event := range events {
+		if event.Actor == "" {
+			t.Errorf("%s event has no actor", event.Type)
+		}
+		if actor, ok := want[event.Type]; ok && event.Actor != actor {
+			t.Errorf("%s actor = %q, want %q", event.Type, event.Actor, actor)
+		}
+	}
+}
+
+func TestWebhookDeliverySignsAndRetries(t *testing.T) {
+	var mu sync.Mutex
+	var received []WebhookPayload
+	failures := 1
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != SignPayload("secret", body) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received = append(received, payload)
+	}))
+	defer receiver.Close()
+
+	store := database.NewMemoryStore()
+	svc := NewService(store, Options{WebhookBackoff: time.Nanosecond, WebhookMaxAttempts: 3})
+	if err := svc.CreateTeam(ctx, admin, &models.Team{TeamName: "backend", Members: []models.TeamMember{
+		{UserID: "u1", Username: "u1", IsActive: true},
+		{UserID: "u2", Username: "u2", IsActive: true},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	webhook, err := svc.CreateWebhook(ctx, &models.Webhook{
+		URL: receiver.URL, Secret: "secret", EventTypes: []string{models.EventReviewerAssigned},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.CreatePullRequest(ctx, "pr-1", "Feature", "u1", false, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := svc.DeliverPendingWebhooks(ctx); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(received) != 1 || received[0].Event.UserID != "u2" || received[0].Event.PullRequestID != "pr-1" {
+		t.Fatalf("received = %+v", received)
+	}
+	deliveries, err := svc.ListWebhookDeliveries(ctx, models.WebhookDeliveryFilter{WebhookID: webhook.WebhookID})
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("deliveries = %+v, %v", deliveries, err)
+	}
+	if d := deliveries[0]; d.Status != models.DeliveryDelivered || d.Attempts != 2 || d.LastStatusCode != http.StatusOK {
+		t.Fatalf("delivery = %+v, want DELIVERED after one retry", d)
+	}
+}
+
+func TestWebhookDeliveryDeadLetters(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	_, store := newTestService(t, map[string][]string{"backend": {"u1", "u2"}})
+	svc := NewService(store, Options{WebhookBackoff: time.Nanosecond, WebhookMaxAttempts: 2})
+	if _, err := svc.CreateWebhook(ctx, &models.Webhook{
+		URL: receiver.URL, Secret: "secret", EventTypes: []string{models.EventUserDeactivated},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetUserActive(ctx, admin, "u2", false, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := svc.DeliverPendingWebhooks(ctx); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	dead, err := svc.ListWebhookDeliveries(ctx, models.WebhookDeliveryFilter{Status: models.DeliveryDead})
+	if err != nil || len(dead) != 1 || dead[0].Attempts != 2 || dead[0].LastError == "" {
+		t.Fatalf("dead deliveries = %+v, %v", dead, err)
+	}
+
+	retried, err := svc.RetryWebhookDelivery(ctx, dead[0].DeliveryID)
+	if err != nil || retried.Status != models.DeliveryPending {
+		t.Fatalf("RetryWebhookDelivery = %+v, %v", retried, err)
+	}
+	if _, err := svc.RetryWebhookDelivery(ctx, dead[0].DeliveryID); err != ErrDeliveryNotDead {
+		t.Fatalf("retry of pending delivery: err = %v, want ErrDeliveryNotDead", err)
+	}
+
+	if _, err := svc.CreateWebhook(ctx, &models.Webhook{
+		URL: "ftp://example", Secret: "s", EventTypes: []string{models.EventPRMerged},
+	}); err != ErrInvalidWebhook {
+		t.Fatalf("non-http URL: err = %v, want ErrInvalidWebhook", err)
+	}
+}
+
+func loadPayload(t *testing.T, provider, name string) []byte {
+	t.Helper()
+
+	body, err := os.ReadFile(filepath.Join("testdata", provider, name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestGitHubWebhookDrivesPullRequestLifecycle(t *testing.T) {
+	_, store := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3"}})
+	svc := NewService(store, Options{GitHubWebhookSecret: "gh-secret"})
+	if _, err := svc.SetExternalAccount(ctx, &models.ExternalAccount{
+		Provider: models.ProviderGitHub, Login: "octo-alice", UserID: "u1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// The merge already happened on GitHub, so the local policy must not stop
+	// it from being recorded.
+	policy := &models.MergePolicy{TeamName: "backend", MinApprovals: 2, ForbidAuthorSelfMerge: true}
+	if err := store.SetMergePolicy(ctx, policy, 0, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+
+	deliver := func(eventType, name string) (*models.InboundResult, error) {
+		body := loadPayload(t, "github", name)
+		return svc.HandleGitHubWebhook(ctx, eventType, SignPayload("gh-secret", body), body)
+	}
+
+	steps := []struct {
+		payload string
+		status  string
+	}{
+		{"pull_request_opened", models.StatusOpen},
+		{"pull_request_opened", models.StatusOpen},
+		{"pull_request_closed", models.StatusClosed},
+		{"pull_request_reopened", models.StatusOpen},
+		{"pull_request_merged", models.StatusMerged},
+	}
+	for _, step := range steps {
+		result, err := deliver("pull_request", step.payload)
+		if err != nil {
+			t.Fatalf("%s: %v", step.payload, err)
+		}
+		if result.PullRequest == nil || result.PullRequest.Status != step.status {
+			t.Fatalf("%s: result = %+v, want status %s", step.payload, result, step.status)
+		}
+	}
+
+	pr, err := store.GetPullRequest(ctx, "acme/payments#42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.AuthorID != "u1" || pr.PullRequestName != "Retry failed card captures" || len(pr.AssignedReviewers) != 2 {
+		t.Fatalf("PR = %+v", pr)
+	}
+	closed, err := svc.ListEvents(ctx, models.EventFilter{PullRequestID: pr.PullRequestID, Type: models.EventPRClosed})
+	if err != nil || len(closed) != 1 || closed[0].Actor != "u1" {
+		t.Fatalf("close events = %+v, %v; want one by the mapped sender u1", closed, err)
+	}
+	merged, err := svc.ListEvents(ctx, models.EventFilter{PullRequestID: pr.PullRequestID, Type: models.EventPRMerged})
+	if err != nil || len(merged) != 1 || merged[0].Actor != "github:octo-bob" {
+		t.Fatalf("merge events = %+v, %v; want one by the unmapped login", merged, err)
+	}
+
+	result, err := deliver("pull_request", "pull_request_labeled")
+	if err != nil || !result.Ignored {
+		t.Fatalf("labeled: result = %+v, %v; want ignored", result, err)
+	}
+
+	body := loadPayload(t, "github", "pull_request_opened")
+	_, err = svc.HandleGitHubWebhook(ctx, "pull_request", SignPayload("wrong", body), body)
+	if err != ErrInvalidSignature {
+		t.Fatalf("bad signature: err = %v, want ErrInvalidSignature", err)
+	}
+	disabled := NewService(store, Options{})
+	if _, err := disabled.HandleGitHubWebhook(ctx, "pull_request", "", body); err != ErrIntegrationDisabled {
+		t.Fatalf("no secret: err = %v, want ErrIntegrationDisabled", err)
+	}
+}
+
+func TestGitHubWebhookDraftAndUnknownAuthor(t *testing.T) {
+	_, store := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3"}})
+	svc := NewService(store, Options{GitHubWebhookSecret: "gh-secret"})
+	deliver := func(name string) (*models.InboundResult, error) {
+		body := loadPayload(t, "github", name)
+		return svc.HandleGitHubWebhook(ctx, "pull_request", SignPayload("gh-secret", body), body)
+	}
+
+	result, err := deliver("pull_request_opened_draft")
+	if err != nil || !result.Rejected || result.PullRequest != nil {
+		t.Fatalf("unmapped author: result = %+v, %v; want rejected", result, err)
+	}
+	rejected, err := svc.ListRejectedEvents(ctx, models.ProviderGitHub, 0)
+	if err != nil || len(rejected) != 1 || rejected[0].RejectedID != result.RejectedID ||
+		rejected[0].Login != "octo-alice" {
+		t.Fatalf("rejected events = %+v, %v", rejected, err)
+	}
+
+	if _, err := svc.SetExternalAccount(ctx, &models.ExternalAccount{
+		Provider: models.ProviderGitHub, Login: "octo-alice", UserID: "u1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	result, err = deliver("pull_request_opened_draft")
+	if err != nil || !result.PullRequest.IsDraft || len(result.PullRequest.AssignedReviewers) != 0 {
+		t.Fatalf("draft opened: result = %+v, %v", result, err)
+	}
+	result, err = deliver("pull_request_ready_for_review")
+	if err != nil || result.PullRequest.IsDraft || len(result.PullRequest.AssignedReviewers) != 2 {
+		t.Fatalf("ready for review: result = %+v, %v", result, err)
+	}
+}
+
+func TestGitLabWebhookDrivesMergeRequestLifecycle(t *testing.T) {
+	_, store := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3"}})
+	svc := NewService(store, Options{GitLabWebhookToken: "gl-token"})
+	deliver := func(name string) (*models.InboundResult, error) {
+		return svc.HandleGitLabWebhook(ctx, "Merge Request Hook", "gl-token", loadPayload(t, "gitlab", name))
+	}
+
+	result, err := deliver("merge_request_open_wip")
+	if err != nil || !result.Rejected {
+		t.Fatalf("unmapped author: result = %+v, %v; want rejected", result, err)
+	}
+	rejected, err := svc.ListRejectedEvents(ctx, models.ProviderGitLab, 0)
+	if err != nil || len(rejected) != 1 || rejected[0].Login != "gl-alice" ||
+		rejected[0].PullRequestID != "acme/billing!7" {
+		t.Fatalf("rejected events = %+v, %v", rejected, err)
+	}
+
+	for login, userID := range map[string]string{"gl-alice": "u1", "gl-bob": "u2"} {
+		if _, err := svc.SetExternalAccount(ctx, &models.ExternalAccount{
+			Provider: models.ProviderGitLab, Login: login, UserID: userID,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		payload string
+		status  string
+		isDraft bool
+	}{
+		{"merge_request_open_wip", models.StatusOpen, true},
+		{"merge_request_update_ready", models.StatusOpen, false},
+		{"merge_request_close", models.StatusClosed, false},
+		{"merge_request_reopen", models.StatusOpen, false},
+		{"merge_request_merge", models.StatusMerged, false},
+	}
+	for _, step := range steps {
+		result, err := deliver(step.payload)
+		if err != nil {
+			t.Fatalf("%s: %v", step.payload, err)
+		}
+		pr := result.PullRequest
+		if pr == nil || pr.Status != step.status || pr.IsDraft != step.isDraft {
+			t.Fatalf("%s: result = %+v, want status %s, draft %v", step.payload, result, step.status, step.isDraft)
+		}
+	}
+
+	pr, err := store.GetPullRequest(ctx, "acme/billing!7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.AuthorID != "u1" || len(pr.AssignedReviewers) != 2 {
+		t.Fatalf("PR = %+v", pr)
+	}
+
+	for _, name := range []string{"merge_request_approved", "merge_request_update_ready"} {
+		if result, err := deliver(name); err != nil || !result.Ignored {
+			t.Fatalf("%s: result = %+v, %v; want ignored", name, result, err)
+		}
+	}
+	if result, err := svc.HandleGitLabWebhook(ctx, "Push Hook", "gl-token", []byte(`{}`)); err != nil || !result.Ignored {
+		t.Fatalf("push hook: result = %+v, %v; want ignored", result, err)
+	}
+
+	body := loadPayload(t, "gitlab", "merge_request_open")
+	if _, err := svc.HandleGitLabWebhook(ctx, "Merge Request Hook", "wrong", body); err != ErrInvalidSignature {
+		t.Fatalf("bad token: err = %v, want ErrInvalidSignature", err)
+	}
+	disabled := NewService(store, Options{})
+	if _, err := disabled.HandleGitLabWebhook(ctx, "Merge Request Hook", "", body); err != ErrIntegrationDisabled {
+		t.Fatalf("no token: err = %v, want ErrIntegrationDisabled", err)
+	}
+}
+
+func TestGitLabAuthorAndMergeComeFromTheMergeRequest(t *testing.T) {
+	_, store := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3"}})
+	svc := NewService(store, Options{GitLabWebhookToken: "gl-token"})
+	if _, err := svc.SetExternalAccount(ctx, &models.ExternalAccount{
+		Provider: models.ProviderGitLab, Login: "gl-alice", UserID: "u1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	policy := &models.MergePolicy{TeamName: "backend", MinApprovals: 1}
+	if err := store.SetMergePolicy(ctx, policy, 0, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+	deliver := func(action string, userID int, username string) (*models.InboundResult, error) {
+		body := fmt.Sprintf(`{"object_kind": "merge_request", "user": {"id": %d, "username": %q},
+			"project": {"path_with_namespace": "acme/billing"},
+			"object_attributes": {"iid": 9, "author_id": 4121, "title": "Draft: Bump deps", "action": %q}}`,
+			userID, username, action)
+		return svc.HandleGitLabWebhook(ctx, "Merge Request Hook", "gl-token", []byte(body))
+	}
+
+	result, err := deliver("open", 9000, "release-bot")
+	if err != nil || !result.Rejected {
+		t.Fatalf("opened by a bot: result = %+v, %v; want it rejected", result, err)
+	}
+	rejected, err := svc.ListRejectedEvents(ctx, models.ProviderGitLab, 0)
+	if err != nil || len(rejected) != 1 || rejected[0].Login != "" || rejected[0].Reason != ErrUnknownAuthor.Error() {
+		t.Fatalf("rejected events = %+v, %v; want one without an author login", rejected, err)
+	}
+
+	result, err = deliver("open", 4121, "gl-alice")
+	if err != nil || result.PullRequest == nil || result.PullRequest.AuthorID != "u1" || !result.PullRequest.IsDraft {
+		t.Fatalf("opened by the author: result = %+v, %v; want a draft authored by u1", result, err)
+	}
+
+	result, err = deliver("merge", 4200, "gl-carol")
+	if err != nil || result.PullRequest.Status != models.StatusMerged {
+		t.Fatalf("merged upstream: result = %+v, %v; want MERGED despite the draft and the policy", result, err)
+	}
+	merged, err := svc.ListEvents(ctx, models.EventFilter{Type: models.EventPRMerged})
+	if err != nil || len(merged) != 1 || merged[0].Actor != "gitlab:gl-carol" {
+		t.Fatalf("merge events = %+v, %v", merged, err)
+	}
+}
+
+func TestGitLabDraftTitles(t *testing.T) {
+	for title, want := range map[string]bool{
+		"Draft: Add invoices":  true,
+		"[Draft] Add invoices": true,
+		"(draft) Add invoices": true,
+		"WIP: Add invoices":    true,
+		"[WIP] Add invoices":   true,
+		"Add draft invoices":   false,
+		"Wipe stale invoices":  false,
+	} {
+		var event gitlabMergeRequestEvent
+		event.ObjectAttributes.Title = title
+		if got := event.isDraft(); got != want {
+			t.Errorf("isDraft(%q) = %v, want %v", title, got, want)
+		}
+	}
+}
+
+func TestAPITokensAuthenticateAndRevoke(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+
+	if _, err := svc.IssueAPIToken(ctx, "ci", "", []string{"superuser"}); err != ErrInvalidToken {
+		t.Fatalf("unknown scope: err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := svc.IssueAPIToken(ctx, " ", "", []string{models.ScopeRead}); err != ErrInvalidToken {
+		t.Fatalf("empty name: err = %v, want ErrInvalidToken", err)
+	}
+
+	issued, err := svc.IssueAPIToken(ctx, "ci", "", []string{models.ScopeWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := svc.Authenticate(ctx, issued.Token)
+	if err != nil || token.TokenID != issued.TokenID {
+		t.Fatalf("Authenticate = %+v, %v", token, err)
+	}
+	if !token.HasScope(models.ScopeRead) || !token.HasScope(models.ScopeWrite) || token.HasScope(models.ScopeAdmin) {
+		t.Fatalf("write token scopes = %v; want read and write but not admin", token.Scopes)
+	}
+	if _, err := svc.Authenticate(ctx, issued.Token+"x"); err != ErrUnauthenticated {
+		t.Fatalf("wrong secret: err = %v, want ErrUnauthenticated", err)
+	}
+
+	if err := svc.RevokeAPIToken(ctx, issued.TokenID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Authenticate(ctx, issued.Token); err != ErrUnauthenticated {
+		t.Fatalf("revoked: err = %v, want ErrUnauthenticated", err)
+	}
+	if err := svc.RevokeAPIToken(ctx, issued.TokenID); err != ErrTokenNotFound {
+		t.Fatalf("revoke twice: err = %v, want ErrTokenNotFound", err)
+	}
+}
+
+func TestRolesRestrictTeamChangesToLeads(t *testing.T) {
+	svc, _ := newTestService(t, map[string][]string{"backend": {"lead", "u1", "u2", "u3"}, "qa": {"q1"}})
+	if _, err := svc.SetUserRole(ctx, admin, "lead", models.RoleLead, 0); err != nil {
+		t.Fatal(err)
+	}
+	lead := models.Caller{UserID: "lead"}
+	member := models.Caller{UserID: "u1"}
+
+	if _, err := svc.SetUserRole(ctx, member, "u2", models.RoleLead, 0); err != ErrForbidden {
+		t.Fatalf("member promotes: err = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.SetUserRole(ctx, lead, "u2", "owner", 0); err != ErrInvalidRole {
+		t.Fatalf("unknown role: err = %v, want ErrInvalidRole", err)
+	}
+	if _, err := svc.SetUserActive(ctx, member, "u2", false, 0); err != ErrForbidden {
+		t.Fatalf("member deactivates a teammate: err = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.SetUserMaxOpenReviews(ctx, member, "u2", 0, 0); err != ErrForbidden {
+		t.Fatalf("member sets a teammate's limit: err = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.SetUserMaxOpenReviews(ctx, member, "u1", 3, 0); err != nil {
+		t.Fatalf("member sets own limit: %v", err)
+	}
+	if _, err := svc.SetUserActive(ctx, lead, "u2", true, 0); err != nil {
+		t.Fatalf("lead activates a member: %v", err)
+	}
+
+	created, _, err := svc.CreatePullRequest(ctx, "pr-1", "One", "u3", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reviewer := created.AssignedReviewers[0]
+	other := models.Caller{UserID: "q1"}
+	if _, _, err := svc.ReassignReviewer(ctx, other, "pr-1", reviewer, 0); err != ErrForbidden {
+		t.Fatalf("outsider reassigns: err = %v, want ErrForbidden", err)
+	}
+	if _, _, err := svc.ReassignReviewer(ctx, models.Caller{UserID: reviewer}, "pr-1", reviewer, 0); err != nil {
+		t.Fatalf("reviewer reassigns self: %v", err)
+	}
+
+	moved := &models.Team{
+		TeamName: "platform",
+		Members:  []models.TeamMember{{UserID: "u3", Username: "u3", IsActive: true}},
+	}
+	if err := svc.CreateTeam(ctx, member, moved); err != ErrForbidden {
+		t.Fatalf("member moves u3: err = %v, want ErrForbidden", err)
+	}
+	if err := svc.CreateTeam(ctx, lead, moved); err != nil {
+		t.Fatalf("lead moves u3: %v", err)
+	}
+
+	if _, err := svc.BulkDeactivateTeamUsers(ctx, member, "backend", 0); err != ErrForbidden {
+		t.Fatalf("member bulk-deactivates: err = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.BulkDeactivateTeamUsers(ctx, lead, "qa", 0); err != ErrForbidden {
+		t.Fatalf("lead of another team bulk-deactivates: err = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.BulkDeactivateTeamUsers(ctx, lead, "backend", 0); err != nil {
+		t.Fatalf("lead bulk-deactivates: %v", err)
+	}
+}
+
+func TestAbsencesNeedTheUserTheirLeadOrAnAdmin(t *testing.T) {
+	svc, store := newTestService(t, map[string][]string{"backend": {"lead", "u1", "u2"}})
+	if err := store.SetUserRole(ctx, "lead", models.RoleLead, 0, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+	err := store.CreatePullRequest(ctx, "pr-1", "Feature", "lead", false, 1, []string{"u2"}, models.Audit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	absence := func(userID string) *models.Absence {
+		return &models.Absence{
+			UserID: userID, StartsAt: time.Now().Add(-time.Minute), EndsAt: time.Now().Add(time.Hour), AutoReassign: true,
+		}
+	}
+
+	if _, err := svc.CreateAbsence(ctx, models.Caller{UserID: "u1"}, absence("u2")); err != ErrForbidden {
+		t.Fatalf("teammate registers an absence: err = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.CreateAbsence(ctx, models.Caller{UserID: "lead"}, absence("u2")); err != nil {
+		t.Fatalf("lead registers an absence: %v", err)
+	}
+	events, err := svc.ListEvents(ctx, models.EventFilter{Type: models.EventReviewerUnassigned})
+	if err != nil || len(events) != 1 || events[0].Actor != "lead" || events[0].Reason != models.ReasonAbsence {
+		t.Fatalf("reassignment events = %+v, %v; want one by the lead for the absence", events, err)
+	}
+	own, err := svc.CreateAbsence(ctx, models.Caller{UserID: "u1"}, absence("u1"))
+	if err != nil {
+		t.Fatalf("own absence: %v", err)
+	}
+
+	if _, err := svc.CancelAbsence(ctx, models.Caller{UserID: "u2"}, own.AbsenceID); err != ErrForbidden {
+		t.Fatalf("teammate cancels an absence: err = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.CancelAbsence(ctx, admin, own.AbsenceID); err != nil {
+		t.Fatalf("admin cancels an absence: %v", err)
+	}
+}
+
+func TestReopenReplacesAbsentReviewers(t *testing.T) {
+	svc, store := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3", "u4"}})
+	err := store.CreatePullRequest(ctx, "pr-1", "Feature", "u1", false, 2, []string{"u2", "u3"}, models.Audit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ClosePullRequest(ctx, admin, "pr-1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateAbsence(ctx, &models.Absence{
+		UserID: "u2", StartsAt: time.Now().Add(-time.Minute), EndsAt: time.Now().Add(time.Hour),
+	}, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := svc.ReopenPullRequest(ctx, admin, "pr-1", 0)
+	if err != nil {
+		t.Fatalf("ReopenPullRequest: %v", err)
+	}
+	if len(pr.AssignedReviewers) != 2 || pr.AssignedReviewers[0] != "u3" || pr.AssignedReviewers[1] != "u4" {
+		t.Fatalf("reviewers = %v, want [u3 u4]", pr.AssignedReviewers)
+	}
+}
+
+// unmarkableStore fails to mark the absence failID as reassigned.
+type unmarkableStore struct {
+	*database.MemoryStore
+	failID int64
+}
+
+func (s *unmarkableStore) MarkAbsenceReassigned(ctx context.Context, absenceID int64) error {
+	if absenceID == s.failID {
+		return errors.New("mark failed")
+	}
+	return s.MemoryStore.MarkAbsenceReassigned(ctx, absenceID)
+}
+
+func TestAbsenceReassignmentFailuresDoNotBlockOthers(t *testing.T) {
+	_, memory := newTestService(t, map[string][]string{"backend": {"u1", "u2", "u3", "u4"}})
+	store := &unmarkableStore{MemoryStore: memory, failID: 1}
+	svc := NewService(store, Options{})
+	started := func(userID string) *models.Absence {
+		return &models.Absence{
+			UserID: userID, StartsAt: time.Now().Add(-time.Minute), EndsAt: time.Now().Add(time.Hour), AutoReassign: true,
+		}
+	}
+
+	created, err := svc.CreateAbsence(ctx, admin, started("u2"))
+	if err != nil || created.AbsenceID != 1 || created.ReassignedAt != nil {
+		t.Fatalf("CreateAbsence = %+v, %v; want the stored absence left for the worker", created, err)
+	}
+	later := started("u3")
+	if err := store.CreateAbsence(ctx, later, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = svc.ProcessStartedAbsences(ctx)
+	if err == nil || !strings.Contains(err.Error(), "absence 1: mark failed") {
+		t.Fatalf("ProcessStartedAbsences: err = %v, want the failure of absence 1", err)
+	}
+	if got, err := store.GetAbsence(ctx, later.AbsenceID); err != nil || got.ReassignedAt == nil {
+		t.Fatalf("later absence = %+v, %v; want it processed despite the earlier failure", got, err)
+	}
+}
+
+func TestCreateTeamKeepsTheRoleOfExistingMembers(t *testing.T) {
+	svc, _ := newTestService(t, map[string][]string{"backend": {"lead", "u1"}})
+	if _, err := svc.SetUserRole(ctx, admin, "lead", models.RoleLead, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	team := &models.Team{TeamName: "platform", Members: []models.TeamMember{
+		{UserID: "lead", Username: "lead", IsActive: true},
+		{UserID: "p1", Username: "p1", IsActive: true},
+	}}
+	if err := svc.CreateTeam(ctx, admin, team); err != nil {
+		t.Fatal(err)
+	}
+	if team.Members[0].Role != models.RoleLead || team.Members[1].Role != models.RoleMember {
+		t.Fatalf("members = %+v, want the lead kept and a new member", team.Members)
+	}
+	if user, err := svc.GetUser(ctx, "lead"); err != nil || user.Role != models.RoleLead {
+		t.Fatalf("GetUser(lead) = %+v, %v; want still lead", user, err)
+	}
+}
+
+func TestMetricsCountReassignmentsAndWorkload(t *testing.T) {
+	store := database.NewMemoryStore()
+	if err := store.CreateTeam(ctx, &models.Team{TeamName: "backend", Members: []models.TeamMember{
+		{UserID: "u1", Username: "u1", IsActive: true},
+		{UserID: "u2", Username: "u2", IsActive: true},
+		{UserID: "u3", Username: "u3", IsActive: true},
+	}}, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+	registry := metrics.NewRegistry()
+	svc := NewService(store, Options{Metrics: registry})
+
+	if _, _, err := svc.CreatePullRequest(ctx, "pr-1", "One", "u1", false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.ReassignReviewer(ctx, admin, "pr-1", "u2", 0); err != ErrNoCandidate {
+		t.Fatalf("err = %v, want ErrNoCandidate", err)
+	}
+	if _, err := svc.SetUserActive(ctx, admin, "u3", false, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := registry.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"pr_review_no_candidate_total 1",
+		"pr_review_open_prs 1",
+		"pr_review_active_users 2",
+		`pr_review_open_reviews{user_id="u2"} 1`,
+		`pr_review_open_reviews{user_id="u3"} 1`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("metrics output lacks %q:\n%s", line, buf.String())
+		}
+	}
+
+	if err := store.CreateTeam(ctx, &models.Team{
+		TeamName: "backend",
+		Members:  []models.TeamMember{{UserID: "u4", Username: "u4", IsActive: true}},
+	}, models.Audit{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.ReassignReviewer(ctx, admin, "pr-1", "u2", 0); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := registry.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `pr_review_reassignments_total{reason="reassign"} 1`+"\n") {
+		t.Errorf("metrics output lacks the reassignment:\n%s", buf.String())
+	}
+}
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (e *recordingExporter) Export(_ context.Context, spans []tracing.SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestTracingFollowsServiceCallsAndWebhooks(t *testing.T) {
+	var traceparent string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get(tracing.TraceparentHeader)
+	}))
+	defer receiver.Close()
+
+	exporter := &recordingExporter{}
+	tracer := tracing.NewTracer(exporter)
+	svc, _ := newTestService(t, map[string][]string{"backend": {"u1", "u2"}})
+	if _, err := svc.CreateWebhook(ctx, &models.Webhook{
+		URL: receiver.URL, Secret: "secret", EventTypes: []string{models.EventReviewerAssigned},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	traced, root := tracer.Start(ctx, "test", tracing.KindServer)
+	if _, _, err := svc.CreatePullRequest(traced, "pr-1", "Feature", "u1", false, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.DeliverPendingWebhooks(traced); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+	if err := tracer.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	byName := make(map[string]tracing.SpanData)
+	for _, span := range exporter.spans {
+		if span.TraceID != root.Context().TraceID {
+			t.Fatalf("span %s left the trace", span.Name)
+		}
+		byName[span.Name] = span
+	}
+	if byName["service.CreatePullRequest"].ParentSpanID != root.Context().SpanID {
+		t.Fatalf("service.CreatePullRequest is not a child of the caller: %+v", exporter.spans)
+	}
+	deliver := byName["webhook.deliver"]
+	if deliver.Kind != tracing.KindClient || deliver.ParentSpanID != byName["service.DeliverPendingWebhooks"].SpanID {
+		t.Fatalf("webhook.deliver = %+v", deliver)
+	}
+	want := tracing.SpanContext{TraceID: deliver.TraceID, SpanID: deliver.SpanID, Sampled: true}
+	if traceparent != want.Traceparent() {
+		t.Fatalf("traceparent = %q, want %q", traceparent, want.Traceparent())
+	}
+}
@@ -1,32 +1,51 @@
 package service
 
-import "pr-review-service/internal/models"
+import (
+	"context"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
+)
 
-func (s *Service) GetStats() (*models.StatsResponse, error) {
-	usersStats, err := s.db.GetUserStats()
+func (s *Service) GetStats(ctx context.Context) (*models.StatsResponse, error) {
+	ctx, span := tracing.Start(ctx, "service.GetStats")
+	defer span.End()
+
+	usersStats, err := s.db.GetUserStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prsStats, err := s.db.GetPRStats(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	draftStats, err := s.db.GetPRStats(ctx, true)
 	if err != nil {
 		return nil, err
 	}
 
-	prsStats, err := s.db.GetPRStats()
+	totalUsers, err := s.db.GetTotalUsersCount(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	totalUsers, err := s.db.GetTotalUsersCount()
+	totalPRs, err := s.db.GetTotalPRsCount(ctx, false)
 	if err != nil {
 		return nil, err
 	}
 
-	totalPRs, err := s.db.GetTotalPRsCount()
+	totalDrafts, err := s.db.GetTotalPRsCount(ctx, true)
 	if err != nil {
 		return nil, err
 	}
 
 	return &models.StatsResponse{
-		UsersStats: usersStats,
-		PRsStats:   prsStats,
-		TotalUsers: totalUsers,
-		TotalPRs:   totalPRs,
+		UsersStats:    usersStats,
+		PRsStats:      prsStats,
+		DraftPRsStats: draftStats,
+		TotalUsers:    totalUsers,
+		TotalPRs:      totalPRs,
+		TotalDrafts:   totalDrafts,
 	}, nil
 }
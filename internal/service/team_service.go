@@ -1,17 +1,69 @@
 package service
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
+	"sort"
 )
 
 var (
 	ErrTeamExists   = errors.New("team already exists")
 	ErrTeamNotFound = errors.New("team not found")
+	ErrInvalidRole  = errors.New("invalid role")
+	ErrForbidden    = errors.New("operation not permitted for caller")
+	ErrUnboundToken = errors.New("token is not bound to a user")
 )
 
-func (s *Service) CreateTeam(team *models.Team) error {
-	exists, err := s.db.TeamExists(team.TeamName)
+// authorizeTeamLead allows admins and active leads of teamName.
+func (s *Service) authorizeTeamLead(ctx context.Context, caller models.Caller, teamName string) error {
+	if caller.Admin {
+		return nil
+	}
+	if caller.UserID == "" {
+		return ErrForbidden
+	}
+
+	user, err := s.db.GetUser(ctx, caller.UserID)
+	if err != nil || user.TeamName != teamName || user.Role != models.RoleLead || !user.IsActive {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// authorizeUserChange lets a user change their own settings; anyone else
+// needs to lead the user's team or be an admin.
+func (s *Service) authorizeUserChange(ctx context.Context, caller models.Caller, user *models.User) error {
+	if caller.UserID != "" && caller.UserID == user.UserID {
+		return nil
+	}
+	return s.authorizeTeamLead(ctx, caller, user.TeamName)
+}
+
+// actingUser is the user caller acts as when a request names userID: the
+// caller's own user when userID is empty or matches it. Only admins may name
+// someone else; a non-admin token without a user has no one to act as.
+func actingUser(caller models.Caller, userID string) (string, error) {
+	switch {
+	case userID == "" || userID == caller.UserID:
+		return caller.UserID, nil
+	case caller.Admin:
+		return userID, nil
+	case caller.UserID == "":
+		return "", ErrUnboundToken
+	}
+	return "", ErrForbidden
+}
+
+// CreateTeam creates a team. Moving an existing user into it changes the
+// membership of their current team, which only that team's lead may do.
+func (s *Service) CreateTeam(ctx context.Context, caller models.Caller, team *models.Team) error {
+	ctx, span := tracing.Start(ctx, "service.CreateTeam")
+	defer span.End()
+
+	exists, err := s.db.TeamExists(ctx, team.TeamName)
 	if err != nil {
 		return err
 	}
@@ -19,22 +71,129 @@ func (s *Service) CreateTeam(team *models.Team) error {
 		return ErrTeamExists
 	}
 
-	return s.db.CreateTeam(team)
+	if team.ReviewerStrategy != "" && !models.ValidStrategy(team.ReviewerStrategy) {
+		return ErrInvalidStrategy
+	}
+	if team.DefaultReviewers < 0 || team.DefaultReviewers > models.MaxReviewersPerPR {
+		return ErrInvalidReviewersCount
+	}
+	if team.CapacityFallback != "" && !ValidCapacityFallback(team.CapacityFallback) {
+		return ErrInvalidCapacityFallback
+	}
+
+	// A member listed without a role keeps the one they have; only new users
+	// default to member.
+	for i, member := range team.Members {
+		if member.Role != "" && !models.ValidRole(member.Role) {
+			return ErrInvalidRole
+		}
+
+		existing, err := s.db.GetUser(ctx, member.UserID)
+		if err == sql.ErrNoRows {
+			if member.Role == "" {
+				team.Members[i].Role = models.RoleMember
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.authorizeTeamLead(ctx, caller, existing.TeamName); err != nil {
+			return err
+		}
+		if member.Role == "" {
+			team.Members[i].Role = existing.Role
+		}
+	}
+
+	return s.db.CreateTeam(ctx, team, models.Audit{Actor: caller.Actor()})
 }
 
-func (s *Service) GetTeam(teamName string) (*models.Team, error) {
-	team, err := s.db.GetTeam(teamName)
+func (s *Service) GetTeam(ctx context.Context, teamName string) (*models.Team, error) {
+	ctx, span := tracing.Start(ctx, "service.GetTeam")
+	defer span.End()
+
+	team, err := s.db.GetTeam(ctx, teamName)
 	if err != nil {
-		return nil, ErrTeamNotFound
+		return nil, notFound(err, ErrTeamNotFound)
 	}
 	return team, nil
 }
 
-func (s *Service) BulkDeactivateTeamUsers(teamName string) (*models.BulkDeactivateResponse, error) {
-	deactivatedUserIDs, err := s.db.BulkDeactivateTeamUsers(teamName)
+func (s *Service) SetTeamReviewerStrategy(
+	ctx context.Context, caller models.Caller, teamName, strategy string, version int64,
+) (*models.Team, error) {
+	ctx, span := tracing.Start(ctx, "service.SetTeamReviewerStrategy")
+	defer span.End()
+
+	if strategy != "" && !models.ValidStrategy(strategy) {
+		return nil, ErrInvalidStrategy
+	}
+
+	exists, err := s.db.TeamExists(ctx, teamName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrTeamNotFound
+	}
+
+	audit := models.Audit{Actor: caller.Actor()}
+	if err := s.db.SetTeamReviewerStrategy(ctx, teamName, strategy, version, audit); err != nil {
+		return nil, versionError(err, version)
+	}
+
+	return s.GetTeam(ctx, teamName)
+}
+
+func (s *Service) SetTeamDefaultReviewers(
+	ctx context.Context, caller models.Caller, teamName string, count int, version int64,
+) (*models.Team, error) {
+	ctx, span := tracing.Start(ctx, "service.SetTeamDefaultReviewers")
+	defer span.End()
+
+	if count < 0 || count > models.MaxReviewersPerPR {
+		return nil, ErrInvalidReviewersCount
+	}
+
+	exists, err := s.db.TeamExists(ctx, teamName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrTeamNotFound
+	}
+
+	audit := models.Audit{Actor: caller.Actor()}
+	if err := s.db.SetTeamDefaultReviewers(ctx, teamName, count, version, audit); err != nil {
+		return nil, versionError(err, version)
+	}
+
+	return s.GetTeam(ctx, teamName)
+}
+
+func (s *Service) BulkDeactivateTeamUsers(
+	ctx context.Context, caller models.Caller, teamName string, version int64,
+) (*models.BulkDeactivateResponse, error) {
+	ctx, span := tracing.Start(ctx, "service.BulkDeactivateTeamUsers")
+	defer span.End()
+
+	exists, err := s.db.TeamExists(ctx, teamName)
 	if err != nil {
 		return nil, err
 	}
+	if !exists {
+		return nil, ErrTeamNotFound
+	}
+	if err := s.authorizeTeamLead(ctx, caller, teamName); err != nil {
+		return nil, err
+	}
+
+	audit := models.Audit{Actor: caller.Actor(), Reason: models.ReasonDeactivation}
+	deactivatedUserIDs, err := s.db.BulkDeactivateTeamUsers(ctx, teamName, version, audit)
+	if err != nil {
+		return nil, versionError(err, version)
+	}
 
 	if len(deactivatedUserIDs) == 0 {
 		return &models.BulkDeactivateResponse{
@@ -46,51 +205,108 @@ func (s *Service) BulkDeactivateTeamUsers(teamName string) (*models.BulkDeactiva
 		}, nil
 	}
 
-	userTeams, err := s.db.GetTeamNameForUsers(deactivatedUserIDs)
+	reassignedPRs, err := s.reassignUnavailable(ctx, deactivatedUserIDs, teamName, audit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.BulkDeactivateResponse{
+		TeamName:         teamName,
+		DeactivatedUsers: deactivatedUserIDs,
+		ReassignedPRs:    reassignedPRs,
+		DeactivatedCount: len(deactivatedUserIDs),
+		ReassignedCount:  len(reassignedPRs),
+	}, nil
+}
+
+// reassignAttempts bounds how often reassignUnavailable plans again for PRs
+// that changed between planning and applying the plan.
+const reassignAttempts = 3
+
+// reassignUnavailable replaces unavailable users on the OPEN PRs they review
+// and returns the PRs it changed. A PR modified concurrently is skipped by the
+// store and planned again from its new state; one merged or closed meanwhile
+// drops out of the next plan.
+func (s *Service) reassignUnavailable(
+	ctx context.Context, unavailableIDs []string, fallbackTeam string, audit models.Audit,
+) ([]string, error) {
+	reassignedPRs := []string{}
+	for attempt := 0; attempt < reassignAttempts; attempt++ {
+		plans, err := s.planReassignments(ctx, unavailableIDs, fallbackTeam)
+		if err != nil {
+			return nil, err
+		}
+		if len(plans) == 0 {
+			break
+		}
+
+		applied, err := s.db.BulkReassignReviewers(ctx, plans, audit)
+		if err != nil {
+			return nil, err
+		}
+		s.countReassignments(audit.Reason, plans, applied)
+		reassignedPRs = append(reassignedPRs, applied...)
+		if len(applied) == len(plans) {
+			break
+		}
+	}
+	sort.Strings(reassignedPRs)
+	return reassignedPRs, nil
+}
+
+// planReassignments picks a replacement for every unavailable user on each
+// OPEN PR they review. Candidates come from the reviewer's own team, falling
+// back to the author's team; reviewers without any candidate, or whose
+// candidates are all at capacity, are left as is, and PRs where nobody can
+// be replaced get no plan.
+func (s *Service) planReassignments(
+	ctx context.Context, unavailableIDs []string, fallbackTeam string,
+) (map[string]models.ReviewerPlan, error) {
+	userTeams, err := s.db.GetTeamNameForUsers(ctx, unavailableIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	prReviewers, prAuthors, err := s.db.GetOpenPRsWithReviewers(deactivatedUserIDs)
+	prs, err := s.db.GetOpenPRsWithReviewers(ctx, unavailableIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	reassignments := make(map[string]map[string]string)
+	unavailable := make(map[string]bool, len(unavailableIDs))
+	for _, userID := range unavailableIDs {
+		unavailable[userID] = true
+	}
 
-	for prID, reviewers := range prReviewers {
-		authorID := prAuthors[prID]
-		reassignments[prID] = make(map[string]string)
+	plans := make(map[string]models.ReviewerPlan)
+	loader := newPendingLoader(s.db)
 
-		for _, reviewerID := range reviewers {
-			isDeactivated := false
-			for _, deactivatedID := range deactivatedUserIDs {
-				if reviewerID == deactivatedID {
-					isDeactivated = true
-					break
-				}
-			}
+	for _, pr := range prs {
+		authorID := pr.AuthorID
+		replacements := make(map[string]string)
+		taken := append([]string{authorID}, pr.AssignedReviewers...)
 
-			if !isDeactivated {
+		for _, reviewerID := range pr.AssignedReviewers {
+			if !unavailable[reviewerID] {
 				continue
 			}
 
 			reviewerTeam, ok := userTeams[reviewerID]
 			if !ok {
-				reviewerTeam = teamName
+				reviewerTeam = fallbackTeam
 			}
+			candidateTeam := reviewerTeam
 
-			excludeList := append([]string{reviewerID, authorID}, deactivatedUserIDs...)
-			candidates, err := s.db.GetActiveTeamMembersForReplacement(reviewerTeam, excludeList)
+			excludeList := append(append([]string{}, taken...), unavailableIDs...)
+			candidates, err := s.db.GetActiveTeamMembersForReplacement(ctx, reviewerTeam, excludeList)
 			if err != nil {
 				return nil, err
 			}
 
 			if len(candidates) == 0 {
-				authorTeam, err := s.getAuthorTeam(authorID)
+				authorTeam, err := s.getAuthorTeam(ctx, authorID)
 				if err == nil {
-					excludeList = append([]string{reviewerID, authorID}, deactivatedUserIDs...)
-					candidates, err = s.db.GetActiveTeamMembersForReplacement(authorTeam, excludeList)
+					candidateTeam = authorTeam
+					candidates, err = s.db.GetActiveTeamMembersForReplacement(ctx, authorTeam, excludeList)
 					if err != nil {
 						return nil, err
 					}
@@ -98,28 +314,30 @@ func (s *Service) BulkDeactivateTeamUsers(teamName string) (*models.BulkDeactiva
 			}
 
 			if len(candidates) > 0 {
-				newReviewerID := selectRandomReviewers(candidates, 1)[0]
-				reassignments[prID][reviewerID] = newReviewerID
+				selected, err := s.chooseReviewers(ctx, candidateTeam, candidates, 1, loader)
+				if err == ErrAllAtCapacity {
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				newReviewerID := selected[0]
+				loader.assign(newReviewerID)
+				replacements[reviewerID] = newReviewerID
+				taken = append(taken, newReviewerID)
 			}
 		}
-	}
 
-	reassignedPRs, err := s.db.BulkReassignReviewers(reassignments)
-	if err != nil {
-		return nil, err
+		if len(replacements) > 0 {
+			plans[pr.PullRequestID] = models.ReviewerPlan{Version: pr.Version, Replacements: replacements}
+		}
 	}
 
-	return &models.BulkDeactivateResponse{
-		TeamName:         teamName,
-		DeactivatedUsers: deactivatedUserIDs,
-		ReassignedPRs:    reassignedPRs,
-		DeactivatedCount: len(deactivatedUserIDs),
-		ReassignedCount:  len(reassignedPRs),
-	}, nil
+	return plans, nil
 }
 
-func (s *Service) getAuthorTeam(authorID string) (string, error) {
-	user, err := s.db.GetUser(authorID)
+func (s *Service) getAuthorTeam(ctx context.Context, authorID string) (string, error) {
+	user, err := s.db.GetUser(ctx, authorID)
 	if err != nil {
 		return "", err
 	}
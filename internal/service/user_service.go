@@ -1,41 +1,89 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
 )
 
 var (
 	ErrUserNotFound = errors.New("user not found")
 )
 
-func (s *Service) SetUserActive(userID string, isActive bool) (*models.User, error) {
-	user, err := s.db.GetUser(userID)
+// SetUserActive activates or deactivates a user; like BulkDeactivateTeamUsers
+// it is reserved to the team's lead or an admin.
+func (s *Service) SetUserActive(
+	ctx context.Context, caller models.Caller, userID string, isActive bool, version int64,
+) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "service.SetUserActive")
+	defer span.End()
+
+	user, err := s.db.GetUser(ctx, userID)
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	if err := s.authorizeTeamLead(ctx, caller, user.TeamName); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.SetUserActive(ctx, userID, isActive, version, models.Audit{Actor: caller.Actor()}); err != nil {
+		return nil, versionError(err, version)
 	}
 
-	if err := s.db.SetUserActive(userID, isActive); err != nil {
+	return s.db.GetUser(ctx, userID)
+}
+
+// SetUserRole changes a user's role within their team; only the team's lead
+// or an admin may do it.
+func (s *Service) SetUserRole(
+	ctx context.Context, caller models.Caller, userID, role string, version int64,
+) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "service.SetUserRole")
+	defer span.End()
+
+	if !models.ValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	user, err := s.db.GetUser(ctx, userID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	if err := s.authorizeTeamLead(ctx, caller, user.TeamName); err != nil {
 		return nil, err
 	}
 
-	user.IsActive = isActive
-	return user, nil
+	if err := s.db.SetUserRole(ctx, userID, role, version, models.Audit{Actor: caller.Actor()}); err != nil {
+		return nil, versionError(err, version)
+	}
+
+	return s.db.GetUser(ctx, userID)
 }
 
-func (s *Service) GetUser(userID string) (*models.User, error) {
-	user, err := s.db.GetUser(userID)
+func (s *Service) GetUser(ctx context.Context, userID string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "service.GetUser")
+	defer span.End()
+
+	user, err := s.db.GetUser(ctx, userID)
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, notFound(err, ErrUserNotFound)
 	}
 	return user, nil
 }
 
-func (s *Service) GetUserPullRequests(userID string) ([]models.PullRequestShort, error) {
-	_, err := s.db.GetUser(userID)
+// GetUserPullRequests lists PRs the user reviews; with awaitingOnly set it keeps
+// only OPEN PRs where the user has not yet approved or requested changes.
+func (s *Service) GetUserPullRequests(
+	ctx context.Context, userID string, awaitingOnly bool,
+) ([]models.PullRequestShort, error) {
+	ctx, span := tracing.Start(ctx, "service.GetUserPullRequests")
+	defer span.End()
+
+	_, err := s.db.GetUser(ctx, userID)
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, notFound(err, ErrUserNotFound)
 	}
 
-	return s.db.GetUserPullRequests(userID)
+	return s.db.GetUserPullRequests(ctx, userID, awaitingOnly)
 }
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"errors"
+	"pr-review-service/internal/database"
+)
+
+var (
+	ErrVersionMismatch  = errors.New("resource version does not match")
+	ErrConcurrentUpdate = errors.New("resource was modified concurrently")
+)
+
+// checkVersion enforces a client precondition; expected 0 means none was given.
+func checkVersion(current, expected int64) error {
+	if expected != 0 && current != expected {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// versionError reports a write that lost to a concurrent one: a client that
+// sent a version gets ErrVersionMismatch, others ErrConcurrentUpdate.
+func versionError(err error, expected int64) error {
+	if !errors.Is(err, database.ErrVersionConflict) {
+		return err
+	}
+	if expected != 0 {
+		return ErrVersionMismatch
+	}
+	return ErrConcurrentUpdate
+}
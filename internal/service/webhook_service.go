@@ -0,0 +1,295 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"pr-review-service/internal/models"
+	"pr-review-service/internal/tracing"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultWebhookMaxAttempts = 8
+	DefaultWebhookBackoff     = 30 * time.Second
+	DefaultWebhookTimeout     = 10 * time.Second
+
+	maxWebhookBackoff = time.Hour
+	webhookBatchSize  = 10
+	maxWebhookError   = 500
+
+	// SignatureHeader carries "sha256=" followed by the hex HMAC-SHA256 of the
+	// request body keyed with the webhook secret.
+	SignatureHeader = "X-Signature-256"
+)
+
+// WebhookEventTypes are the event types a webhook can subscribe to. A
+// reassignment is delivered as REVIEWER_UNASSIGNED followed by
+// REVIEWER_ASSIGNED, both with reason "reassign".
+var WebhookEventTypes = []string{
+	models.EventPRCreated,
+	models.EventReviewerAssigned,
+	models.EventReviewerUnassigned,
+	models.EventPRMerged,
+	models.EventUserDeactivated,
+}
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrInvalidWebhook   = errors.New("invalid webhook")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrDeliveryNotDead  = errors.New("webhook delivery is not dead")
+
+	ErrInvalidDeliveryFilter = errors.New("invalid webhook delivery filter")
+)
+
+// WebhookPayload is the JSON body POSTed to subscribers.
+type WebhookPayload struct {
+	DeliveryID int64        `json:"delivery_id"`
+	Event      models.Event `json:"event"`
+}
+
+// SignPayload returns the SignatureHeader value for body.
+func SignPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Service) CreateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	ctx, span := tracing.Start(ctx, "service.CreateWebhook")
+	defer span.End()
+
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrInvalidWebhook
+	}
+	if webhook.Secret == "" || len(webhook.EventTypes) == 0 {
+		return nil, ErrInvalidWebhook
+	}
+	for _, eventType := range webhook.EventTypes {
+		if !validWebhookEventType(eventType) {
+			return nil, ErrInvalidWebhook
+		}
+	}
+
+	if err := s.db.CreateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func validWebhookEventType(eventType string) bool {
+	for _, known := range WebhookEventTypes {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, span := tracing.Start(ctx, "service.ListWebhooks")
+	defer span.End()
+
+	return s.db.ListWebhooks(ctx)
+}
+
+func (s *Service) DeleteWebhook(ctx context.Context, webhookID int64) error {
+	ctx, span := tracing.Start(ctx, "service.DeleteWebhook")
+	defer span.End()
+
+	err := s.db.DeleteWebhook(ctx, webhookID)
+	if err == sql.ErrNoRows {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+// ListWebhookDeliveries returns the delivery log, newest first.
+func (s *Service) ListWebhookDeliveries(
+	ctx context.Context, filter models.WebhookDeliveryFilter,
+) ([]models.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "service.ListWebhookDeliveries")
+	defer span.End()
+
+	switch filter.Status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		return nil, ErrInvalidDeliveryFilter
+	}
+	if filter.Limit < 0 || filter.Limit > MaxEventsLimit {
+		return nil, ErrInvalidDeliveryFilter
+	}
+	if filter.Limit == 0 {
+		filter.Limit = DefaultEventsLimit
+	}
+
+	if filter.WebhookID != 0 {
+		if _, err := s.db.GetWebhook(ctx, filter.WebhookID); err != nil {
+			return nil, notFound(err, ErrWebhookNotFound)
+		}
+	}
+
+	return s.db.ListWebhookDeliveries(ctx, filter)
+}
+
+// RetryWebhookDelivery requeues a dead-lettered delivery.
+func (s *Service) RetryWebhookDelivery(ctx context.Context, deliveryID int64) (*models.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "service.RetryWebhookDelivery")
+	defer span.End()
+
+	if _, err := s.db.GetWebhookDelivery(ctx, deliveryID); err != nil {
+		return nil, notFound(err, ErrDeliveryNotFound)
+	}
+
+	if err := s.db.RetryWebhookDelivery(ctx, deliveryID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrDeliveryNotDead
+		}
+		return nil, err
+	}
+
+	return s.db.GetWebhookDelivery(ctx, deliveryID)
+}
+
+// DeliverPendingWebhooks sends one batch of due deliveries and returns how
+// many were attempted. Failed deliveries are retried with exponential backoff
+// until the attempt limit, after which they stay DEAD until retried by hand.
+func (s *Service) DeliverPendingWebhooks(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "service.DeliverPendingWebhooks")
+	defer span.End()
+
+	// The lease outlives sending the whole batch, so no other worker picks a
+	// delivery up while it is in flight.
+	lease := time.Duration(webhookBatchSize)*s.webhookClient.Timeout + time.Minute
+	dispatches, err := s.db.ClaimWebhookDeliveries(ctx, webhookBatchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range dispatches {
+		attempt := s.sendWebhook(ctx, &dispatches[i])
+		if err := s.db.RecordWebhookAttempt(ctx, dispatches[i].Delivery.DeliveryID, attempt); err != nil {
+			return i, err
+		}
+	}
+
+	return len(dispatches), nil
+}
+
+func (s *Service) sendWebhook(ctx context.Context, dispatch *models.WebhookDispatch) models.WebhookAttempt {
+	ctx, span := tracing.StartKind(ctx, "webhook.deliver", tracing.KindClient)
+	defer span.End()
+	span.SetAttr("webhook.delivery_id", dispatch.Delivery.DeliveryID)
+
+	attempt := models.WebhookAttempt{Status: models.DeliveryDelivered}
+
+	statusCode, err := s.postWebhook(ctx, dispatch)
+	attempt.StatusCode = statusCode
+	span.SetAttr("http.status_code", statusCode)
+	span.SetError(err)
+	if err == nil {
+		return attempt
+	}
+
+	attempt.Error = err.Error()
+	if len(attempt.Error) > maxWebhookError {
+		attempt.Error = attempt.Error[:maxWebhookError]
+	}
+
+	attempts := dispatch.Delivery.Attempts + 1
+	s.logger.Warn("webhook attempt failed", "delivery_id", dispatch.Delivery.DeliveryID,
+		"webhook_id", dispatch.Delivery.WebhookID, "attempt", attempts, "status_code", statusCode, "error", err)
+	if attempts >= s.webhookMaxAttempts {
+		attempt.Status = models.DeliveryDead
+		return attempt
+	}
+
+	attempt.Status = models.DeliveryPending
+	attempt.NextAttemptAt = time.Now().Add(s.webhookBackoffAfter(attempts))
+	return attempt
+}
+
+func (s *Service) postWebhook(ctx context.Context, dispatch *models.WebhookDispatch) (int, error) {
+	body, err := json.Marshal(WebhookPayload{DeliveryID: dispatch.Delivery.DeliveryID, Event: dispatch.Event})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dispatch.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", dispatch.Event.Type)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(dispatch.Delivery.DeliveryID, 10))
+	req.Header.Set(SignatureHeader, SignPayload(dispatch.Secret, body))
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookBackoffAfter doubles the base delay for every failed attempt.
+func (s *Service) webhookBackoffAfter(attempts int) time.Duration {
+	delay := s.webhookBackoff
+	for i := 1; i < attempts && delay < maxWebhookBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxWebhookBackoff {
+		delay = maxWebhookBackoff
+	}
+	return delay
+}
+
+// RunWebhookWorker calls DeliverPendingWebhooks every interval until stop is
+// closed.
+func (s *Service) RunWebhookWorker(interval time.Duration, stop <-chan struct{}) {
+	s.webhookWorkerRunning.Store(true)
+	defer s.webhookWorkerRunning.Store(false)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// Keep draining while full batches come back.
+			for {
+				var n int
+				err := s.runTraced("worker.webhooks", func(ctx context.Context) (err error) {
+					n, err = s.DeliverPendingWebhooks(ctx)
+					return err
+				})
+				if err != nil {
+					s.logger.Error("webhook delivery failed", "error", err)
+				}
+				if err != nil || n < webhookBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,437 @@
+// Package tracing records spans for HTTP requests, service methods and
+// repository calls and propagates them with the W3C traceparent and
+// tracestate headers. It covers the subset of OpenTelemetry this service
+// needs: spans are exported in OTLP/HTTP JSON or as JSON lines.
+//
+// The OpenTelemetry SDK is deliberately not a dependency: the service keeps
+// lib/pq as its only module and builds offline, and it needs neither metrics,
+// baggage nor other propagators from the SDK. Trace Context is implemented
+// in full otherwise; tracestate is passed on unchanged, since the service
+// adds no vendor entry of its own.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// W3C Trace Context headers.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// maxTracestateMembers is the most list members tracestate may carry.
+const maxTracestateMembers = 32
+
+const (
+	queueSize  = 2048
+	batchSize  = 512
+	flushEvery = 5 * time.Second
+)
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanKind uses the OTLP numbering.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case KindServer:
+		return "server"
+	case KindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+// SpanContext identifies a span across process boundaries. TraceState is
+// the caller's tracestate, kept for the whole trace.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats sc as a version 00 traceparent value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent accepts a version 00 traceparent, and the same leading
+// fields of later versions as the specification requires.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	if len(value) < 55 || (len(value) > 55 && (value[:2] == "00" || value[55] != '-')) {
+		return sc, false
+	}
+	if value[2] != '-' || value[35] != '-' || value[52] != '-' || value[:2] == "ff" {
+		return sc, false
+	}
+
+	var version, flags [1]byte
+	if !decodeHex(version[:], value[:2]) || !decodeHex(sc.TraceID[:], value[3:35]) ||
+		!decodeHex(sc.SpanID[:], value[36:52]) || !decodeHex(flags[:], value[53:55]) {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// decodeHex only accepts lowercase digits, as traceparent does.
+func decodeHex(dst []byte, src string) bool {
+	for i := 0; i < len(src); i++ {
+		if c := src[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	_, err := hex.Decode(dst, []byte(src))
+	return err == nil
+}
+
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// SpanData is a finished span as handed to an Exporter.
+type SpanData struct {
+	Name         string
+	Kind         SpanKind
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   []Attr
+	// Error is the status message of a failed span, "" otherwise.
+	Error string
+}
+
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// Span is an operation in progress. A nil *Span is a valid no-op span, which
+// is what Start returns when tracing is disabled.
+type Span struct {
+	tracer *Tracer
+	data   SpanData
+	ctx    SpanContext
+	mu     sync.Mutex
+	ended  bool
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Attributes = append(s.data.Attributes, Attr{Key: key, Value: value})
+	s.mu.Unlock()
+}
+
+// SetError marks the span failed; a nil err is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Error = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export if it is sampled. Calls
+// after the first are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.ctx.Sampled {
+		s.tracer.enqueue(data)
+	}
+}
+
+// Tracer creates spans and exports them in batches. A nil *Tracer disables
+// tracing: its spans are nil and nothing is propagated.
+type Tracer struct {
+	exporter Exporter
+	queue    chan SpanData
+	flush    chan chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		queue:    make(chan SpanData, queueSize),
+		flush:    make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// Start begins a span of the given kind. Its parent is the span in ctx or,
+// failing that, a remote parent stored by Extract; otherwise it starts a new
+// sampled trace.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{tracer: t, data: SpanData{Name: name, Kind: kind, Start: time.Now()}}
+	parent := SpanFromContext(ctx).Context()
+	if !parent.IsValid() {
+		parent, _ = ctx.Value(remoteKey{}).(SpanContext)
+	}
+	if parent.IsValid() {
+		span.ctx = SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled, TraceState: parent.TraceState}
+		span.data.ParentSpanID = parent.SpanID
+	} else {
+		span.ctx = SpanContext{Sampled: true}
+		randomID(span.ctx.TraceID[:])
+	}
+	randomID(span.ctx.SpanID[:])
+	span.data.TraceID = span.ctx.TraceID
+	span.data.SpanID = span.ctx.SpanID
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Shutdown exports the queued spans and stops the tracer. Spans ended later
+// are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	var err error
+	t.stopOnce.Do(func() {
+		close(t.done)
+		flushed := make(chan struct{})
+		select {
+		case t.flush <- flushed:
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	})
+	return err
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	select {
+	case <-t.done:
+	case t.queue <- data:
+	default:
+		// Never block a request on a slow exporter.
+	}
+}
+
+func (t *Tracer) run() {
+	ticker := time.NewTicker(flushEvery)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, batchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(context.Background(), batch); err != nil {
+			slog.Error("exporting spans failed", "spans", len(batch), "error", err)
+		}
+		batch = make([]SpanData, 0, batchSize)
+	}
+
+	for {
+		select {
+		case data := <-t.queue:
+			batch = append(batch, data)
+			if len(batch) == batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case flushed := <-t.flush:
+			for drained := false; !drained; {
+				select {
+				case data := <-t.queue:
+					batch = append(batch, data)
+				default:
+					drained = true
+				}
+			}
+			export()
+			close(flushed)
+			return
+		}
+	}
+}
+
+// Start begins a child of the span in ctx, reusing its tracer. Without a
+// span in ctx, e.g. when tracing is disabled, it returns a nil span.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal)
+}
+
+func StartKind(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Extract stores the caller's traceparent and tracestate in ctx as the parent
+// of the next span started with Tracer.Start. tracestate is only read along
+// with a valid traceparent.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	sc, ok := ParseTraceparent(header.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+	sc.TraceState = ParseTracestate(header.Values(TracestateHeader))
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Inject sets traceparent, and tracestate when the trace has one, for the
+// span in ctx, if any.
+func Inject(ctx context.Context, header http.Header) {
+	sc := SpanFromContext(ctx).Context()
+	if !sc.IsValid() {
+		return
+	}
+	header.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		header.Set(TracestateHeader, sc.TraceState)
+	}
+}
+
+// ParseTracestate combines the tracestate header lines into one list without
+// empty members. A list with a malformed or duplicate key, or more than 32
+// members, is discarded as a whole and yields "".
+func ParseTracestate(values []string) string {
+	var members []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		for _, member := range strings.Split(value, ",") {
+			member = strings.TrimSpace(member)
+			if member == "" {
+				continue
+			}
+			key, val, ok := strings.Cut(member, "=")
+			if !ok || !validTracestateKey(key) || !validTracestateValue(val) || seen[key] {
+				return ""
+			}
+			seen[key] = true
+			members = append(members, member)
+		}
+	}
+	if len(members) > maxTracestateMembers {
+		return ""
+	}
+	return strings.Join(members, ",")
+}
+
+// validTracestateKey accepts a simple key or a multi-tenant tenant@system
+// key made of lowercase letters, digits and _-*/.
+func validTracestateKey(key string) bool {
+	tenant, system, multiTenant := strings.Cut(key, "@")
+	if !multiTenant {
+		return len(key) <= 256 && validKeyPart(key, true)
+	}
+	return len(tenant) <= 241 && len(system) <= 14 && validKeyPart(tenant, false) && validKeyPart(system, true)
+}
+
+func validKeyPart(s string, letterFirst bool) bool {
+	if s == "" || (letterFirst && (s[0] < 'a' || s[0] > 'z')) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' && c != '-' && c != '*' && c != '/' {
+			return false
+		}
+	}
+	return true
+}
+
+// validTracestateValue accepts up to 256 printable ASCII characters other
+// than ',' and '=', not ending in a space.
+func validTracestateValue(value string) bool {
+	if value == "" || len(value) > 256 || value[len(value)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return false
+		}
+	}
+	return true
+}
+
+func randomID(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+}
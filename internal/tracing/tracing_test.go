@@ -0,0 +1,221 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *recordingExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	const header = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(header)
+	if !ok || !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("ParseTraceparent = %+v, %v", sc, ok)
+	}
+	if sc.Traceparent() != header {
+		t.Fatalf("Traceparent() = %q", sc.Traceparent())
+	}
+
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-later"); !ok {
+		t.Fatal("expected a future version with extra fields to be accepted")
+	}
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceparent(invalid); ok {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestSpansFollowRemoteParent(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := NewTracer(exporter)
+
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Add(TracestateHeader, "congo=t61rcWkgMzE")
+	header.Add(TracestateHeader, "rojo=00f067aa0ba902b7")
+	ctx, server := tracer.Start(Extract(context.Background(), header), "GET /team/get", KindServer)
+	childCtx, child := Start(ctx, "service.GetTeam")
+	child.SetError(errors.New("boom"))
+	child.End()
+	child.End()
+
+	out := http.Header{}
+	Inject(childCtx, out)
+	server.SetAttr("http.status_code", 200)
+	server.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(exporter.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %+v", exporter.spans)
+	}
+	childData, serverData := exporter.spans[0], exporter.spans[1]
+	if serverData.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		serverData.ParentSpanID.String() != "00f067aa0ba902b7" || serverData.Kind != KindServer {
+		t.Fatalf("server span = %+v", serverData)
+	}
+	if childData.TraceID != serverData.TraceID || childData.ParentSpanID != serverData.SpanID ||
+		childData.Error != "boom" {
+		t.Fatalf("child span = %+v", childData)
+	}
+	if want := child.Context().Traceparent(); out.Get(TraceparentHeader) != want {
+		t.Fatalf("injected %q, want %q", out.Get(TraceparentHeader), want)
+	}
+	if got := out.Values(TracestateHeader); len(got) != 1 || got[0] != "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7" {
+		t.Fatalf("injected tracestate %q, want the caller's list", got)
+	}
+
+	alone := http.Header{}
+	alone.Set(TracestateHeader, "congo=t61rcWkgMzE")
+	_, orphan := tracer.Start(Extract(context.Background(), alone), "no traceparent", KindServer)
+	if orphan.Context().TraceState != "" {
+		t.Fatalf("tracestate without traceparent was kept: %q", orphan.Context().TraceState)
+	}
+}
+
+func TestParseTracestate(t *testing.T) {
+	var tooMany []string
+	for i := 0; i <= maxTracestateMembers; i++ {
+		tooMany = append(tooMany, "k"+strconv.Itoa(i)+"=1")
+	}
+
+	for _, tc := range []struct {
+		values []string
+		want   string
+	}{
+		{nil, ""},
+		{[]string{"rojo=00f067aa0ba902b7, congo=t61rcWkgMzE"}, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"},
+		{[]string{" ,rojo=1,,", "tenant@vendor=x"}, "rojo=1,tenant@vendor=x"},
+		{[]string{"Rojo=1"}, ""},
+		{[]string{"rojo"}, ""},
+		{[]string{"rojo=1,rojo=2"}, ""},
+		{[]string{"rojo=a=b"}, ""},
+		{[]string{"@vendor=1"}, ""},
+		{tooMany[:maxTracestateMembers], strings.Join(tooMany[:maxTracestateMembers], ",")},
+		{tooMany, ""},
+	} {
+		if got := ParseTracestate(tc.values); got != tc.want {
+			t.Errorf("ParseTracestate(%q) = %q, want %q", tc.values, got, tc.want)
+		}
+	}
+}
+
+func TestUnsampledAndDisabledSpansAreNotExported(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := NewTracer(exporter)
+
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, span := tracer.Start(Extract(context.Background(), header), "unsampled", KindServer)
+	_, child := Start(ctx, "child")
+	child.End()
+	span.End()
+
+	var disabled *Tracer
+	ctx, none := disabled.Start(context.Background(), "disabled", KindServer)
+	none.SetAttr("ignored", true)
+	none.End()
+	if _, orphan := Start(ctx, "orphan"); orphan != nil {
+		t.Fatal("expected no span without a parent")
+	}
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(exporter.spans) != 0 {
+		t.Fatalf("expected nothing exported, got %+v", exporter.spans)
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(NewWriterExporter(&buf))
+	ctx, root := tracer.Start(context.Background(), "root", KindInternal)
+	_, child := Start(ctx, "db.GetTeam")
+	child.SetAttr("db.method", "GetTeam")
+	child.End()
+	root.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	var line map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+		t.Fatal(err)
+	}
+	attrs, _ := line["attributes"].(map[string]interface{})
+	if line["name"] != "db.GetTeam" || line["parent_span_id"] != root.Context().SpanID.String() ||
+		attrs["db.method"] != "GetTeam" {
+		t.Fatalf("unexpected line %v", line)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body []byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+
+	tracer := NewTracer(NewOTLPExporter(collector.URL+"/v1/traces", "pr-review-service", collector.Client()))
+	_, span := tracer.Start(context.Background(), "POST /team/add", KindServer)
+	span.SetAttr("http.status_code", 500)
+	span.SetError(errors.New("internal error"))
+	span.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got otlpRequest
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	resource := got.ResourceSpans[0]
+	spans := resource.ScopeSpans[0].Spans
+	if *resource.Resource.Attributes[0].Value.StringValue != "pr-review-service" || len(spans) != 1 {
+		t.Fatalf("unexpected request %s", body)
+	}
+	if spans[0].TraceID != span.Context().TraceID.String() || spans[0].Kind != KindServer ||
+		spans[0].Status.Code != otlpStatusError || *spans[0].Attributes[0].Value.IntValue != "500" {
+		t.Fatalf("unexpected span %s", body)
+	}
+}
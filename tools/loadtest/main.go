@@ -115,6 +115,9 @@ func makeRequest(client *http.Client, method, url string, body []byte) (time.Dur
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	if token := os.Getenv("API_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {